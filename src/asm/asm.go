@@ -0,0 +1,460 @@
+// Package asm assembles CHIP-8 programs written in a subset of the Octo assembly language.
+//
+// Supported are labels (": name"), constants (":const name value"), register aliases
+// (":alias name vX"), macros (":macro name args { body }"), computed constants
+// (":calc name { expression }"), raw bytes, ":byte", ":org", ":call" and every instruction
+// understood by the emulator, including the SUPER-CHIP and XO-CHIP ones.
+// Structured control flow (loop, while, begin and else) is not supported.
+package asm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Origin is the address where programs are loaded.
+const Origin = 0x200
+
+// maxExpansions limits macro expansions, to stop recursive macros.
+const maxExpansions = 100000
+
+// macro is a macro defined with :macro.
+type macro struct {
+	args []string
+	body []token
+}
+
+// fixup is a reference to a label not yet defined, patched at the end of the assembly.
+type fixup struct {
+	addr uint16
+	long bool
+	name token
+}
+
+type assembler struct {
+	tokens []token
+	next   int
+	last   token
+
+	memory  [0x10000]byte
+	here    int
+	end     int
+	emitted bool
+
+	labels  map[string]uint16
+	consts  map[string]int
+	aliases map[string]uint8
+	macros  map[string]*macro
+	fixups  []fixup
+
+	statement  token
+	lines      []SourceLine
+	expansions int
+}
+
+// Assemble assembles the source of a program. The file name is only used in error messages
+// and in the source map. Errors are of type *Error, reporting the position in the source.
+func Assemble(file string, src []byte) (*Program, error) {
+	a := &assembler{
+		tokens:  tokenize(file, string(src)),
+		here:    Origin,
+		end:     Origin,
+		labels:  make(map[string]uint16),
+		consts:  make(map[string]int),
+		aliases: make(map[string]uint8),
+		macros:  make(map[string]*macro),
+	}
+	a.last = token{"", Position{file, 1, 1}}
+
+	for a.more() {
+		if err := a.statementAt(a.take()); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range a.fixups {
+		addr, ok := a.labels[f.name.text]
+		if !ok {
+			return nil, a.errorf(f.name, "undefined label '%s'", f.name.text)
+		}
+
+		if f.long {
+			a.memory[f.addr] = uint8(addr >> 8)
+			a.memory[f.addr+1] = uint8(addr)
+		} else {
+			if addr > 0xFFF {
+				return nil, a.errorf(f.name, "label '%s' at %#x is out of reach of 12 bit addresses", f.name.text, addr)
+			}
+			a.memory[f.addr] |= uint8(addr >> 8)
+			a.memory[f.addr+1] = uint8(addr)
+		}
+	}
+
+	binary := make([]byte, a.end-Origin)
+	copy(binary, a.memory[Origin:a.end])
+
+	return &Program{binary, a.labels, a.lines}, nil
+}
+
+func (a *assembler) errorf(t token, format string, args ...interface{}) error {
+	return &Error{t.pos, fmt.Sprintf(format, args...)}
+}
+
+func (a *assembler) more() bool {
+	return a.next < len(a.tokens)
+}
+
+// take returns the next token, or an empty token at the end of the source.
+func (a *assembler) take() token {
+	if !a.more() {
+		return token{"", a.last.pos}
+	}
+
+	a.last = a.tokens[a.next]
+	a.next++
+	return a.last
+}
+
+// expect takes the next token, failing if it is not text.
+func (a *assembler) expect(text string) error {
+	if t := a.take(); t.text != text {
+		return a.errorf(t, "expected '%s', found '%s'", text, t.text)
+	}
+
+	return nil
+}
+
+// name takes the next token as the name of a new symbol.
+func (a *assembler) name() (token, error) {
+	t := a.take()
+
+	if !validName(t.text) {
+		return t, a.errorf(t, "invalid name '%s'", t.text)
+	}
+
+	if _, ok := a.register(t.text); ok {
+		return t, a.errorf(t, "'%s' is a register", t.text)
+	}
+
+	return t, nil
+}
+
+// constant returns the value of a number, constant or label already defined.
+func (a *assembler) constant(text string) (int, bool) {
+	if value, ok := parseNumber(text); ok {
+		return value, true
+	}
+
+	if value, ok := a.consts[text]; ok {
+		return value, true
+	}
+
+	if addr, ok := a.labels[text]; ok {
+		return int(addr), true
+	}
+
+	return 0, false
+}
+
+// value takes the next token as a value. With forward set, names that are not yet
+// defined are returned as a label reference to be resolved at the end of the assembly.
+func (a *assembler) value(forward bool) (value int, ref *token, err error) {
+	t := a.take()
+
+	if t.text == "{" {
+		value, err := a.valueOfBraces()
+		return value, nil, err
+	}
+
+	if value, ok := a.constant(t.text); ok {
+		return value, nil, nil
+	}
+
+	if forward && t.text != "" {
+		if !validName(t.text) {
+			return 0, nil, a.errorf(t, "invalid value '%s'", t.text)
+		}
+		return 0, &t, nil
+	}
+
+	return 0, nil, a.errorf(t, "undefined value '%s'", t.text)
+}
+
+// validName returns true if text can be the name of a label, constant, alias or macro.
+func validName(text string) bool {
+	return text != "" && !strings.ContainsAny(text[:1], "0123456789:-+=<>{}();")
+}
+
+// ranged takes a value that must fit between min and max.
+func (a *assembler) ranged(min, max int, what string) (int, error) {
+	value, _, err := a.value(false)
+
+	if err == nil && (value < min || value > max) {
+		err = a.errorf(a.last, "%s %d out of range %d to %d", what, value, min, max)
+	}
+
+	return value, err
+}
+
+// byteValue takes a value that fits in a byte, either signed or unsigned.
+func (a *assembler) byteValue() (uint8, error) {
+	value, err := a.ranged(-128, 255, "byte")
+	return uint8(value), err
+}
+
+// register returns the index of a register name, v0 to vF, or of an alias.
+func (a *assembler) register(text string) (uint8, bool) {
+	if reg, ok := a.aliases[text]; ok {
+		return reg, true
+	}
+
+	if len(text) == 2 && (text[0] == 'v' || text[0] == 'V') {
+		if value, ok := parseNumber("0x" + text[1:]); ok {
+			return uint8(value), true
+		}
+	}
+
+	return 0, false
+}
+
+// reg takes the next token as a register.
+func (a *assembler) reg() (uint8, error) {
+	t := a.take()
+
+	if reg, ok := a.register(t.text); ok {
+		return reg, nil
+	}
+
+	return 0, a.errorf(t, "expected a register, found '%s'", t.text)
+}
+
+// braces takes the tokens up to the closing brace, the opening one being already taken.
+func (a *assembler) braces() ([]token, error) {
+	open := a.last
+	depth := 1
+	start := a.next
+
+	for a.more() {
+		switch a.take().text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return a.tokens[start : a.next-1], nil
+			}
+		}
+	}
+
+	return nil, a.errorf(open, "missing '}'")
+}
+
+// emitByte writes a byte at the current address.
+func (a *assembler) emitByte(b uint8) error {
+	if a.here < Origin || a.here >= len(a.memory) {
+		return a.errorf(a.statement, "address %#x is outside of the program memory", a.here)
+	}
+
+	if !a.emitted {
+		a.lines = append(a.lines, SourceLine{uint16(a.here), a.statement.pos})
+		a.emitted = true
+	}
+
+	a.memory[a.here] = b
+	a.here++
+
+	if a.here > a.end {
+		a.end = a.here
+	}
+
+	return nil
+}
+
+// emit writes an opcode at the current address.
+func (a *assembler) emit(opcode uint16) error {
+	if err := a.emitByte(uint8(opcode >> 8)); err != nil {
+		return err
+	}
+
+	return a.emitByte(uint8(opcode))
+}
+
+// emitAddr writes an opcode with a 12 bit address, which can be a label defined later.
+func (a *assembler) emitAddr(opcode uint16) error {
+	value, ref, err := a.value(true)
+	if err != nil {
+		return err
+	}
+
+	if ref != nil {
+		a.fixups = append(a.fixups, fixup{uint16(a.here), false, *ref})
+	} else if value < 0 || value > 0xFFF {
+		return a.errorf(a.last, "address %#x out of range 0 to 0xfff", value)
+	}
+
+	return a.emit(opcode | uint16(value))
+}
+
+// statementAt assembles the statement starting with t.
+func (a *assembler) statementAt(t token) error {
+	a.statement = t
+	a.emitted = false
+
+	switch t.text {
+	case ":":
+		name, err := a.name()
+		if err != nil {
+			return err
+		}
+		return a.defineLabel(name)
+	case ":const":
+		name, err := a.name()
+		if err != nil {
+			return err
+		}
+		value, _, err := a.value(false)
+		a.consts[name.text] = value
+		return err
+	case ":calc":
+		name, err := a.name()
+		if err != nil {
+			return err
+		}
+		if err := a.expect("{"); err != nil {
+			return err
+		}
+		value, err := a.valueOfBraces()
+		a.consts[name.text] = value
+		return err
+	case ":alias":
+		name, err := a.name()
+		if err != nil {
+			return err
+		}
+		reg, err := a.reg()
+		a.aliases[name.text] = reg
+		return err
+	case ":macro":
+		return a.defineMacro()
+	case ":org":
+		addr, err := a.ranged(Origin, 0xFFFF, "address")
+		a.here = addr
+		return err
+	case ":byte":
+		b, err := a.byteValue()
+		if err != nil {
+			return err
+		}
+		return a.emitByte(b)
+	case ":call":
+		return a.emitAddr(0x2000)
+	}
+
+	if m, ok := a.macros[t.text]; ok {
+		return a.expand(t, m)
+	}
+
+	if handled, err := a.instruction(t); handled {
+		return err
+	}
+
+	if _, ok := a.register(t.text); ok {
+		return a.registerOp(t)
+	}
+
+	// raw data
+	if value, ok := a.constant(t.text); ok {
+		if value < -128 || value > 255 {
+			return a.errorf(t, "byte %d out of range -128 to 255", value)
+		}
+		return a.emitByte(uint8(value))
+	}
+
+	// calling a subroutine by name, possibly defined later
+	if !validName(t.text) {
+		return a.errorf(t, "unexpected '%s'", t.text)
+	}
+
+	a.fixups = append(a.fixups, fixup{uint16(a.here), false, t})
+	return a.emit(0x2000)
+}
+
+// valueOfBraces evaluates the expression up to the closing brace.
+func (a *assembler) valueOfBraces() (int, error) {
+	expr, err := a.braces()
+	if err != nil {
+		return 0, err
+	}
+
+	value, rest, err := a.evalExpr(expr)
+	if err == nil && len(rest) > 0 {
+		err = a.errorf(rest[0], "unexpected '%s' in expression", rest[0].text)
+	}
+
+	return value, err
+}
+
+func (a *assembler) defineLabel(name token) error {
+	if _, ok := a.labels[name.text]; ok {
+		return a.errorf(name, "label '%s' already defined", name.text)
+	}
+
+	a.labels[name.text] = uint16(a.here)
+	return nil
+}
+
+func (a *assembler) defineMacro() error {
+	name, err := a.name()
+	if err != nil {
+		return err
+	}
+
+	m := &macro{}
+	for {
+		t := a.take()
+		if t.text == "{" {
+			break
+		}
+		if t.text == "" {
+			return a.errorf(name, "missing '{' in macro '%s'", name.text)
+		}
+		m.args = append(m.args, t.text)
+	}
+
+	if m.body, err = a.braces(); err != nil {
+		return err
+	}
+
+	a.macros[name.text] = m
+	return nil
+}
+
+// expand replaces a macro invocation with the macro body, substituting the arguments.
+func (a *assembler) expand(call token, m *macro) error {
+	a.expansions++
+	if a.expansions > maxExpansions {
+		return a.errorf(call, "too many macro expansions, is '%s' recursive?", call.text)
+	}
+
+	args := make(map[string]string)
+	for _, arg := range m.args {
+		t := a.take()
+		if t.text == "" {
+			return a.errorf(call, "missing argument '%s' of macro '%s'", arg, call.text)
+		}
+		args[arg] = t.text
+	}
+
+	// the expanded code is reported at the position of the invocation
+	body := make([]token, len(m.body))
+	for i, t := range m.body {
+		if value, ok := args[t.text]; ok {
+			t.text = value
+		}
+		body[i] = token{t.text, call.pos}
+	}
+
+	rest := append(body, a.tokens[a.next:]...)
+	a.tokens = append(a.tokens[:a.next], rest...)
+	return nil
+}
@@ -0,0 +1,258 @@
+package asm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/valep27/GChip8/src/disasm"
+	"github.com/valep27/GChip8/src/emu"
+	"github.com/valep27/GChip8/src/util"
+)
+
+func TestInstructions(t *testing.T) {
+	tests := []struct {
+		src  string
+		want uint16
+	}{
+		{"clear", 0x00E0},
+		{"return", 0x00EE},
+		{";", 0x00EE},
+		{"scroll-down 5", 0x00C5},
+		{"scroll-right", 0x00FB},
+		{"scroll-left", 0x00FC},
+		{"exit", 0x00FD},
+		{"lores", 0x00FE},
+		{"hires", 0x00FF},
+		{"jump 0x345", 0x1345},
+		{":call 0x345", 0x2345},
+		{"if v1 != 0x42 then", 0x3142},
+		{"if v1 == 0x42 then", 0x4142},
+		{"if v1 != v2 then", 0x5120},
+		{"save v1 - v2", 0x5122},
+		{"load v1 - v2", 0x5123},
+		{"vA := 0x42", 0x6A42},
+		{"va += 1", 0x7A01},
+		{"va -= 1", 0x7AFF},
+		{"v1 := v2", 0x8120},
+		{"v1 |= v2", 0x8121},
+		{"v1 &= v2", 0x8122},
+		{"v1 ^= v2", 0x8123},
+		{"v1 += v2", 0x8124},
+		{"v1 -= v2", 0x8125},
+		{"v1 >>= v2", 0x8126},
+		{"v1 =- v2", 0x8127},
+		{"v1 <<= v2", 0x812E},
+		{"if v1 == v2 then", 0x9120},
+		{"i := 0x123", 0xA123},
+		{"jump0 0x300", 0xB300},
+		{"v1 := random 0x0F", 0xC10F},
+		{"sprite v1 v2 15", 0xD12F},
+		{"if v1 -key then", 0xE19E},
+		{"if v1 key then", 0xE1A1},
+		{"plane 3", 0xF301},
+		{"audio", 0xF002},
+		{"v1 := delay", 0xF107},
+		{"v1 := key", 0xF10A},
+		{"delay := v1", 0xF115},
+		{"buzzer := v1", 0xF118},
+		{"i += v1", 0xF11E},
+		{"i := hex v1", 0xF129},
+		{"i := bighex v1", 0xF130},
+		{"bcd v1", 0xF133},
+		{"pitch := v1", 0xF13A},
+		{"save v1", 0xF155},
+		{"load v1", 0xF165},
+		{"saveflags v1", 0xF175},
+		{"loadflags v1", 0xF185},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			p, err := Assemble("test.8o", []byte(tt.src))
+			if err != nil {
+				t.Fatalf("Assemble() error = %v", err)
+			}
+
+			if len(p.Binary) != 2 {
+				t.Fatalf("Assemble() = % X, want 2 bytes", p.Binary)
+			}
+			if got := util.CombineBytes(p.Binary[1], p.Binary[0]); got != tt.want {
+				t.Errorf("Assemble() = %04X, want %04X", got, tt.want)
+			}
+			if _, ok := emu.DecodeOp(tt.want); !ok {
+				t.Errorf("%04X is not understood by the emulator", tt.want)
+			}
+		})
+	}
+}
+
+func TestLongLoad(t *testing.T) {
+	p, err := Assemble("test.8o", []byte("i := long data\n: data 0xAA"))
+	if err != nil {
+		t.Fatalf("Assemble() error = %v", err)
+	}
+
+	if want := []byte{0xF0, 0x00, 0x02, 0x04, 0xAA}; !bytes.Equal(p.Binary, want) {
+		t.Errorf("Assemble() = % X, want % X", p.Binary, want)
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	src := `
+: main
+	:const SPEED 3
+	:alias x v4
+	:calc DOUBLE { SPEED * 2 + 1 }
+	:macro inc reg amount { reg += amount }
+	x := SPEED
+	inc x DOUBLE
+	i := sprite
+	draw          # forward call
+	jump main
+: draw
+	sprite x x 2
+	return
+: sprite
+	0b11110000 -1
+	:byte { HERE - 0x200 }
+	:org 0x300
+	7
+`
+	p, err := Assemble("test.8o", []byte(src))
+	if err != nil {
+		t.Fatalf("Assemble() error = %v", err)
+	}
+
+	want := []byte{
+		0x64, 0x03, // x := SPEED
+		0x74, 0x09, // inc x DOUBLE, evaluated right to left: 3 * (2 + 1)
+		0xA2, 0x0E, // i := sprite
+		0x22, 0x0A, // draw
+		0x12, 0x00, // jump main
+		0xD4, 0x42, // sprite x x 2
+		0x00, 0xEE, // return
+		0xF0, 0xFF, 0x10,
+	}
+	want = append(want, make([]byte, 0x300-0x211)...)
+	want = append(want, 7)
+
+	if !bytes.Equal(p.Binary, want) {
+		t.Errorf("Assemble() =\n% X\nwant\n% X", p.Binary, want)
+	}
+
+	if p.Symbols["draw"] != 0x20A || p.Symbols["sprite"] != 0x20E {
+		t.Errorf("symbols = %v", p.Symbols)
+	}
+
+	wantLines := []SourceLine{
+		{0x200, Position{"test.8o", 7, 2}},
+		{0x202, Position{"test.8o", 8, 2}},
+	}
+	if !reflect.DeepEqual(p.Lines[:2], wantLines) {
+		t.Errorf("lines = %v, want %v", p.Lines[:2], wantLines)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"undefined label", "jump nowhere", "test.8o:1:6: undefined label 'nowhere'"},
+		{"unknown operator", "v1 ** v2", "test.8o:1:4: unknown operator '**'"},
+		{"byte out of range", "\n  v1 := 256", "test.8o:2:9: byte 256 out of range -128 to 255"},
+		{"missing register", "sprite v1 5 5", "test.8o:1:11: expected a register, found '5'"},
+		{"missing then", "if v1 == 2 skip", "test.8o:1:12: expected 'then', found 'skip'"},
+		{"duplicate label", ": a\n: a", "test.8o:2:3: label 'a' already defined"},
+		{"unclosed macro", ":macro m {\nclear", "test.8o:1:10: missing '}'"},
+		{"recursive macro", ":macro m { m }\nm", "test.8o:2:1: too many macro expansions, is 'm' recursive?"},
+		{"division by zero", ":calc x { 1 / 0 }", "test.8o:1:13: division by zero"},
+		{"address out of range", "jump 0x1000", "test.8o:1:6: address 0x1000 out of range 0 to 0xfff"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Assemble("test.8o", []byte(tt.src))
+
+			var asmErr *Error
+			if !errors.As(err, &asmErr) {
+				t.Fatalf("Assemble() error = %v, want an *Error", err)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Assemble() error = %q, want %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+// TestDisassemblyRoundTrip assembles the disassembly of every game, which must give back the game.
+func TestDisassemblyRoundTrip(t *testing.T) {
+	games, err := filepath.Glob("../../games/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roms := map[string][]byte{
+		// opcodes decoding loosely as 9XY0, 00E0 and 00CN
+		"loose encodings": {0x91, 0x21, 0x01, 0xE0, 0x05, 0xC3, 0x12, 0x06},
+	}
+	for _, path := range games {
+		rom, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roms[filepath.Base(path)] = rom
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		rom := make([]byte, 64)
+		r.Read(rom)
+		roms[fmt.Sprintf("random %d", i)] = rom
+	}
+
+	for name, rom := range roms {
+		t.Run(name, func(t *testing.T) {
+			var src bytes.Buffer
+			if err := disasm.Disassemble(rom, disasm.Origin).Write(&src, disasm.Octo); err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := Assemble(name+".8o", src.Bytes())
+			if err != nil {
+				t.Fatalf("Assemble() error = %v", err)
+			}
+			if !bytes.Equal(p.Binary, rom) {
+				t.Errorf("assembled program differs from the original:\n%s", src.String())
+			}
+		})
+	}
+}
+
+func TestMapRoundTrip(t *testing.T) {
+	p, err := Assemble("test.8o", []byte(": main\n  clear\n: loop\n  jump loop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteMap(&buf); err != nil {
+		t.Fatalf("WriteMap() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), `"loop": 514`) {
+		t.Errorf("map does not contain the loop label:\n%s", buf.String())
+	}
+
+	read, err := ReadMap(&buf)
+	if err != nil {
+		t.Fatalf("ReadMap() error = %v", err)
+	}
+	if !reflect.DeepEqual(read.Symbols, p.Symbols) || !reflect.DeepEqual(read.Lines, p.Lines) {
+		t.Errorf("ReadMap() = %+v, want %+v", read, p)
+	}
+}
@@ -0,0 +1,121 @@
+package asm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// parseNumber parses a decimal, hex (0x) or binary (0b) number, optionally negative.
+func parseNumber(text string) (int, bool) {
+	negative := strings.HasPrefix(text, "-")
+	digits := strings.TrimPrefix(text, "-")
+	base := 10
+
+	switch {
+	case strings.HasPrefix(digits, "0x"), strings.HasPrefix(digits, "0X"):
+		digits, base = digits[2:], 16
+	case strings.HasPrefix(digits, "0b"), strings.HasPrefix(digits, "0B"):
+		digits, base = digits[2:], 2
+	}
+
+	value, err := strconv.ParseInt(digits, base, 32)
+	if err != nil || digits == "" {
+		return 0, false
+	}
+
+	if negative {
+		value = -value
+	}
+
+	return int(value), true
+}
+
+// binaryOps are the operators of :calc expressions.
+var binaryOps = map[string]func(a, b int) (int, bool){
+	"+":  func(a, b int) (int, bool) { return a + b, true },
+	"-":  func(a, b int) (int, bool) { return a - b, true },
+	"*":  func(a, b int) (int, bool) { return a * b, true },
+	"/":  func(a, b int) (int, bool) { return safeDiv(a, b, false) },
+	"%":  func(a, b int) (int, bool) { return safeDiv(a, b, true) },
+	"&":  func(a, b int) (int, bool) { return a & b, true },
+	"|":  func(a, b int) (int, bool) { return a | b, true },
+	"^":  func(a, b int) (int, bool) { return a ^ b, true },
+	"<<": func(a, b int) (int, bool) { return a << uint(b&31), true },
+	">>": func(a, b int) (int, bool) { return a >> uint(b&31), true },
+}
+
+func safeDiv(a, b int, remainder bool) (int, bool) {
+	if b == 0 {
+		return 0, false
+	}
+
+	if remainder {
+		return a % b, true
+	}
+
+	return a / b, true
+}
+
+// evalExpr evaluates the tokens of a :calc expression. Like in Octo, there is no operator
+// precedence: expressions are evaluated right to left, and parentheses group terms.
+// Terms are numbers, constants, labels defined earlier and HERE, the current address.
+func (a *assembler) evalExpr(tokens []token) (int, []token, error) {
+	left, rest, err := a.evalTerm(tokens)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(rest) == 0 || rest[0].text == ")" {
+		return left, rest, nil
+	}
+
+	op, ok := binaryOps[rest[0].text]
+	if !ok {
+		return 0, nil, a.errorf(rest[0], "unknown operator '%s'", rest[0].text)
+	}
+
+	right, rest2, err := a.evalExpr(rest[1:])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	result, ok := op(left, right)
+	if !ok {
+		return 0, nil, a.errorf(rest[0], "division by zero")
+	}
+
+	return result, rest2, nil
+}
+
+func (a *assembler) evalTerm(tokens []token) (int, []token, error) {
+	if len(tokens) == 0 {
+		return 0, nil, a.errorf(a.last, "missing value in expression")
+	}
+
+	t := tokens[0]
+	switch t.text {
+	case "(":
+		value, rest, err := a.evalExpr(tokens[1:])
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(rest) == 0 {
+			return 0, nil, a.errorf(t, "missing ')'")
+		}
+		return value, rest[1:], nil
+	case "-":
+		value, rest, err := a.evalTerm(tokens[1:])
+		return -value, rest, err
+	case "~":
+		value, rest, err := a.evalTerm(tokens[1:])
+		return ^value, rest, err
+	case "HERE":
+		return a.here, tokens[1:], nil
+	}
+
+	if value, ok := a.constant(t.text); ok {
+		return value, tokens[1:], nil
+	}
+
+	return 0, nil, a.errorf(t, "undefined value '%s'", t.text)
+}
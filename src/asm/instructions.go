@@ -0,0 +1,290 @@
+package asm
+
+// simpleOps are the instructions without operands.
+var simpleOps = map[string]uint16{
+	"clear":        0x00E0,
+	"return":       0x00EE,
+	";":            0x00EE,
+	"scroll-right": 0x00FB,
+	"scroll-left":  0x00FC,
+	"exit":         0x00FD,
+	"lores":        0x00FE,
+	"hires":        0x00FF,
+	"audio":        0xF002,
+}
+
+// registerOps are the instructions with a single register operand X, written as "name vX".
+var registerOps = map[string]uint16{
+	"bcd":       0xF033,
+	"saveflags": 0xF075,
+	"loadflags": 0xF085,
+}
+
+// timerOps are the instructions that set a timer or the pitch from a register.
+var timerOps = map[string]uint16{
+	"delay":  0xF015,
+	"buzzer": 0xF018,
+	"pitch":  0xF03A,
+}
+
+// instruction assembles the instructions starting with a keyword.
+// It returns false if t is not a keyword.
+func (a *assembler) instruction(t token) (bool, error) {
+	if opcode, ok := simpleOps[t.text]; ok {
+		return true, a.emit(opcode)
+	}
+
+	if opcode, ok := registerOps[t.text]; ok {
+		x, err := a.reg()
+		if err != nil {
+			return true, err
+		}
+		return true, a.emit(opcode | uint16(x)<<8)
+	}
+
+	if opcode, ok := timerOps[t.text]; ok {
+		if err := a.expect(":="); err != nil {
+			return true, err
+		}
+		x, err := a.reg()
+		if err != nil {
+			return true, err
+		}
+		return true, a.emit(opcode | uint16(x)<<8)
+	}
+
+	switch t.text {
+	case "jump":
+		return true, a.emitAddr(0x1000)
+	case "jump0":
+		return true, a.emitAddr(0xB000)
+	case "scroll-down":
+		n, err := a.ranged(0, 15, "scroll amount")
+		if err != nil {
+			return true, err
+		}
+		return true, a.emit(0x00C0 | uint16(n))
+	case "plane":
+		n, err := a.ranged(0, 3, "plane")
+		if err != nil {
+			return true, err
+		}
+		return true, a.emit(0xF001 | uint16(n)<<8)
+	case "sprite":
+		x, err := a.reg()
+		if err != nil {
+			return true, err
+		}
+		y, err := a.reg()
+		if err != nil {
+			return true, err
+		}
+		n, err := a.ranged(0, 15, "sprite height")
+		if err != nil {
+			return true, err
+		}
+		return true, a.emit(0xD000 | uint16(x)<<8 | uint16(y)<<4 | uint16(n))
+	case "save", "load":
+		return true, a.loadStore(t.text == "save")
+	case "i":
+		return true, a.iOp()
+	case "if":
+		return true, a.ifOp()
+	}
+
+	return false, nil
+}
+
+// loadStore assembles "save vX", "load vX" and the XO-CHIP ranges "save vX - vY" and "load vX - vY".
+func (a *assembler) loadStore(save bool) error {
+	x, err := a.reg()
+	if err != nil {
+		return err
+	}
+
+	if !a.more() || a.tokens[a.next].text != "-" {
+		if save {
+			return a.emit(0xF055 | uint16(x)<<8)
+		}
+		return a.emit(0xF065 | uint16(x)<<8)
+	}
+
+	a.take()
+	y, err := a.reg()
+	if err != nil {
+		return err
+	}
+
+	if save {
+		return a.emit(0x5002 | uint16(x)<<8 | uint16(y)<<4)
+	}
+	return a.emit(0x5003 | uint16(x)<<8 | uint16(y)<<4)
+}
+
+// iOp assembles the instructions operating on I.
+func (a *assembler) iOp() error {
+	op := a.take()
+
+	switch op.text {
+	case "+=":
+		x, err := a.reg()
+		if err != nil {
+			return err
+		}
+		return a.emit(0xF01E | uint16(x)<<8)
+	case ":=":
+	default:
+		return a.errorf(op, "expected ':=' or '+=' after i, found '%s'", op.text)
+	}
+
+	if a.more() {
+		switch a.tokens[a.next].text {
+		case "hex", "bighex":
+			kind := a.take()
+			x, err := a.reg()
+			if err != nil {
+				return err
+			}
+			if kind.text == "hex" {
+				return a.emit(0xF029 | uint16(x)<<8)
+			}
+			return a.emit(0xF030 | uint16(x)<<8)
+		case "long":
+			a.take()
+			if err := a.emit(0xF000); err != nil {
+				return err
+			}
+			value, ref, err := a.value(true)
+			if err != nil {
+				return err
+			}
+			if ref != nil {
+				a.fixups = append(a.fixups, fixup{uint16(a.here), true, *ref})
+			} else if value < 0 || value > 0xFFFF {
+				return a.errorf(a.last, "address %#x out of range 0 to 0xffff", value)
+			}
+			return a.emit(uint16(value))
+		}
+	}
+
+	return a.emitAddr(0xA000)
+}
+
+// ifOp assembles a conditional skip. Like in Octo, the condition tells when the following
+// instruction is executed, so "if v0 == 1 then" skips it when v0 is not 1.
+func (a *assembler) ifOp() error {
+	x, err := a.reg()
+	if err != nil {
+		return err
+	}
+
+	var opcode uint16
+	op := a.take()
+
+	switch op.text {
+	case "key":
+		opcode = 0xE0A1 | uint16(x)<<8
+	case "-key":
+		opcode = 0xE09E | uint16(x)<<8
+	case "==", "!=":
+		if a.more() {
+			if y, ok := a.register(a.tokens[a.next].text); ok {
+				a.take()
+				opcode = 0x9000
+				if op.text == "!=" {
+					opcode = 0x5000
+				}
+				opcode |= uint16(x)<<8 | uint16(y)<<4
+				break
+			}
+		}
+
+		nn, err := a.byteValue()
+		if err != nil {
+			return err
+		}
+		opcode = 0x4000
+		if op.text == "!=" {
+			opcode = 0x3000
+		}
+		opcode |= uint16(x)<<8 | uint16(nn)
+	default:
+		return a.errorf(op, "unsupported condition '%s'", op.text)
+	}
+
+	if err := a.expect("then"); err != nil {
+		return err
+	}
+
+	return a.emit(opcode)
+}
+
+// registerArithmetic are the 8XYN instructions, by operator.
+var registerArithmetic = map[string]uint16{
+	":=":  0x8000,
+	"|=":  0x8001,
+	"&=":  0x8002,
+	"^=":  0x8003,
+	"+=":  0x8004,
+	"-=":  0x8005,
+	">>=": 0x8006,
+	"=-":  0x8007,
+	"<<=": 0x800E,
+}
+
+// registerOp assembles the instructions that start with a register.
+func (a *assembler) registerOp(t token) error {
+	x, _ := a.register(t.text)
+	op := a.take()
+
+	base, ok := registerArithmetic[op.text]
+	if !ok {
+		return a.errorf(op, "unknown operator '%s'", op.text)
+	}
+
+	if a.more() {
+		next := a.tokens[a.next]
+
+		if y, ok := a.register(next.text); ok {
+			a.take()
+			return a.emit(base | uint16(x)<<8 | uint16(y)<<4)
+		}
+
+		if op.text == ":=" {
+			switch next.text {
+			case "random":
+				a.take()
+				nn, err := a.byteValue()
+				if err != nil {
+					return err
+				}
+				return a.emit(0xC000 | uint16(x)<<8 | uint16(nn))
+			case "delay":
+				a.take()
+				return a.emit(0xF007 | uint16(x)<<8)
+			case "key":
+				a.take()
+				return a.emit(0xF00A | uint16(x)<<8)
+			}
+		}
+	}
+
+	switch op.text {
+	case ":=", "+=", "-=":
+		nn, err := a.byteValue()
+		if err != nil {
+			return err
+		}
+		switch op.text {
+		case ":=":
+			return a.emit(0x6000 | uint16(x)<<8 | uint16(nn))
+		case "+=":
+			return a.emit(0x7000 | uint16(x)<<8 | uint16(nn))
+		default:
+			return a.emit(0x7000 | uint16(x)<<8 | uint16(-nn))
+		}
+	}
+
+	found := a.take()
+	return a.errorf(found, "operator '%s' needs a register, found '%s'", op.text, found.text)
+}
@@ -0,0 +1,65 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Position is a location in a source file. Lines and columns start from 1.
+type Position struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Col  int    `json:"col"`
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+// Error is an assembly error at a position of the source.
+type Error struct {
+	Pos Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// token is a whitespace separated word of the source.
+type token struct {
+	text string
+	pos  Position
+}
+
+// tokenize splits the source in tokens, dropping comments that go from '#' to the end of the line.
+func tokenize(file string, src string) []token {
+	var tokens []token
+
+	for n, line := range strings.Split(src, "\n") {
+		col := 0
+
+		for col < len(line) {
+			r := rune(line[col])
+
+			if unicode.IsSpace(r) {
+				col++
+				continue
+			}
+
+			if r == '#' {
+				break
+			}
+
+			start := col
+			for col < len(line) && !unicode.IsSpace(rune(line[col])) {
+				col++
+			}
+
+			tokens = append(tokens, token{line[start:col], Position{file, n + 1, start + 1}})
+		}
+	}
+
+	return tokens
+}
@@ -0,0 +1,55 @@
+package asm
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// Program is an assembled program, to be loaded at Origin.
+type Program struct {
+	// Binary holds the bytes of the program.
+	Binary []byte
+	// Symbols holds the address of every label.
+	Symbols map[string]uint16
+	// Lines maps the address of every instruction and data byte to its position in the source,
+	// sorted by address.
+	Lines []SourceLine
+}
+
+// SourceLine is the position in the source of the statement that produced the bytes at Addr.
+type SourceLine struct {
+	Addr uint16 `json:"addr"`
+	Position
+}
+
+// symbolMap is the format of the map written by WriteMap.
+type symbolMap struct {
+	Origin  uint16            `json:"origin"`
+	Symbols map[string]uint16 `json:"symbols"`
+	Lines   []SourceLine      `json:"lines"`
+}
+
+// WriteMap writes the symbols and the source map of the program as JSON, with the
+// labels in "symbols" and the source position of every address in "lines".
+func (p *Program) WriteMap(w io.Writer) error {
+	lines := append([]SourceLine(nil), p.Lines...)
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Addr < lines[j].Addr
+	})
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(symbolMap{Origin, p.Symbols, lines})
+}
+
+// ReadMap reads a map written by WriteMap.
+func ReadMap(r io.Reader) (*Program, error) {
+	var m symbolMap
+
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+
+	return &Program{nil, m.Symbols, m.Lines}, nil
+}
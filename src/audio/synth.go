@@ -0,0 +1,72 @@
+package audio
+
+import "github.com/valep27/GChip8/src/emu"
+
+const (
+	// DefaultSampleRate is the sample rate used for audio output, in Hz.
+	DefaultSampleRate = 44100
+
+	// volume is the amplitude of the generated square wave.
+	volume = 8000
+)
+
+// Synth generates 16 bit signed PCM samples from the state of the emulator sound hardware,
+// playing the 1-bit audio pattern at the rate given by the pitch register.
+type Synth struct {
+	sampleRate int
+	phase      float64
+}
+
+// NewSynth creates a synthesizer producing samples at the given rate.
+func NewSynth(sampleRate int) *Synth {
+	return &Synth{sampleRate, 0}
+}
+
+// SampleRate returns the number of samples per second produced by the synthesizer.
+func (s *Synth) SampleRate() int {
+	return s.sampleRate
+}
+
+// FrameSamples returns the number of samples that cover one 60 Hz frame.
+func (s *Synth) FrameSamples() int {
+	return s.sampleRate / emu.TimerFrequency
+}
+
+// Render fills samples with the audio for the given state.
+// Silence is produced when the sound timer is not active, and the pattern restarts
+// from the beginning the next time it is played.
+func (s *Synth) Render(state emu.AudioState, samples []int16) {
+	if !state.Playing {
+		for i := range samples {
+			samples[i] = 0
+		}
+		s.phase = 0
+		return
+	}
+
+	patternBits := float64(len(state.Pattern) * 8)
+	step := state.PlaybackRate() / float64(s.sampleRate)
+
+	for i := range samples {
+		bit := int(s.phase)
+		value := (state.Pattern[bit/8] >> uint(7-bit%8)) & 1
+
+		if value == 1 {
+			samples[i] = volume
+		} else {
+			samples[i] = -volume
+		}
+
+		s.phase += step
+		for s.phase >= patternBits {
+			s.phase -= patternBits
+		}
+	}
+}
+
+// RenderFrame returns the samples for one 60 Hz frame of the given state.
+func (s *Synth) RenderFrame(state emu.AudioState) []int16 {
+	samples := make([]int16, s.FrameSamples())
+	s.Render(state, samples)
+	return samples
+}
@@ -0,0 +1,117 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/valep27/GChip8/src/emu"
+)
+
+func TestRenderSilence(t *testing.T) {
+	synth := NewSynth(DefaultSampleRate)
+	samples := synth.RenderFrame(emu.AudioState{Playing: false})
+
+	for i, sample := range samples {
+		if sample != 0 {
+			t.Fatalf("sample %v = %v, want silence", i, sample)
+		}
+	}
+}
+
+func TestRenderPattern(t *testing.T) {
+	// at pitch 64 the pattern plays at 4000 Hz: with an 8000 Hz sample rate
+	// every bit of the pattern lasts two samples
+	state := emu.AudioState{Pitch: 64, Playing: true}
+	state.Pattern[0] = 0xA0 // 1010 0000
+
+	synth := NewSynth(8000)
+	samples := make([]int16, 8)
+	synth.Render(state, samples)
+
+	want := []int16{volume, volume, -volume, -volume, volume, volume, -volume, -volume}
+	for i := range want {
+		if samples[i] != want[i] {
+			t.Errorf("sample %v = %v, want %v", i, samples[i], want[i])
+		}
+	}
+}
+
+func TestPlaybackRate(t *testing.T) {
+	tests := []struct {
+		pitch uint8
+		want  float64
+	}{
+		{64, 4000},
+		{112, 8000},
+		{16, 2000},
+	}
+	for _, tt := range tests {
+		if got := (emu.AudioState{Pitch: tt.pitch}).PlaybackRate(); got != tt.want {
+			t.Errorf("PlaybackRate() with pitch %v = %v, want %v", tt.pitch, got, tt.want)
+		}
+	}
+}
+
+func TestWriteWav(t *testing.T) {
+	var buf bytes.Buffer
+	samples := []int16{0, 1, -1, volume}
+
+	if err := WriteWav(&buf, DefaultSampleRate, samples); err != nil {
+		t.Fatalf("WriteWav() error = %v", err)
+	}
+
+	data := buf.Bytes()
+	if len(data) != 44+2*len(samples) {
+		t.Fatalf("WAV size = %v, want %v", len(data), 44+2*len(samples))
+	}
+	if string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" || string(data[36:40]) != "data" {
+		t.Errorf("invalid WAV header % x", data[:44])
+	}
+	if rate := binary.LittleEndian.Uint32(data[24:28]); rate != DefaultSampleRate {
+		t.Errorf("WAV sample rate = %v, want %v", rate, DefaultSampleRate)
+	}
+	if last := int16(binary.LittleEndian.Uint16(data[len(data)-2:])); last != volume {
+		t.Errorf("last sample = %v, want %v", last, volume)
+	}
+}
+
+func TestRenderEmulatorOffline(t *testing.T) {
+	c8 := emu.New()
+	// V0 = 6, sound timer = V0, then loop forever
+	rom := []uint8{0x60, 0x06, 0xF0, 0x18, 0x12, 0x04}
+	if err := c8.LoadBytes(rom); err != nil {
+		t.Fatal(err)
+	}
+
+	synth := NewSynth(DefaultSampleRate)
+	var samples []int16
+
+	for frame := 0; frame < 10; frame++ {
+		if err := c8.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+		samples = append(samples, synth.RenderFrame(c8.Audio())...)
+	}
+
+	frameSamples := synth.FrameSamples()
+	// the sound timer was set to 6 during the first frame, and it was ticked once already
+	for frame := 0; frame < 10; frame++ {
+		frameData := samples[frame*frameSamples : (frame+1)*frameSamples]
+		silent := true
+		for _, sample := range frameData {
+			if sample != 0 {
+				silent = false
+			}
+		}
+
+		if wantSilent := frame >= 5; silent != wantSilent {
+			t.Errorf("frame %v silent = %v, want %v", frame, silent, wantSilent)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteWav(&buf, synth.SampleRate(), samples); err != nil {
+		t.Fatalf("WriteWav() error = %v", err)
+	}
+}
@@ -0,0 +1,353 @@
+// Package cfg recovers the control-flow graph of a CHIP-8 program.
+//
+// The program is walked from its entry point following jumps, calls, skips and the jump
+// tables of BNNN, and split into basic blocks: straight-line runs of instructions that are
+// only entered at their first instruction and only left after their last one.
+// Blocks are grouped into subroutines, the ones reached from the entry point or from the
+// target of a call without following calls. Bytes that are never reached are data.
+package cfg
+
+import (
+	"sort"
+
+	"github.com/valep27/GChip8/src/disasm"
+	"github.com/valep27/GChip8/src/emu"
+)
+
+// maxTableEntries is the number of jumps that fit in the 256 bytes addressed by BNNN.
+const maxTableEntries = 128
+
+// EdgeKind tells how the flow goes from a block to another.
+type EdgeKind uint8
+
+// The possible kinds of edges.
+const (
+	// Fallthrough goes on with the following instruction.
+	Fallthrough EdgeKind = iota
+	// Jump is taken by 1NNN.
+	Jump
+	// Skip is taken when a skip instruction skips the following instruction.
+	Skip
+	// Call enters a subroutine with 2NNN. The return address is reached by a Fallthrough edge.
+	Call
+	// Table is an entry of the jump table of BNNN.
+	Table
+)
+
+var edgeKindNames = []string{"fallthrough", "jump", "skip", "call", "table"}
+
+func (k EdgeKind) String() string {
+	if int(k) < len(edgeKindNames) {
+		return edgeKindNames[k]
+	}
+
+	return "unknown"
+}
+
+// Edge is a transfer of control to the block starting at To.
+type Edge struct {
+	To   uint16
+	Kind EdgeKind
+}
+
+// Block is a basic block.
+type Block struct {
+	// Start and End delimit the memory of the block, End excluded.
+	Start, End   uint16
+	Instructions []disasm.Instruction
+	Edges        []Edge
+	// Subroutine is the entry of the subroutine the block is drawn in.
+	// Blocks shared by several subroutines belong to the first one in Graph.Subroutines.
+	Subroutine uint16
+}
+
+// Last returns the last instruction of the block, the one that decides where the flow goes.
+func (b *Block) Last() disasm.Instruction {
+	return b.Instructions[len(b.Instructions)-1]
+}
+
+// Subroutine is the set of blocks reachable from an entry point without following calls.
+type Subroutine struct {
+	Entry uint16
+	// Blocks holds the start of the reachable blocks, sorted.
+	Blocks []uint16
+	// Calls holds the entries of the subroutines called, sorted.
+	Calls []uint16
+	// Returns is true if any of the blocks ends with 00EE.
+	Returns bool
+}
+
+// Region is a run of bytes that are all code or all data.
+type Region struct {
+	// Start and End delimit the region, End excluded.
+	Start, End uint16
+	Code       bool
+}
+
+// Graph is the control-flow graph of a program.
+type Graph struct {
+	Program *disasm.Program
+	// Blocks holds the blocks by start address.
+	Blocks map[uint16]*Block
+	// Subroutines holds the subroutines sorted by entry, the first being the entry point of the program.
+	Subroutines []*Subroutine
+	// Regions covers the whole program, in order.
+	Regions []Region
+}
+
+// builder holds the state of the walk over the program.
+type builder struct {
+	p *disasm.Program
+	// code holds the instructions reached, by address.
+	code map[uint16]disasm.Instruction
+	// owner holds the address of the instruction including every byte of the program.
+	owner map[uint16]uint16
+	// leaders holds the addresses where a block must start.
+	leaders map[uint16]bool
+	// tables holds the entries of the jump tables, by address of the BNNN instruction.
+	tables map[uint16][]uint16
+	calls  map[uint16]bool
+}
+
+// Build recovers the control-flow graph of a program loaded at origin, starting execution from its first byte.
+func Build(rom []byte, origin uint16) *Graph {
+	b := &builder{
+		p:       disasm.Disassemble(rom, origin),
+		code:    make(map[uint16]disasm.Instruction),
+		owner:   make(map[uint16]uint16),
+		leaders: map[uint16]bool{origin: true},
+		tables:  make(map[uint16][]uint16),
+		calls:   make(map[uint16]bool),
+	}
+	b.walk(origin)
+
+	g := &Graph{Program: b.p, Blocks: make(map[uint16]*Block)}
+	g.buildBlocks(b)
+	g.buildSubroutines(origin, b.calls)
+	g.buildRegions(b)
+
+	return g
+}
+
+// walk records every instruction reachable from entry, along with the leaders of the blocks.
+func (b *builder) walk(entry uint16) {
+	pending := []uint16{entry}
+
+	for len(pending) > 0 {
+		addr := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if _, ok := b.code[addr]; ok {
+			continue
+		}
+
+		in, ok := b.p.Decode(addr)
+		if !ok || !b.claim(in) {
+			continue
+		}
+		b.code[addr] = in
+
+		successors := b.successors(in)
+		if in.Op.EndsBlock() {
+			for _, s := range successors {
+				b.leaders[s] = true
+			}
+		}
+		if in.Op == emu.Op2NNN {
+			b.calls[in.NNN] = true
+		}
+
+		pending = append(pending, successors...)
+	}
+}
+
+// claim marks the bytes of an instruction as code, failing if any of them already belongs
+// to another instruction, as happens when jumping in the middle of one.
+func (b *builder) claim(in disasm.Instruction) bool {
+	for i := uint16(0); i < in.Size(); i++ {
+		if _, ok := b.owner[in.Addr+i]; ok {
+			return false
+		}
+	}
+
+	for i := uint16(0); i < in.Size(); i++ {
+		b.owner[in.Addr+i] = in.Addr
+	}
+
+	return true
+}
+
+// successors returns the addresses that can be executed after the instruction,
+// including the entries of the jump table of BNNN.
+func (b *builder) successors(in disasm.Instruction) []uint16 {
+	if in.Op != emu.OpBNNN {
+		return b.p.Successors(in)
+	}
+
+	entries := b.table(in.NNN)
+	b.tables[in.Addr] = entries
+
+	return entries
+}
+
+// table returns the targets of the jump table at addr, a run of 1NNN instructions
+// indexed by the register added to NNN. If there is no such run, addr is assumed to be
+// the only target.
+func (b *builder) table(addr uint16) []uint16 {
+	var entries []uint16
+
+	for i := uint16(0); i < maxTableEntries; i++ {
+		in, ok := b.p.Decode(addr + 2*i)
+		if !ok || in.Op != emu.Op1NNN {
+			break
+		}
+		entries = append(entries, in.Addr)
+	}
+
+	if len(entries) == 0 {
+		return []uint16{addr}
+	}
+
+	return entries
+}
+
+// buildBlocks splits the instructions reached into blocks and links them.
+func (g *Graph) buildBlocks(b *builder) {
+	for addr := range b.leaders {
+		if _, ok := b.code[addr]; !ok {
+			continue
+		}
+
+		block := &Block{Start: addr}
+		for {
+			in := b.code[addr]
+			block.Instructions = append(block.Instructions, in)
+			addr += in.Size()
+
+			if _, ok := b.code[addr]; !ok || in.Op.EndsBlock() || b.leaders[addr] {
+				break
+			}
+		}
+		block.End = addr
+		g.Blocks[block.Start] = block
+	}
+
+	for _, block := range g.Blocks {
+		last := block.Last()
+		next := last.Addr + last.Size()
+
+		switch {
+		case last.Op.IsSkip():
+			successors := g.Program.Successors(last)
+			g.link(block, successors[0], Fallthrough)
+			g.link(block, successors[1], Skip)
+		case last.Op == emu.Op1NNN:
+			g.link(block, last.NNN, Jump)
+		case last.Op == emu.Op2NNN:
+			g.link(block, last.NNN, Call)
+			g.link(block, next, Fallthrough)
+		case last.Op == emu.OpBNNN:
+			for _, entry := range b.tables[last.Addr] {
+				g.link(block, entry, Table)
+			}
+		case last.Op.EndsBlock():
+			// returns and exit
+		default:
+			g.link(block, next, Fallthrough)
+		}
+	}
+}
+
+// link adds an edge from block to the block starting at to, if there is one:
+// targets outside the program or holding no valid instruction are dropped.
+func (g *Graph) link(block *Block, to uint16, kind EdgeKind) {
+	if _, ok := g.Blocks[to]; ok {
+		block.Edges = append(block.Edges, Edge{to, kind})
+	}
+}
+
+// buildSubroutines collects the blocks reachable from the entry point and from every call target.
+func (g *Graph) buildSubroutines(origin uint16, calls map[uint16]bool) {
+	var entries []uint16
+	for entry := range calls {
+		if entry != origin {
+			entries = append(entries, entry)
+		}
+	}
+	sortAddresses(entries)
+	// the entry point is the first subroutine, whatever its address
+	entries = append([]uint16{origin}, entries...)
+
+	owned := make(map[uint16]bool)
+	for _, entry := range entries {
+		if _, ok := g.Blocks[entry]; !ok {
+			continue
+		}
+
+		sub := &Subroutine{Entry: entry}
+		seen := map[uint16]bool{entry: true}
+		called := make(map[uint16]bool)
+		pending := []uint16{entry}
+
+		for len(pending) > 0 {
+			block := g.Blocks[pending[len(pending)-1]]
+			pending = pending[:len(pending)-1]
+
+			sub.Blocks = append(sub.Blocks, block.Start)
+			if !owned[block.Start] {
+				owned[block.Start] = true
+				block.Subroutine = entry
+			}
+			if block.Last().Op == emu.Op00EE {
+				sub.Returns = true
+			}
+
+			for _, e := range block.Edges {
+				if e.Kind == Call {
+					called[e.To] = true
+				} else if !seen[e.To] {
+					seen[e.To] = true
+					pending = append(pending, e.To)
+				}
+			}
+		}
+
+		for callee := range called {
+			sub.Calls = append(sub.Calls, callee)
+		}
+		sortAddresses(sub.Blocks)
+		sortAddresses(sub.Calls)
+		g.Subroutines = append(g.Subroutines, sub)
+	}
+}
+
+// buildRegions splits the program into runs of code and data.
+func (g *Graph) buildRegions(b *builder) {
+	p := g.Program
+
+	for i := range p.ROM {
+		addr := p.Origin + uint16(i)
+		_, code := b.owner[addr]
+
+		if n := len(g.Regions); n > 0 && g.Regions[n-1].Code == code {
+			g.Regions[n-1].End = addr + 1
+			continue
+		}
+		g.Regions = append(g.Regions, Region{addr, addr + 1, code})
+	}
+}
+
+// SortedBlocks returns the blocks sorted by address.
+func (g *Graph) SortedBlocks() []*Block {
+	blocks := make([]*Block, 0, len(g.Blocks))
+	for _, block := range g.Blocks {
+		blocks = append(blocks, block)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Start < blocks[j].Start })
+
+	return blocks
+}
+
+func sortAddresses(addrs []uint16) {
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+}
@@ -0,0 +1,223 @@
+package cfg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/valep27/GChip8/src/disasm"
+)
+
+// program calls a subroutine, then picks an entry of a jump table.
+var program = []byte{
+	0x22, 0x0C, // 200: call 20C
+	0x30, 0x01, // 202: if v0 == 1 skip
+	0x12, 0x08, // 204: jump 208
+	0xB2, 0x10, // 206: jump table at 210
+	0x12, 0x08, // 208: loop forever
+	0xFF, 0xFF, // 20A: data
+	0x60, 0x01, // 20C: v0 := 1
+	0x00, 0xEE, // 20E: return
+	0x12, 0x18, // 210: table entry 0
+	0x12, 0x1A, // 212: table entry 1
+	0x00, 0xE0, // 214: end of the table
+	0xFF, 0xFF, // 216: data
+	0x00, 0xFD, // 218: exit
+	0x12, 0x08, // 21A: jump 208
+}
+
+func TestBlocks(t *testing.T) {
+	g := Build(program, disasm.Origin)
+
+	want := map[uint16]struct {
+		end   uint16
+		edges []Edge
+	}{
+		0x200: {0x202, []Edge{{0x20C, Call}, {0x202, Fallthrough}}},
+		0x202: {0x204, []Edge{{0x204, Fallthrough}, {0x206, Skip}}},
+		0x204: {0x206, []Edge{{0x208, Jump}}},
+		0x206: {0x208, []Edge{{0x210, Table}, {0x212, Table}}},
+		0x208: {0x20A, []Edge{{0x208, Jump}}},
+		0x20C: {0x210, nil},
+		0x210: {0x212, []Edge{{0x218, Jump}}},
+		0x212: {0x214, []Edge{{0x21A, Jump}}},
+		0x218: {0x21A, nil},
+		0x21A: {0x21C, []Edge{{0x208, Jump}}},
+	}
+
+	if len(g.Blocks) != len(want) {
+		t.Errorf("got %d blocks, want %d", len(g.Blocks), len(want))
+	}
+	for start, w := range want {
+		b, ok := g.Blocks[start]
+		if !ok {
+			t.Errorf("no block at %#x", start)
+			continue
+		}
+		if b.End != w.end {
+			t.Errorf("block %#x ends at %#x, want %#x", start, b.End, w.end)
+		}
+		if !reflect.DeepEqual(b.Edges, w.edges) {
+			t.Errorf("edges of block %#x = %v, want %v", start, b.Edges, w.edges)
+		}
+	}
+}
+
+func TestSubroutines(t *testing.T) {
+	g := Build(program, disasm.Origin)
+
+	want := []*Subroutine{
+		{Entry: 0x200, Blocks: []uint16{0x200, 0x202, 0x204, 0x206, 0x208, 0x210, 0x212, 0x218, 0x21A}, Calls: []uint16{0x20C}},
+		{Entry: 0x20C, Blocks: []uint16{0x20C}, Returns: true},
+	}
+
+	if !reflect.DeepEqual(g.Subroutines, want) {
+		for _, sub := range g.Subroutines {
+			t.Logf("%+v", *sub)
+		}
+		t.Errorf("wrong subroutines")
+	}
+	if g.Blocks[0x20C].Subroutine != 0x20C || g.Blocks[0x21A].Subroutine != 0x200 {
+		t.Errorf("wrong owner of the blocks")
+	}
+	if g.Name(0x200) != "main" || g.Name(0x20C) != "sub20C" {
+		t.Errorf("names = %s, %s", g.Name(0x200), g.Name(0x20C))
+	}
+}
+
+func TestRegions(t *testing.T) {
+	g := Build(program, disasm.Origin)
+
+	want := []Region{
+		{0x200, 0x20A, true},
+		{0x20A, 0x20C, false},
+		{0x20C, 0x214, true},
+		{0x214, 0x218, false},
+		{0x218, 0x21C, true},
+	}
+
+	if !reflect.DeepEqual(g.Regions, want) {
+		t.Errorf("regions = %v, want %v", g.Regions, want)
+	}
+}
+
+func TestJumpTables(t *testing.T) {
+	tests := []struct {
+		name    string
+		rom     []byte
+		targets []uint16
+	}{
+		{"no jumps", []byte{0xB2, 0x02, 0x00, 0xFD}, []uint16{0x202}},
+		{"table at the end", []byte{0xB2, 0x02, 0x12, 0x00, 0x12, 0x02}, []uint16{0x202, 0x204}},
+		{"outside the program", []byte{0xB3, 0x00}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := Build(tt.rom, disasm.Origin)
+
+			var targets []uint16
+			for _, e := range g.Blocks[0x200].Edges {
+				if e.Kind != Table {
+					t.Errorf("edge %v is not a table entry", e)
+				}
+				targets = append(targets, e.To)
+			}
+			if !reflect.DeepEqual(targets, tt.targets) {
+				t.Errorf("targets = %v, want %v", targets, tt.targets)
+			}
+		})
+	}
+}
+
+func TestJumpInsideInstruction(t *testing.T) {
+	rom := []byte{
+		0xF0, 0x00, 0x12, 0x02, // 200: i := long 0x1202
+		0x12, 0x02, // 204: jump in the middle of the long load
+	}
+
+	g := Build(rom, disasm.Origin)
+
+	if len(g.Blocks) != 1 {
+		t.Fatalf("got %d blocks, want 1", len(g.Blocks))
+	}
+	if b := g.Blocks[0x200]; b.End != 0x206 || len(b.Edges) != 0 {
+		t.Errorf("block = %+v", *b)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Build(program, disasm.Origin).WriteDOT(&buf, disasm.Cowgod); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, line := range []string{
+		"digraph cfg {",
+		`	subgraph "cluster_200" {`,
+		`		label="main";`,
+		`		b20C [label="20C  LD V0, #01\l20E  RET\l"];`,
+		`	b200 -> b20C [style="dashed"];`,
+		`	b200 -> b202;`,
+		`	b202 -> b206 [color="darkgreen" label="skip"];`,
+		`	b206 -> b210 [color="purple" label="table"];`,
+		`	data [shape="note" label="data 20A-20B  2 bytes\ldata 214-217  4 bytes\l"];`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing line %q in:\n%s", line, out)
+		}
+	}
+}
+
+func TestGames(t *testing.T) {
+	games, err := ioutil.ReadDir("../../games")
+	if err != nil {
+		t.Skip("games directory not available")
+	}
+
+	for _, game := range games {
+		t.Run(game.Name(), func(t *testing.T) {
+			rom, err := ioutil.ReadFile(filepath.Join("../../games", game.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := Build(rom, disasm.Origin)
+
+			for _, b := range g.Blocks {
+				addr := b.Start
+				for _, in := range b.Instructions {
+					if in.Addr != addr {
+						t.Errorf("block %#x: instruction at %#x, want %#x", b.Start, in.Addr, addr)
+					}
+					addr += in.Size()
+				}
+				for _, e := range b.Edges {
+					if _, ok := g.Blocks[e.To]; !ok {
+						t.Errorf("block %#x: edge to %#x, not a block", b.Start, e.To)
+					}
+				}
+			}
+
+			// everything the disassembler finds is code, BNNN tables can only add to it
+			for i, kind := range g.Program.Kinds {
+				addr := disasm.Origin + uint16(i)
+				if kind == disasm.Code && !isCode(g, addr) {
+					t.Errorf("%#x is code for the disassembler", addr)
+				}
+			}
+		})
+	}
+}
+
+func isCode(g *Graph, addr uint16) bool {
+	for _, r := range g.Regions {
+		if addr >= r.Start && addr < r.End {
+			return r.Code
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,104 @@
+package cfg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/valep27/GChip8/src/disasm"
+)
+
+// edgeStyles holds the Graphviz attributes of every kind of edge.
+var edgeStyles = map[EdgeKind]string{
+	Fallthrough: "",
+	Jump:        ` [color="blue"]`,
+	Skip:        ` [color="darkgreen" label="skip"]`,
+	Call:        ` [style="dashed"]`,
+	Table:       ` [color="purple" label="table"]`,
+}
+
+// Name returns the name of the subroutine starting at entry: its label in the
+// disassembly, like main or sub2D4, or its address.
+func (g *Graph) Name(entry uint16) string {
+	if name, ok := g.Program.Labels[entry]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("sub%03X", entry)
+}
+
+// WriteDOT writes the graph in the DOT language of Graphviz.
+//
+// Every subroutine is a cluster of blocks, listing their instructions in the given syntax.
+// Calls are dashed, jumps blue, skips green and the entries of jump tables purple.
+// Data regions are listed in a separate node.
+func (g *Graph) WriteDOT(w io.Writer, syntax disasm.Syntax) error {
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintln(out, "digraph cfg {")
+	fmt.Fprintln(out, `	node [shape="box" fontname="monospace"];`)
+
+	blocks := g.SortedBlocks()
+	for _, sub := range g.Subroutines {
+		fmt.Fprintf(out, "\tsubgraph \"cluster_%03X\" {\n", sub.Entry)
+		fmt.Fprintf(out, "\t\tlabel=%s;\n", quote(g.Name(sub.Entry)))
+
+		for _, block := range blocks {
+			if block.Subroutine == sub.Entry {
+				fmt.Fprintf(out, "\t\t%s [label=%s];\n", node(block.Start), quote(g.blockLabel(block, syntax)))
+			}
+		}
+
+		fmt.Fprintln(out, "\t}")
+	}
+
+	for _, block := range blocks {
+		for _, e := range block.Edges {
+			fmt.Fprintf(out, "\t%s -> %s%s;\n", node(block.Start), node(e.To), edgeStyles[e.Kind])
+		}
+	}
+
+	if data := g.dataLabel(); data != "" {
+		fmt.Fprintf(out, "\tdata [shape=\"note\" label=%s];\n", quote(data))
+	}
+
+	fmt.Fprintln(out, "}")
+
+	return out.Flush()
+}
+
+// blockLabel lists the instructions of a block, one per line with their address.
+func (g *Graph) blockLabel(block *Block, syntax disasm.Syntax) string {
+	var sb strings.Builder
+
+	for _, in := range block.Instructions {
+		fmt.Fprintf(&sb, "%03X  %s\n", in.Addr, g.Program.Format(in, syntax))
+	}
+
+	return sb.String()
+}
+
+// dataLabel lists the data regions, or returns an empty string if there are none.
+func (g *Graph) dataLabel() string {
+	var sb strings.Builder
+
+	for _, r := range g.Regions {
+		if !r.Code {
+			fmt.Fprintf(&sb, "data %03X-%03X  %d bytes\n", r.Start, r.End-1, r.End-r.Start)
+		}
+	}
+
+	return sb.String()
+}
+
+// node returns the identifier of the node of the block starting at addr.
+func node(addr uint16) string {
+	return fmt.Sprintf("b%03X", addr)
+}
+
+// quote returns a DOT string holding s, with lines left aligned.
+func quote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\l`).Replace(s)
+	return `"` + s + `"`
+}
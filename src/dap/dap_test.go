@@ -0,0 +1,370 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valep27/GChip8/src/asm"
+	"github.com/valep27/GChip8/src/debug"
+	"github.com/valep27/GChip8/src/emu"
+)
+
+const program = `: main
+	i := data
+: loop
+	inc
+	jump loop
+: inc
+	v3 += 1
+	save v3
+	return
+: data
+	0 0 0 0
+`
+
+// saveLine is the line of "save v3" in program.
+const saveLine = 8
+
+// message is any message sent by the server.
+type message struct {
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type client struct {
+	t        *testing.T
+	conn     net.Conn
+	seq      int
+	messages chan message
+}
+
+// newSession starts a server for the test program, with the emulator running in the background.
+func newSession(t *testing.T) (*client, *emu.Chip8, chan error) {
+	p, err := asm.Assemble("prog.8o", []byte(program))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c8 := emu.New()
+	if err := c8.LoadBytes(p.Binary); err != nil {
+		t.Fatal(err)
+	}
+
+	dbg := debug.New(c8, ioutil.Discard)
+	dbg.SetBlocking(true)
+	server := NewServer(c8, dbg, p)
+
+	clientConn, serverConn := net.Pipe()
+	go server.Serve(serverConn)
+
+	done := make(chan error, 1)
+	go func() {
+		for {
+			if err := dbg.RunFrame(); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	c := &client{t: t, conn: clientConn, messages: make(chan message, 100)}
+	go func() {
+		r := bufio.NewReader(clientConn)
+		for {
+			body, err := readMessage(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var m message
+			json.Unmarshal(body, &m)
+			c.messages <- m
+		}
+	}()
+
+	return c, c8, done
+}
+
+func (c *client) next() message {
+	c.t.Helper()
+
+	select {
+	case m, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("connection closed")
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timeout waiting for a message")
+	}
+
+	return message{}
+}
+
+// request sends a request and returns the body of its response, decoded in body if not nil.
+// Events received in the meantime are dropped.
+func (c *client) request(command string, args interface{}, body interface{}) message {
+	c.t.Helper()
+
+	m := c.send(command, args)
+	if !m.Success {
+		c.t.Fatalf("%s failed: %s", command, m.Message)
+	}
+	if body != nil {
+		if err := json.Unmarshal(m.Body, body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	return m
+}
+
+// send sends a request and returns its response, whether it succeeded or not.
+func (c *client) send(command string, args interface{}) message {
+	c.t.Helper()
+
+	c.seq++
+	if err := writeMessage(c.conn, map[string]interface{}{
+		"seq": c.seq, "type": "request", "command": command, "arguments": args,
+	}); err != nil {
+		c.t.Fatal(err)
+	}
+
+	for {
+		if m := c.next(); m.Type == "response" && m.RequestSeq == c.seq {
+			return m
+		}
+	}
+}
+
+// waitEvent returns the body of the next event with the given name.
+func (c *client) waitEvent(name string) json.RawMessage {
+	c.t.Helper()
+
+	for {
+		if m := c.next(); m.Type == "event" && m.Event == name {
+			return m.Body
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	c, _, done := newSession(t)
+
+	c.request("initialize", map[string]string{"adapterID": "gchip8"}, nil)
+	c.waitEvent("initialized")
+	c.request("launch", map[string]bool{"stopOnEntry": false}, nil)
+
+	var bps struct {
+		Breakpoints []breakpoint `json:"breakpoints"`
+	}
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": "/somewhere/prog.8o"},
+		"breakpoints": []map[string]int{{"line": saveLine}, {"line": 1}},
+	}, &bps)
+
+	if len(bps.Breakpoints) != 2 || !bps.Breakpoints[0].Verified || bps.Breakpoints[1].Verified {
+		t.Fatalf("breakpoints = %+v, want the first one verified", bps.Breakpoints)
+	}
+	if bps.Breakpoints[0].InstructionReference != "0x208" {
+		t.Errorf("breakpoint at %s, want 0x208", bps.Breakpoints[0].InstructionReference)
+	}
+
+	c.request("configurationDone", nil, nil)
+
+	var stopped stoppedEvent
+	json.Unmarshal(c.waitEvent("stopped"), &stopped)
+	if stopped.Reason != "breakpoint" {
+		t.Errorf("stopped for %q, want breakpoint", stopped.Reason)
+	}
+
+	var trace struct {
+		StackFrames []stackFrame `json:"stackFrames"`
+		TotalFrames int          `json:"totalFrames"`
+	}
+	c.request("stackTrace", map[string]int{"threadId": threadID}, &trace)
+
+	if trace.TotalFrames != 2 {
+		t.Fatalf("stack frames = %+v, want 2", trace.StackFrames)
+	}
+	top, caller := trace.StackFrames[0], trace.StackFrames[1]
+	if top.Name != "inc" || top.Line != saveLine || top.Source.Name != "prog.8o" {
+		t.Errorf("top frame = %+v, want inc at line %d", top, saveLine)
+	}
+	if caller.Name != "loop" || caller.Line != 4 || caller.InstructionPointerReference != "0x202" {
+		t.Errorf("caller frame = %+v, want the call in loop at line 4", caller)
+	}
+
+	var vars struct {
+		Variables []variable `json:"variables"`
+	}
+	c.request("variables", map[string]int{"variablesReference": registersReference}, &vars)
+
+	values := make(map[string]variable)
+	for _, v := range vars.Variables {
+		values[v.Name] = v
+	}
+	if values["V3"].Value != "0x01" || values["PC"].Value != "0x208" || values["SP"].Value != "1" {
+		t.Errorf("variables = %+v", vars.Variables)
+	}
+
+	// run the save instruction, then read what it wrote
+	c.request("next", nil, nil)
+	c.waitEvent("stopped")
+
+	var mem readMemoryResponse
+	c.request("readMemory", map[string]interface{}{
+		"memoryReference": values["I"].MemoryReference, "offset": 3, "count": 1,
+	}, &mem)
+	if data, _ := base64.StdEncoding.DecodeString(mem.Data); len(data) != 1 || data[0] != 1 {
+		t.Errorf("readMemory() = %+v, want 01", mem)
+	}
+
+	c.request("stepOut", nil, nil)
+	json.Unmarshal(c.waitEvent("stopped"), &stopped)
+	c.request("stackTrace", map[string]int{"threadId": threadID}, &trace)
+	if stopped.Reason != "step" || trace.TotalFrames != 1 || trace.StackFrames[0].InstructionPointerReference != "0x204" {
+		t.Errorf("after stepOut, stopped for %q at %+v", stopped.Reason, trace.StackFrames)
+	}
+
+	var dis struct {
+		Instructions []disassembledInstruction `json:"instructions"`
+	}
+	c.request("disassemble", map[string]interface{}{
+		"memoryReference": "0x200", "instructionOffset": -1, "instructionCount": 3,
+	}, &dis)
+	if len(dis.Instructions) != 3 || dis.Instructions[1].Instruction != "i := data" || dis.Instructions[1].Symbol != "main" {
+		t.Errorf("disassemble() = %+v", dis.Instructions)
+	}
+
+	c.request("disconnect", nil, nil)
+	select {
+	case err := <-done:
+		if err != debug.ErrQuit {
+			t.Errorf("RunFrame() error = %v, want ErrQuit", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the debugger did not quit")
+	}
+}
+
+func TestInvalidMemoryArguments(t *testing.T) {
+	c, _, _ := newSession(t)
+
+	c.request("initialize", map[string]string{"adapterID": "gchip8"}, nil)
+	c.waitEvent("initialized")
+	c.request("launch", map[string]bool{"stopOnEntry": true}, nil)
+	c.request("configurationDone", nil, nil)
+	c.waitEvent("stopped")
+
+	tests := []struct {
+		command string
+		args    map[string]interface{}
+	}{
+		{"readMemory", map[string]interface{}{"memoryReference": "0x200", "count": -1}},
+		{"disassemble", map[string]interface{}{"memoryReference": "0x200", "instructionCount": -1}},
+	}
+	for _, tt := range tests {
+		if m := c.send(tt.command, tt.args); m.Success {
+			t.Errorf("%s %v succeeded, want an error", tt.command, tt.args)
+		}
+	}
+
+	// large counts are capped to the address space
+	var mem readMemoryResponse
+	c.request("readMemory", map[string]interface{}{"memoryReference": "0x0", "count": 1 << 40}, &mem)
+	if data, _ := base64.StdEncoding.DecodeString(mem.Data); len(data) != addressSpace {
+		t.Errorf("readMemory() returned %d bytes, want %d", len(data), addressSpace)
+	}
+
+	var dis struct {
+		Instructions []disassembledInstruction `json:"instructions"`
+	}
+	c.request("disassemble", map[string]interface{}{"memoryReference": "0x200", "instructionCount": 1 << 40}, &dis)
+	if len(dis.Instructions) != addressSpace/2 {
+		t.Errorf("disassemble() returned %d instructions, want %d", len(dis.Instructions), addressSpace/2)
+	}
+
+	c.request("disconnect", nil, nil)
+}
+
+func TestOversizedMessage(t *testing.T) {
+	c8 := emu.New()
+	dbg := debug.New(c8, ioutil.Discard)
+	server := NewServer(c8, dbg, nil)
+
+	clientConn, serverConn := net.Pipe()
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(serverConn) }()
+	go func() {
+		for dbg.RunFrame() == nil {
+		}
+	}()
+
+	go clientConn.Write([]byte("Content-Length: 4611686018427387904\r\n\r\n"))
+
+	select {
+	case err := <-served:
+		if err == nil || !strings.Contains(err.Error(), "invalid Content-Length") {
+			t.Errorf("Serve() error = %v, want an invalid Content-Length", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() did not return")
+	}
+}
+
+func TestPauseAndInstructionBreakpoints(t *testing.T) {
+	c, c8, _ := newSession(t)
+
+	c.request("initialize", nil, nil)
+	c.request("launch", nil, nil)
+	c.request("configurationDone", nil, nil)
+
+	c.request("pause", map[string]int{"threadId": threadID}, nil)
+	var stopped stoppedEvent
+	json.Unmarshal(c.waitEvent("stopped"), &stopped)
+	if stopped.Reason != "pause" {
+		t.Errorf("stopped for %q, want pause", stopped.Reason)
+	}
+
+	var bps struct {
+		Breakpoints []breakpoint `json:"breakpoints"`
+	}
+	c.request("setInstructionBreakpoints", map[string]interface{}{
+		"breakpoints": []map[string]interface{}{{"instructionReference": "0x208", "condition": "V3 == 0x20"}},
+	}, &bps)
+	if len(bps.Breakpoints) != 1 || !bps.Breakpoints[0].Verified {
+		t.Fatalf("breakpoints = %+v", bps.Breakpoints)
+	}
+
+	c.request("continue", map[string]int{"threadId": threadID}, nil)
+	json.Unmarshal(c.waitEvent("stopped"), &stopped)
+	if stopped.Reason != "instruction breakpoint" {
+		t.Errorf("stopped for %q, want instruction breakpoint", stopped.Reason)
+	}
+
+	var trace struct {
+		StackFrames []stackFrame `json:"stackFrames"`
+	}
+	c.request("stackTrace", map[string]int{"threadId": threadID}, &trace)
+	if trace.StackFrames[0].InstructionPointerReference != "0x208" {
+		t.Errorf("stopped at %s, want 0x208", trace.StackFrames[0].InstructionPointerReference)
+	}
+
+	// the registers are read on the emulator goroutine through the server, c8 is only
+	// safe to use here because the program is paused
+	if v := c8.Registers().V[3]; v != 0x20 {
+		t.Errorf("V3 = %#x, want 0x20", v)
+	}
+
+	c.request("disconnect", nil, nil)
+}
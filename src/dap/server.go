@@ -0,0 +1,600 @@
+// Package dap exposes the debugger through the Debug Adapter Protocol, so that editors
+// such as VS Code can debug CHIP-8 programs.
+//
+// The emulator is seen as a single thread whose stack frames are the active subroutine
+// calls, with a scope holding the registers. With the symbol map written by the asm command,
+// breakpoints can be set on source lines and frames point to the source; without it,
+// clients can still use instruction breakpoints, the disassembly and the memory view.
+package dap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/valep27/GChip8/src/asm"
+	"github.com/valep27/GChip8/src/debug"
+	"github.com/valep27/GChip8/src/disasm"
+	"github.com/valep27/GChip8/src/emu"
+)
+
+// threadID is the id of the only thread, the CHIP-8 CPU.
+const threadID = 1
+
+// registersReference is the variables reference of the registers scope.
+const registersReference = 1
+
+// addressSpace is the size of the memory, the most that readMemory and disassemble return.
+const addressSpace = 0x10000
+
+// Server answers the requests of a client, controlling the emulator through a debugger.
+type Server struct {
+	c8  *emu.Chip8
+	dbg *debug.Debugger
+
+	// symbols and lines come from the symbol map, lines being sorted by address.
+	symbols map[string]uint16
+	lines   []asm.SourceLine
+
+	out io.Writer
+	mu  sync.Mutex
+	seq int
+
+	stopOnEntry bool
+	// sourceBreakpoints holds the debugger breakpoint ids set for every source path,
+	// instructionBreakpoints the ones set on addresses.
+	sourceBreakpoints      map[string][]int
+	instructionBreakpoints []int
+}
+
+// NewServer returns a server for a debugger attached to c8. The symbol map can be nil.
+func NewServer(c8 *emu.Chip8, dbg *debug.Debugger, symbols *asm.Program) *Server {
+	s := &Server{
+		c8:                c8,
+		dbg:               dbg,
+		sourceBreakpoints: make(map[string][]int),
+	}
+
+	if symbols != nil {
+		s.symbols = symbols.Symbols
+		s.lines = append(s.lines, symbols.Lines...)
+		sort.SliceStable(s.lines, func(i, j int) bool {
+			return s.lines[i].Addr < s.lines[j].Addr
+		})
+		dbg.SetSymbols(symbols.Symbols)
+	}
+
+	dbg.OnStop(s.stopped)
+	return s
+}
+
+// Serve reads requests from rw and answers them, until the client disconnects.
+// Requests are handled on the goroutine running the debugger frames, through Debugger.Do.
+// When the connection ends, the debugger is quit.
+func (s *Server) Serve(rw io.ReadWriter) error {
+	s.out = rw
+	r := bufio.NewReader(rw)
+
+	for {
+		body, err := readMessage(r)
+		if err != nil {
+			s.dbg.Do(s.dbg.Quit)
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.dbg.Do(s.dbg.Quit)
+			return fmt.Errorf("invalid message: %s", err)
+		}
+
+		if req.Type != "request" {
+			continue
+		}
+
+		s.dbg.Do(func() { s.handle(&req) })
+
+		// the debugger is quit by the handler
+		if req.Command == "disconnect" || req.Command == "terminate" {
+			return nil
+		}
+	}
+}
+
+// send writes a message with the next sequence number.
+func (s *Server) send(message interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	switch m := message.(type) {
+	case *response:
+		m.Seq = s.seq
+	case *event:
+		m.Seq = s.seq
+	}
+
+	// a broken connection ends Serve through the reader
+	writeMessage(s.out, message)
+}
+
+func (s *Server) respond(req *request, body interface{}) {
+	s.send(&response{Type: "response", RequestSeq: req.Seq, Success: true, Command: req.Command, Body: body})
+}
+
+func (s *Server) fail(req *request, err error) {
+	s.send(&response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Message: err.Error()})
+}
+
+func (s *Server) event(name string, body interface{}) {
+	s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+// handle answers a request. It runs on the debugger goroutine.
+func (s *Server) handle(req *request) {
+	var body interface{}
+	var err error
+
+	switch req.Command {
+	case "initialize":
+		s.respond(req, capabilities{true, true, true, true, true, true})
+		s.event("initialized", nil)
+		return
+	case "launch", "attach":
+		var args launchArguments
+		err = decode(req, &args)
+		s.stopOnEntry = args.StopOnEntry
+	case "configurationDone":
+		s.respond(req, nil)
+		if s.stopOnEntry {
+			s.event("stopped", stoppedEvent{Reason: "entry", ThreadID: threadID, AllThreadsStopped: true})
+		} else {
+			s.dbg.Continue()
+		}
+		return
+	case "setBreakpoints":
+		body, err = s.setBreakpoints(req)
+	case "setInstructionBreakpoints":
+		body, err = s.setInstructionBreakpoints(req)
+	case "setExceptionBreakpoints":
+		body = map[string]interface{}{"breakpoints": []breakpoint{}}
+	case "threads":
+		body = map[string]interface{}{"threads": []thread{{threadID, "CHIP-8"}}}
+	case "stackTrace":
+		body, err = s.stackTrace(req)
+	case "scopes":
+		body = map[string]interface{}{"scopes": []scope{{"Registers", registersReference, false}}}
+	case "variables":
+		body, err = s.variables(req)
+	case "readMemory":
+		body, err = s.readMemory(req)
+	case "disassemble":
+		body, err = s.disassemble(req)
+	case "continue":
+		s.dbg.Continue()
+		body = map[string]interface{}{"allThreadsContinued": true}
+	case "next":
+		s.dbg.Next()
+	case "stepIn":
+		s.dbg.Step(1)
+	case "stepOut":
+		err = s.dbg.Finish()
+	case "pause":
+		if s.dbg.Paused() {
+			s.respond(req, nil)
+			s.event("stopped", stoppedEvent{Reason: "pause", ThreadID: threadID, AllThreadsStopped: true})
+			return
+		}
+		// the stopped event is sent by the debugger
+		s.respond(req, nil)
+		s.dbg.Pause()
+		return
+	case "disconnect", "terminate":
+		s.respond(req, nil)
+		s.event("terminated", nil)
+		s.dbg.Quit()
+		return
+	default:
+		err = fmt.Errorf("unsupported request '%s'", req.Command)
+	}
+
+	if err != nil {
+		s.fail(req, err)
+		return
+	}
+
+	s.respond(req, body)
+}
+
+// decode unmarshals the arguments of a request.
+func decode(req *request, args interface{}) error {
+	if len(req.Arguments) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(req.Arguments, args); err != nil {
+		return fmt.Errorf("invalid arguments: %s", err)
+	}
+
+	return nil
+}
+
+// stopped reports the stops of the debugger to the client.
+func (s *Server) stopped(stop debug.Stop) {
+	if stop.Kind == debug.StopExit {
+		s.event("exited", map[string]int{"exitCode": 0})
+		s.event("terminated", nil)
+		return
+	}
+
+	e := stoppedEvent{Description: stop.Description, ThreadID: threadID, AllThreadsStopped: true}
+
+	switch stop.Kind {
+	case debug.StopPause:
+		e.Reason = "pause"
+	case debug.StopStep:
+		e.Reason = "step"
+	case debug.StopBreakpoint:
+		e.Reason = "breakpoint"
+		e.HitBreakpointIds = []int{stop.Breakpoint}
+		if s.isInstructionBreakpoint(stop.Breakpoint) {
+			e.Reason = "instruction breakpoint"
+		}
+	case debug.StopWatchpoint:
+		e.Reason = "data breakpoint"
+		e.HitBreakpointIds = []int{stop.Breakpoint}
+	case debug.StopError:
+		e.Reason = "exception"
+	}
+
+	s.event("stopped", e)
+}
+
+func (s *Server) isInstructionBreakpoint(id int) bool {
+	for _, b := range s.instructionBreakpoints {
+		if b == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setBreakpoints replaces the breakpoints of a source file, set on the first address of every line.
+func (s *Server) setBreakpoints(req *request) (interface{}, error) {
+	var args setBreakpointsArguments
+	if err := decode(req, &args); err != nil {
+		return nil, err
+	}
+
+	path := args.Source.Path
+	for _, id := range s.sourceBreakpoints[path] {
+		s.dbg.Delete(id)
+	}
+	s.sourceBreakpoints[path] = nil
+
+	result := make([]breakpoint, 0, len(args.Breakpoints))
+
+	for _, sb := range args.Breakpoints {
+		b := breakpoint{Line: sb.Line, Source: &args.Source}
+
+		addr, ok := s.addressOf(path, sb.Line)
+		switch {
+		case s.lines == nil:
+			b.Message = "no symbol map, start the emulator with --symbols"
+		case !ok:
+			b.Message = "no code on this line"
+		default:
+			id, err := s.dbg.SetBreakpoint(addr, sb.Condition)
+			if err != nil {
+				b.Message = err.Error()
+				break
+			}
+			b.ID, b.Verified = id, true
+			b.InstructionReference = reference(addr)
+			s.sourceBreakpoints[path] = append(s.sourceBreakpoints[path], id)
+		}
+
+		result = append(result, b)
+	}
+
+	return map[string]interface{}{"breakpoints": result}, nil
+}
+
+// setInstructionBreakpoints replaces the breakpoints set on addresses.
+func (s *Server) setInstructionBreakpoints(req *request) (interface{}, error) {
+	var args setInstructionBreakpointsArguments
+	if err := decode(req, &args); err != nil {
+		return nil, err
+	}
+
+	for _, id := range s.instructionBreakpoints {
+		s.dbg.Delete(id)
+	}
+	s.instructionBreakpoints = nil
+
+	result := make([]breakpoint, 0, len(args.Breakpoints))
+
+	for _, ib := range args.Breakpoints {
+		b := breakpoint{InstructionReference: ib.InstructionReference}
+
+		addr, err := parseReference(ib.InstructionReference, ib.Offset)
+		if err == nil {
+			b.ID, err = s.dbg.SetBreakpoint(addr, ib.Condition)
+		}
+
+		if err != nil {
+			b.Message = err.Error()
+		} else {
+			b.Verified = true
+			s.instructionBreakpoints = append(s.instructionBreakpoints, b.ID)
+		}
+
+		result = append(result, b)
+	}
+
+	return map[string]interface{}{"breakpoints": result}, nil
+}
+
+// stackTrace returns the current location, then the call site of every active subroutine.
+func (s *Server) stackTrace(req *request) (interface{}, error) {
+	var args stackTraceArguments
+	if err := decode(req, &args); err != nil {
+		return nil, err
+	}
+
+	r := s.c8.Registers()
+	addrs := []uint16{r.PC}
+	for i := len(r.Stack) - 1; i >= 0; i-- {
+		addrs = append(addrs, r.Stack[i])
+	}
+
+	frames := make([]stackFrame, 0, len(addrs))
+	for i, addr := range addrs {
+		frame := stackFrame{
+			ID:                          i,
+			Name:                        s.functionName(addr),
+			InstructionPointerReference: reference(addr),
+		}
+
+		if line, ok := s.lineOf(addr); ok {
+			frame.Source = sourceOf(line.File)
+			frame.Line, frame.Column = line.Line, line.Col
+		}
+
+		frames = append(frames, frame)
+	}
+
+	total := len(frames)
+	if args.StartFrame < len(frames) {
+		frames = frames[args.StartFrame:]
+	} else {
+		frames = nil
+	}
+	if args.Levels > 0 && args.Levels < len(frames) {
+		frames = frames[:args.Levels]
+	}
+
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": total}, nil
+}
+
+// variables returns the registers, the only variables there are.
+func (s *Server) variables(req *request) (interface{}, error) {
+	var args variablesArguments
+	if err := decode(req, &args); err != nil {
+		return nil, err
+	}
+
+	if args.VariablesReference != registersReference {
+		return map[string]interface{}{"variables": []variable{}}, nil
+	}
+
+	r := s.c8.Registers()
+	vars := make([]variable, 0, len(r.V)+5)
+
+	for i, v := range r.V {
+		vars = append(vars, variable{Name: fmt.Sprintf("V%X", i), Value: fmt.Sprintf("0x%02X", v)})
+	}
+
+	vars = append(vars,
+		variable{Name: "I", Value: fmt.Sprintf("0x%03X", r.I), MemoryReference: reference(r.I)},
+		variable{Name: "PC", Value: fmt.Sprintf("0x%03X", r.PC), MemoryReference: reference(r.PC)},
+		variable{Name: "SP", Value: strconv.Itoa(int(r.SP))},
+		variable{Name: "DT", Value: fmt.Sprintf("0x%02X", r.DelayTimer)},
+		variable{Name: "ST", Value: fmt.Sprintf("0x%02X", r.SoundTimer)},
+	)
+
+	return map[string]interface{}{"variables": vars}, nil
+}
+
+// readMemory returns memory encoded in base64, the bytes past the end of memory being unreadable.
+func (s *Server) readMemory(req *request) (interface{}, error) {
+	var args readMemoryArguments
+	if err := decode(req, &args); err != nil {
+		return nil, err
+	}
+
+	addr, err := parseReference(args.MemoryReference, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.Count < 0 {
+		return nil, fmt.Errorf("invalid count %d", args.Count)
+	}
+	if args.Count > addressSpace {
+		args.Count = addressSpace
+	}
+
+	data := s.c8.ReadMemory(addr, args.Count)
+
+	return readMemoryResponse{
+		Address:         reference(addr),
+		UnreadableBytes: args.Count - len(data),
+		Data:            base64.StdEncoding.EncodeToString(data),
+	}, nil
+}
+
+// disassemble decodes instructions around a memory reference. Instructions are assumed to be
+// two bytes long to move backwards with a negative instruction offset.
+func (s *Server) disassemble(req *request) (interface{}, error) {
+	var args disassembleArguments
+	if err := decode(req, &args); err != nil {
+		return nil, err
+	}
+
+	base, err := parseReference(args.MemoryReference, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.InstructionCount < 0 {
+		return nil, fmt.Errorf("invalid instruction count %d", args.InstructionCount)
+	}
+	if args.InstructionCount > addressSpace/2 {
+		args.InstructionCount = addressSpace / 2
+	}
+
+	start := int(base) + args.InstructionOffset*2
+	result := make([]disassembledInstruction, 0, args.InstructionCount)
+
+	// addresses outside of memory are padded with invalid instructions, as the protocol requires
+	for ; start < 0 && len(result) < args.InstructionCount; start += 2 {
+		result = append(result, invalidInstruction(start))
+	}
+
+	p := &disasm.Program{Origin: uint16(start), Labels: make(map[uint16]string)}
+	if start <= 0xFFFF {
+		p.ROM = s.c8.ReadMemory(uint16(start), args.InstructionCount*4)
+	}
+	for name, addr := range s.symbols {
+		p.Labels[addr] = name
+	}
+
+	for addr := start; len(result) < args.InstructionCount; {
+		if addr-start+2 > len(p.ROM) {
+			result = append(result, invalidInstruction(addr))
+			addr += 2
+			continue
+		}
+
+		raw := p.ROM[addr-start:]
+		size, text := 2, fmt.Sprintf("0x%02X 0x%02X", raw[0], raw[1])
+
+		if in, ok := p.Decode(uint16(addr)); ok {
+			size, text = int(in.Size()), p.Format(in, disasm.Octo)
+		}
+
+		di := disassembledInstruction{
+			Address:          reference(uint16(addr)),
+			InstructionBytes: fmt.Sprintf("% X", raw[:size]),
+			Instruction:      text,
+			Symbol:           p.Labels[uint16(addr)],
+		}
+		if line, ok := s.lineOf(uint16(addr)); ok {
+			di.Location = sourceOf(line.File)
+			di.Line = line.Line
+		}
+
+		result = append(result, di)
+		addr += size
+	}
+
+	return map[string]interface{}{"instructions": result}, nil
+}
+
+func invalidInstruction(addr int) disassembledInstruction {
+	return disassembledInstruction{Address: fmt.Sprintf("0x%X", addr), PresentationHint: "invalid"}
+}
+
+// lineOf returns the source line of the instruction at addr.
+func (s *Server) lineOf(addr uint16) (asm.SourceLine, bool) {
+	i := sort.Search(len(s.lines), func(i int) bool {
+		return s.lines[i].Addr > addr
+	})
+
+	if i == 0 {
+		return asm.SourceLine{}, false
+	}
+
+	return s.lines[i-1], true
+}
+
+// addressOf returns the first address generated by a line of a source file.
+func (s *Server) addressOf(path string, line int) (uint16, bool) {
+	for _, l := range s.lines {
+		if l.Line == line && sameFile(l.File, path) {
+			return l.Addr, true
+		}
+	}
+
+	return 0, false
+}
+
+// functionName returns the closest label before addr, or the address itself.
+func (s *Server) functionName(addr uint16) string {
+	name, best := "", -1
+
+	for label, a := range s.symbols {
+		if a <= addr && (int(a) > best || int(a) == best && label < name) {
+			name, best = label, int(a)
+		}
+	}
+
+	if name == "" {
+		return reference(addr)
+	}
+
+	return name
+}
+
+// sameFile tells whether a file of the symbol map is the path given by the client.
+// The map holds the paths given to the assembler, possibly relative, so base names are compared
+// when the absolute paths differ.
+func sameFile(mapFile, path string) bool {
+	abs, err := filepath.Abs(mapFile)
+	if err == nil && abs == filepath.Clean(path) {
+		return true
+	}
+
+	return filepath.Base(mapFile) == filepath.Base(path)
+}
+
+func sourceOf(file string) *source {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		path = file
+	}
+
+	return &source{Name: filepath.Base(file), Path: path}
+}
+
+// reference formats an address as a memory or instruction reference.
+func reference(addr uint16) string {
+	return fmt.Sprintf("0x%03X", addr)
+}
+
+// parseReference parses a memory or instruction reference, adding a byte offset.
+func parseReference(ref string, offset int) (uint16, error) {
+	value, err := strconv.ParseInt(strings.TrimPrefix(strings.ToLower(ref), "0x"), 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid reference '%s'", ref)
+	}
+
+	addr := int(value) + offset
+	if addr < 0 || addr > 0xFFFF {
+		return 0, fmt.Errorf("address %#x out of range 0 to 0xffff", addr)
+	}
+
+	return uint16(addr), nil
+}
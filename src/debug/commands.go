@@ -0,0 +1,431 @@
+package debug
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/valep27/GChip8/src/disasm"
+)
+
+// help describes the commands understood by Execute.
+const help = `commands:
+  step, s [N]               execute N instructions (default 1)
+  next, n                   execute an instruction, running subroutine calls (2NNN) until they return
+  finish                    run until the current subroutine returns (00EE)
+  continue, c               resume execution
+  pause                     stop execution
+  break, b ADDR [if COND]   stop at an address, optionally only when a condition holds
+  break if COND             stop anywhere when a condition becomes true, e.g. 'break if V3 == 0x10'
+  watch, w ADDR [SIZE] [r|w|rw]
+                            stop before memory is read or written (default rw, size 1)
+  delete, d [ID]            delete a breakpoint or watchpoint, all of them without ID
+  info, i                   list breakpoints and watchpoints
+  regs, r                   show the registers, I and the timers
+  stack, bt                 show the call stack
+  mem, x ADDR [LEN]         dump memory (default 64 bytes)
+  dis, l [ADDR] [N]         disassemble N instructions from ADDR, or around the PC
+  press KEY, release KEY    change the state of a key of the keypad (hex digit)
+  help, h                   show this help
+  quit, q                   quit the emulator
+Numbers are decimal unless prefixed by 0x or #, addresses can also be labels of the symbol map.
+Conditions compare V0-VF, I, PC, SP, DT, ST, memory bytes as [ADDR] and numbers with
+==, !=, <, <=, > or >=. An empty line repeats the last command.`
+
+// Execute runs a debugger command. Stepping and resuming commands only change the state of
+// the debugger: the instructions are executed by the following calls to RunFrame.
+func (d *Debugger) Execute(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case "step", "s":
+		return d.step(args)
+	case "next", "n":
+		d.Next()
+	case "finish":
+		return d.Finish()
+	case "continue", "c":
+		d.Continue()
+	case "pause":
+		d.Pause()
+	case "break", "b":
+		return d.addBreakpoint(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), name)))
+	case "watch", "w":
+		return d.addWatchpoint(args)
+	case "delete", "d":
+		return d.delete(args)
+	case "info", "i":
+		d.info()
+	case "regs", "r":
+		d.printRegisters()
+	case "stack", "bt":
+		d.printStack()
+	case "mem", "x":
+		return d.dump(args)
+	case "dis", "l":
+		return d.list(args)
+	case "press", "release":
+		return d.key(name == "release", args)
+	case "help", "h":
+		fmt.Fprintln(d.out, help)
+	case "quit", "q":
+		d.Quit()
+	default:
+		return fmt.Errorf("unknown command '%s', type 'help' for the list of commands", name)
+	}
+
+	return nil
+}
+
+func (d *Debugger) step(args []string) error {
+	count := 1
+	if len(args) > 0 {
+		n, err := parseNumber(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid number of steps '%s'", args[0])
+		}
+		count = n
+	}
+
+	d.Step(count)
+	return nil
+}
+
+func (d *Debugger) nextID() int {
+	d.lastID++
+	return d.lastID
+}
+
+// addBreakpoint parses "ADDR", "ADDR if COND" or "if COND".
+func (d *Debugger) addBreakpoint(args string) error {
+	addrText, condText := args, ""
+
+	if strings.HasPrefix(args, "if ") {
+		addrText, condText = "", args[3:]
+	} else if i := strings.Index(args, " if "); i >= 0 {
+		addrText, condText = args[:i], args[i+4:]
+	}
+
+	var id int
+	var err error
+
+	switch {
+	case addrText != "":
+		var addr uint16
+		if addr, err = parseAddress(addrText, d.symbols); err != nil {
+			return err
+		}
+		id, err = d.SetBreakpoint(addr, condText)
+	case condText != "":
+		id, err = d.SetConditionBreakpoint(condText)
+	default:
+		return fmt.Errorf("usage: break ADDR [if COND] or break if COND")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(d.out, "breakpoint %d: %s\n", id, d.describeBreakpoint(d.breakpoints[id]))
+	return nil
+}
+
+// SetBreakpoint adds a breakpoint at an address, stopping only when cond holds if it is not empty.
+// It returns the id of the breakpoint.
+func (d *Debugger) SetBreakpoint(addr uint16, cond string) (int, error) {
+	b := &breakpoint{addr: addr}
+
+	if cond != "" {
+		var err error
+		if b.cond, err = parseCondition(cond, d.symbols); err != nil {
+			return 0, err
+		}
+	}
+
+	b.id = d.nextID()
+	d.breakpoints[b.id] = b
+	return b.id, nil
+}
+
+// SetConditionBreakpoint adds a breakpoint that stops at any address, when cond becomes true.
+// It returns the id of the breakpoint.
+func (d *Debugger) SetConditionBreakpoint(cond string) (int, error) {
+	c, err := parseCondition(cond, d.symbols)
+	if err != nil {
+		return 0, err
+	}
+
+	b := &breakpoint{anywhere: true, cond: c, held: c.eval(d.c8)}
+	b.id = d.nextID()
+	d.breakpoints[b.id] = b
+	return b.id, nil
+}
+
+// Delete removes a breakpoint or a watchpoint, returning false if there is none with the id.
+func (d *Debugger) Delete(id int) bool {
+	if _, ok := d.breakpoints[id]; ok {
+		delete(d.breakpoints, id)
+		return true
+	}
+
+	if _, ok := d.watchpoints[id]; ok {
+		delete(d.watchpoints, id)
+		return true
+	}
+
+	return false
+}
+
+func (d *Debugger) describeBreakpoint(b *breakpoint) string {
+	switch {
+	case b.anywhere:
+		return fmt.Sprintf("when %s", b.cond)
+	case b.cond != nil:
+		return fmt.Sprintf("%s if %s", d.addressName(b.addr), b.cond)
+	}
+
+	return d.addressName(b.addr)
+}
+
+// addWatchpoint parses "ADDR [SIZE] [r|w|rw]".
+func (d *Debugger) addWatchpoint(args []string) error {
+	if len(args) == 0 || len(args) > 3 {
+		return fmt.Errorf("usage: watch ADDR [SIZE] [r|w|rw]")
+	}
+
+	addr, err := parseAddress(args[0], d.symbols)
+	if err != nil {
+		return err
+	}
+
+	w := &watchpoint{addr: addr, size: 1, read: true, write: true}
+
+	for _, arg := range args[1:] {
+		switch arg {
+		case "r":
+			w.read, w.write = true, false
+		case "w":
+			w.read, w.write = false, true
+		case "rw":
+			w.read, w.write = true, true
+		default:
+			size, err := parseNumber(arg)
+			if err != nil || size < 1 {
+				return fmt.Errorf("invalid size '%s'", arg)
+			}
+			w.size = size
+		}
+	}
+
+	w.id = d.nextID()
+	d.watchpoints[w.id] = w
+	fmt.Fprintf(d.out, "watchpoint %d: %s\n", w.id, describeWatchpoint(w))
+	return nil
+}
+
+func describeWatchpoint(w *watchpoint) string {
+	mode := "rw"
+	if !w.write {
+		mode = "r"
+	} else if !w.read {
+		mode = "w"
+	}
+
+	return fmt.Sprintf("0x%03X, %d bytes, %s", w.addr, w.size, mode)
+}
+
+func (d *Debugger) delete(args []string) error {
+	if len(args) == 0 {
+		d.breakpoints = make(map[int]*breakpoint)
+		d.watchpoints = make(map[int]*watchpoint)
+		return nil
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid id '%s'", args[0])
+	}
+
+	if !d.Delete(id) {
+		return fmt.Errorf("no breakpoint or watchpoint %d", id)
+	}
+
+	return nil
+}
+
+func (d *Debugger) info() {
+	if len(d.breakpoints) == 0 && len(d.watchpoints) == 0 {
+		fmt.Fprintln(d.out, "no breakpoints or watchpoints")
+	}
+
+	for _, id := range d.breakpointIDs() {
+		fmt.Fprintf(d.out, "breakpoint %d: %s\n", id, d.describeBreakpoint(d.breakpoints[id]))
+	}
+
+	for _, id := range d.watchpointIDs() {
+		fmt.Fprintf(d.out, "watchpoint %d: %s\n", id, describeWatchpoint(d.watchpoints[id]))
+	}
+}
+
+func (d *Debugger) printRegisters() {
+	r := d.c8.Registers()
+
+	for i, v := range r.V {
+		sep := " "
+		if i%8 == 7 {
+			sep = "\n"
+		}
+		fmt.Fprintf(d.out, "V%X=%02X%s", i, v, sep)
+	}
+
+	fmt.Fprintf(d.out, "I=%04X PC=%04X SP=%d DT=%02X ST=%02X\n", r.I, r.PC, r.SP, r.DelayTimer, r.SoundTimer)
+}
+
+// printStack shows the current location, then the return address of every active call.
+func (d *Debugger) printStack() {
+	r := d.c8.Registers()
+
+	fmt.Fprintf(d.out, "#0  %s\n", d.addressName(r.PC))
+	for i := len(r.Stack) - 1; i >= 0; i-- {
+		call := r.Stack[i]
+		fmt.Fprintf(d.out, "#%d  %s, called at 0x%03X\n", len(r.Stack)-i, d.addressName(call+2), call)
+	}
+}
+
+// addressName formats an address, followed by its label if it has one.
+func (d *Debugger) addressName(addr uint16) string {
+	if name, ok := d.labels[addr]; ok {
+		return fmt.Sprintf("0x%03X <%s>", addr, name)
+	}
+
+	return fmt.Sprintf("0x%03X", addr)
+}
+
+// dump prints memory as hex bytes, 16 per line.
+func (d *Debugger) dump(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: mem ADDR [LEN]")
+	}
+
+	addr, err := parseAddress(args[0], d.symbols)
+	if err != nil {
+		return err
+	}
+
+	size := 64
+	if len(args) > 1 {
+		if size, err = parseNumber(args[1]); err != nil || size < 1 {
+			return fmt.Errorf("invalid length '%s'", args[1])
+		}
+	}
+
+	data := d.c8.ReadMemory(addr, size)
+
+	for i := 0; i < len(data); i += 16 {
+		end := i + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		fmt.Fprintf(d.out, "%04X  % X\n", int(addr)+i, data[i:end])
+	}
+
+	return nil
+}
+
+// list disassembles from an address, or from a few instructions before the PC.
+func (d *Debugger) list(args []string) error {
+	pc := d.c8.Registers().PC
+	start, count := pc, 10
+
+	if pc >= programStart+8 {
+		start = pc - 8
+	}
+
+	if len(args) > 0 {
+		addr, err := parseAddress(args[0], d.symbols)
+		if err != nil {
+			return err
+		}
+		start = addr
+	}
+
+	if len(args) > 1 {
+		n, err := parseNumber(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid number of instructions '%s'", args[1])
+		}
+		count = n
+	}
+
+	d.disassemble(start, count)
+	return nil
+}
+
+// programStart is the lowest address disassembled around the PC.
+const programStart = 0x200
+
+// disassemble prints count instructions starting at addr, marking the PC and the breakpoints.
+func (d *Debugger) disassemble(addr uint16, count int) {
+	// the longest instruction is 4 bytes
+	p := &disasm.Program{
+		Origin: addr,
+		ROM:    d.c8.ReadMemory(addr, count*4),
+		Labels: d.labels,
+	}
+	pc := d.c8.Registers().PC
+
+	for i := 0; i < count && int(addr-p.Origin)+2 <= len(p.ROM); i++ {
+		in, ok := p.Decode(addr)
+
+		if name, ok := d.labels[addr]; ok {
+			fmt.Fprintf(d.out, ": %s\n", name)
+		}
+
+		marker := "  "
+		switch {
+		case addr == pc:
+			marker = "=>"
+		case d.hasBreakpoint(addr):
+			marker = " *"
+		}
+
+		text := fmt.Sprintf("0x%02X 0x%02X", uint8(in.Opcode>>8), uint8(in.Opcode))
+		size := uint16(2)
+		if ok {
+			text = p.Format(in, disasm.Octo)
+			size = in.Size()
+		}
+
+		fmt.Fprintf(d.out, "%s %04X  %04X  %s\n", marker, addr, in.Opcode, text)
+		addr += size
+	}
+}
+
+func (d *Debugger) hasBreakpoint(addr uint16) bool {
+	for _, b := range d.breakpoints {
+		if !b.anywhere && b.addr == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Debugger) key(up bool, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: press KEY or release KEY")
+	}
+
+	key, err := strconv.ParseUint(args[0], 16, 4)
+	if err != nil {
+		return fmt.Errorf("invalid key '%s', want a hex digit", args[0])
+	}
+
+	d.c8.HandleKeyEvent(uint8(key), up)
+	return nil
+}
@@ -0,0 +1,173 @@
+package debug
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/valep27/GChip8/src/emu"
+)
+
+// operandKind tells what an operand of a condition refers to.
+type operandKind int
+
+const (
+	constant operandKind = iota
+	register
+	indexRegister
+	programCounter
+	stackPointer
+	delayTimer
+	soundTimer
+	memoryByte
+)
+
+// operand is one side of a condition. value is the constant, the register number
+// or the memory address, depending on the kind.
+type operand struct {
+	kind  operandKind
+	value int
+}
+
+// namedOperands are the operands written as a name, other than V0 to VF.
+var namedOperands = map[string]operandKind{
+	"I":  indexRegister,
+	"PC": programCounter,
+	"SP": stackPointer,
+	"DT": delayTimer,
+	"ST": soundTimer,
+}
+
+func (o operand) eval(c8 *emu.Chip8) int {
+	r := c8.Registers()
+
+	switch o.kind {
+	case register:
+		return int(r.V[o.value])
+	case indexRegister:
+		return int(r.I)
+	case programCounter:
+		return int(r.PC)
+	case stackPointer:
+		return int(r.SP)
+	case delayTimer:
+		return int(r.DelayTimer)
+	case soundTimer:
+		return int(r.SoundTimer)
+	case memoryByte:
+		return int(c8.ReadMemory(uint16(o.value), 1)[0])
+	}
+
+	return o.value
+}
+
+// comparisons are the operators of conditions.
+var comparisons = map[string]func(a, b int) bool{
+	"==": func(a, b int) bool { return a == b },
+	"!=": func(a, b int) bool { return a != b },
+	"<":  func(a, b int) bool { return a < b },
+	"<=": func(a, b int) bool { return a <= b },
+	">":  func(a, b int) bool { return a > b },
+	">=": func(a, b int) bool { return a >= b },
+}
+
+var conditionPattern = regexp.MustCompile(`^(.+?)(==|!=|<=|>=|<|>)(.+)$`)
+
+// condition is a comparison between registers, memory bytes and constants, e.g. "V3 == 0x10".
+type condition struct {
+	text        string
+	left, right operand
+	compare     func(a, b int) bool
+}
+
+// parseCondition parses a condition in the form "LEFT OP RIGHT", where operands are
+// V0 to VF, I, PC, SP, DT, ST, a memory byte written as [ADDR] or a number.
+func parseCondition(text string, symbols map[string]uint16) (*condition, error) {
+	m := conditionPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if m == nil {
+		return nil, fmt.Errorf("invalid condition '%s', want e.g. 'V3 == 0x10'", text)
+	}
+
+	left, err := parseOperand(m[1], symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := parseOperand(m[3], symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	return &condition{strings.TrimSpace(text), left, right, comparisons[m[2]]}, nil
+}
+
+func parseOperand(text string, symbols map[string]uint16) (operand, error) {
+	text = strings.TrimSpace(text)
+	upper := strings.ToUpper(text)
+
+	if kind, ok := namedOperands[upper]; ok {
+		return operand{kind, 0}, nil
+	}
+
+	if len(upper) == 2 && upper[0] == 'V' {
+		if reg, err := strconv.ParseUint(upper[1:], 16, 4); err == nil {
+			return operand{register, int(reg)}, nil
+		}
+	}
+
+	if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+		addr, err := parseAddress(text[1:len(text)-1], symbols)
+		return operand{memoryByte, int(addr)}, err
+	}
+
+	value, err := parseNumber(text)
+	return operand{constant, value}, err
+}
+
+func (c *condition) eval(c8 *emu.Chip8) bool {
+	return c.compare(c.left.eval(c8), c.right.eval(c8))
+}
+
+func (c *condition) String() string {
+	return c.text
+}
+
+// parseNumber parses a decimal number, or a hex one prefixed by 0x or #.
+func parseNumber(text string) (int, error) {
+	digits, base := text, 10
+
+	switch {
+	case strings.HasPrefix(text, "0x"), strings.HasPrefix(text, "0X"):
+		digits, base = text[2:], 16
+	case strings.HasPrefix(text, "#"):
+		digits, base = text[1:], 16
+	}
+
+	value, err := strconv.ParseInt(digits, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number '%s'", text)
+	}
+
+	return int(value), nil
+}
+
+// parseAddress parses a label of the symbol map or a number between 0 and 0xFFFF.
+func parseAddress(text string, symbols map[string]uint16) (uint16, error) {
+	text = strings.TrimSpace(text)
+
+	if addr, ok := symbols[text]; ok {
+		return addr, nil
+	}
+
+	value, err := parseNumber(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address '%s'", text)
+	}
+
+	if value < 0 || value > 0xFFFF {
+		return 0, fmt.Errorf("address %#x out of range 0 to 0xffff", value)
+	}
+
+	return uint16(value), nil
+}
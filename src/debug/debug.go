@@ -0,0 +1,455 @@
+// Package debug implements an interactive debugger attached to a running emulator.
+//
+// The debugger takes over the frame loop: RunFrame replaces Chip8.RunFrame, executing the
+// same number of instructions per frame but checking breakpoints and watchpoints before each
+// one, so that execution can stop in the middle of a frame. Timers only tick when a frame
+// completes, so they are frozen while the program is paused.
+//
+// The debugger is driven either by the line based REPL started by Start, see Execute for
+// the list of commands, or by a front end such as a Debug Adapter Protocol server, which
+// uses the methods of Debugger from the emulator goroutine through Do.
+package debug
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/valep27/GChip8/src/emu"
+)
+
+// ErrQuit is returned by RunFrame once the debugger has been quit.
+var ErrQuit = errors.New("debugger quit")
+
+// prompt is printed whenever the REPL is ready for a command.
+const prompt = "(gchip8) "
+
+// StopKind tells why execution stopped.
+type StopKind int
+
+// The reasons for stopping.
+const (
+	// StopPause is a stop requested by the user.
+	StopPause StopKind = iota
+	// StopStep is the end of a step, next or finish.
+	StopStep
+	// StopBreakpoint is a breakpoint hit.
+	StopBreakpoint
+	// StopWatchpoint is an instruction about to access a watched memory range.
+	StopWatchpoint
+	// StopError is an instruction that failed.
+	StopError
+	// StopExit is the program exiting through 00FD.
+	StopExit
+)
+
+// Stop describes why execution stopped.
+type Stop struct {
+	Kind StopKind
+	// Breakpoint is the id of the breakpoint or watchpoint hit.
+	Breakpoint  int
+	Description string
+}
+
+// breakpoint stops execution at an address, or anywhere if anywhere is set.
+// With a condition, it only stops when the condition holds: breakpoints without
+// an address stop when the condition becomes true, not while it stays true.
+type breakpoint struct {
+	id       int
+	addr     uint16
+	anywhere bool
+	cond     *condition
+	held     bool
+}
+
+// watchpoint stops execution before an instruction reads or writes a memory range.
+type watchpoint struct {
+	id          int
+	addr        uint16
+	size        int
+	read, write bool
+}
+
+// Debugger controls the execution of a Chip8.
+type Debugger struct {
+	c8  *emu.Chip8
+	out io.Writer
+
+	symbols map[string]uint16
+	labels  map[uint16]string
+
+	breakpoints map[int]*breakpoint
+	watchpoints map[int]*watchpoint
+	lastID      int
+
+	paused bool
+	quit   bool
+	onStop func(Stop)
+	// until, if set, stops the execution resumed by a stepping command when it returns true.
+	until func() bool
+	// resumed skips the checks of the first instruction after a resume,
+	// which would stop again at the breakpoint just left.
+	resumed bool
+	// executed counts the instructions executed since the debugger started.
+	executed int
+
+	// frameSteps is the number of instructions left in the current frame,
+	// cycleDebt the fraction of instruction carried over between frames, as in Chip8.RunFrame.
+	inFrame    bool
+	frameSteps int
+	cycleDebt  int
+
+	// blocking makes RunFrame wait for commands while paused, for the headless mode.
+	// repl is set once the REPL is started.
+	blocking    bool
+	repl        bool
+	commands    chan func()
+	lastCommand string
+}
+
+// New returns a debugger attached to c8, writing the output of the REPL commands to out.
+// The program starts paused, to allow setting breakpoints.
+func New(c8 *emu.Chip8, out io.Writer) *Debugger {
+	return &Debugger{
+		c8:          c8,
+		out:         out,
+		labels:      make(map[uint16]string),
+		breakpoints: make(map[int]*breakpoint),
+		watchpoints: make(map[int]*watchpoint),
+		paused:      true,
+		commands:    make(chan func()),
+	}
+}
+
+// SetSymbols sets the labels that can be used as addresses and that are shown in the disassembly.
+func (d *Debugger) SetSymbols(symbols map[string]uint16) {
+	d.symbols = symbols
+	d.labels = make(map[uint16]string)
+
+	// with several labels at the same address, show the first in alphabetical order
+	names := make([]string, 0, len(symbols))
+	for name := range symbols {
+		names = append(names, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	for _, name := range names {
+		d.labels[symbols[name]] = name
+	}
+}
+
+// SetBlocking selects whether RunFrame waits for commands while the program is paused.
+// Without a window to keep alive, as in headless mode, it should be set.
+func (d *Debugger) SetBlocking(blocking bool) {
+	d.blocking = blocking
+}
+
+// OnStop sets a function called whenever execution stops.
+func (d *Debugger) OnStop(f func(Stop)) {
+	d.onStop = f
+}
+
+// Do runs f on the goroutine calling RunFrame, between two frames or while paused,
+// and waits for it to be scheduled. Front ends running on other goroutines must
+// use it to call the other methods of the debugger.
+func (d *Debugger) Do(f func()) {
+	d.commands <- f
+}
+
+// Start prints the current location and starts reading REPL commands from in, one per line.
+// The end of the input quits the debugger.
+func (d *Debugger) Start(in io.Reader) {
+	d.repl = true
+
+	fmt.Fprintln(d.out, "debugger started, type 'help' for the list of commands")
+	d.printLocation("paused")
+	fmt.Fprint(d.out, prompt)
+
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			line := scanner.Text()
+			d.Do(func() { d.command(line) })
+		}
+		d.Do(func() { d.command("quit") })
+	}()
+}
+
+// Paused returns true while the program is stopped by the debugger.
+func (d *Debugger) Paused() bool {
+	return d.paused
+}
+
+// Poll runs the commands received since the last call, without waiting.
+func (d *Debugger) Poll() {
+	for {
+		select {
+		case f := <-d.commands:
+			f()
+		default:
+			return
+		}
+	}
+}
+
+// command executes a line read from the REPL, repeating the last command if it is empty.
+func (d *Debugger) command(line string) {
+	if line == "" {
+		line = d.lastCommand
+	}
+	d.lastCommand = line
+
+	if err := d.Execute(line); err != nil {
+		fmt.Fprintln(d.out, err)
+	}
+
+	// while running, the prompt is printed when execution stops
+	if !d.quit && d.paused {
+		fmt.Fprint(d.out, prompt)
+	}
+}
+
+// RunFrame runs a frame of emulation like Chip8.RunFrame, stopping at breakpoints and watchpoints.
+// While paused it does nothing or, in blocking mode, waits for commands until the frame completes.
+// Errors of the emulator pause the program instead of being returned, to allow inspecting it.
+// It returns ErrQuit once the debugger has been quit.
+func (d *Debugger) RunFrame() error {
+	// the REPL in blocking mode only reads commands while paused: the lines
+	// typed in advance must not be executed while the program is running
+	if !d.blocking || !d.repl {
+		d.Poll()
+	}
+
+	for {
+		if d.quit {
+			return ErrQuit
+		}
+
+		if d.paused {
+			if !d.blocking {
+				return nil
+			}
+			(<-d.commands)()
+			continue
+		}
+
+		if d.advance() || !d.blocking {
+			return nil
+		}
+	}
+}
+
+// Continue resumes execution until a breakpoint or a watchpoint is hit.
+func (d *Debugger) Continue() {
+	d.resume(nil)
+}
+
+// Pause stops execution before the next instruction.
+func (d *Debugger) Pause() {
+	if !d.paused {
+		d.stop(Stop{Kind: StopPause, Description: "paused"})
+	}
+}
+
+// Step executes count instructions.
+func (d *Debugger) Step(count int) {
+	target := d.executed + count
+	d.resume(func() bool { return d.executed >= target })
+}
+
+// Next executes an instruction, running subroutine calls (2NNN) until they return
+// to the following instruction.
+func (d *Debugger) Next() {
+	r := d.c8.Registers()
+
+	if d.c8.ReadMemory(r.PC, 1)[0]>>4 != 0x2 {
+		d.Step(1)
+		return
+	}
+
+	sp, ret := r.SP, r.PC+2
+	d.resume(func() bool {
+		r := d.c8.Registers()
+		return r.SP == sp && r.PC == ret
+	})
+}
+
+// Finish runs until the current subroutine returns with 00EE.
+func (d *Debugger) Finish() error {
+	sp := d.c8.Registers().SP
+	if sp == 0 {
+		return fmt.Errorf("not in a subroutine")
+	}
+
+	d.resume(func() bool { return d.c8.Registers().SP < sp })
+	return nil
+}
+
+// Quit ends the debugging session: the following call to RunFrame returns ErrQuit.
+func (d *Debugger) Quit() {
+	d.quit = true
+}
+
+// advance runs the instructions left in the current frame and ticks the timers at its end.
+// It returns false if execution stopped before the end of the frame.
+func (d *Debugger) advance() bool {
+	if !d.inFrame {
+		d.cycleDebt += d.c8.ClockSpeed()
+		d.frameSteps = d.cycleDebt / emu.TimerFrequency
+		d.cycleDebt %= emu.TimerFrequency
+		d.inFrame = true
+	}
+
+	for d.frameSteps > 0 {
+		if !d.resumed {
+			if s, ok := d.check(); ok {
+				d.stop(s)
+				return false
+			}
+		}
+		d.resumed = false
+
+		d.frameSteps--
+		d.executed++
+		if err := d.c8.Step(); err != nil {
+			d.stop(Stop{Kind: StopError, Description: fmt.Sprintf("error: %s", err)})
+			return false
+		}
+
+		if d.c8.Exited() {
+			d.stop(Stop{Kind: StopExit, Description: "program exited"})
+			return false
+		}
+
+		if d.until != nil && d.until() {
+			s, ok := d.check()
+			if !ok {
+				s = Stop{Kind: StopStep, Description: "stopped"}
+			}
+			d.stop(s)
+			return false
+		}
+	}
+
+	d.inFrame = false
+	d.c8.Tick()
+	return true
+}
+
+// check looks for breakpoints and watchpoints hit by the instruction at the PC, before executing it.
+func (d *Debugger) check() (Stop, bool) {
+	// while waiting for a key, the same instruction is retried without doing anything
+	if d.c8.IsWaitingForKey() || len(d.breakpoints) == 0 && len(d.watchpoints) == 0 {
+		return Stop{}, false
+	}
+
+	pc := d.c8.Registers().PC
+	var hit *breakpoint
+
+	for _, id := range d.breakpointIDs() {
+		b := d.breakpoints[id]
+
+		if !b.anywhere {
+			if b.addr == pc && hit == nil && (b.cond == nil || b.cond.eval(d.c8)) {
+				hit = b
+			}
+			continue
+		}
+
+		// conditions without address are updated at every instruction, to detect when they become true
+		held := b.cond.eval(d.c8)
+		if held && !b.held && hit == nil {
+			hit = b
+		}
+		b.held = held
+	}
+
+	if hit != nil {
+		s := Stop{StopBreakpoint, hit.id, fmt.Sprintf("breakpoint %d", hit.id)}
+		if hit.anywhere {
+			s.Description += ", " + hit.cond.String()
+		}
+		return s, true
+	}
+
+	for _, access := range d.c8.NextMemoryAccesses() {
+		for _, id := range d.watchpointIDs() {
+			w := d.watchpoints[id]
+			if !(access.Write && w.write || !access.Write && w.read) {
+				continue
+			}
+
+			if addr, ok := overlap(access, w); ok {
+				kind := "read"
+				if access.Write {
+					kind = "write"
+				}
+				return Stop{StopWatchpoint, w.id, fmt.Sprintf("watchpoint %d, %s of 0x%03X", w.id, kind, addr)}, true
+			}
+		}
+	}
+
+	return Stop{}, false
+}
+
+// overlap returns the first address of the watched range accessed by a memory access.
+func overlap(access emu.MemoryAccess, w *watchpoint) (uint16, bool) {
+	for i := 0; i < w.size; i++ {
+		addr := w.addr + uint16(i)
+		if access.Contains(addr) {
+			return addr, true
+		}
+	}
+
+	return 0, false
+}
+
+// stop pauses execution, reporting why and where.
+func (d *Debugger) stop(s Stop) {
+	d.paused = true
+	d.until = nil
+
+	if d.onStop != nil {
+		d.onStop(s)
+	}
+
+	if d.repl {
+		d.printLocation(s.Description)
+		// commands given while running print their own prompt
+		if s.Kind != StopPause {
+			fmt.Fprint(d.out, prompt)
+		}
+	}
+}
+
+// resume restarts execution until a breakpoint, a watchpoint or until returns true.
+func (d *Debugger) resume(until func() bool) {
+	d.paused = false
+	d.resumed = true
+	d.until = until
+}
+
+func (d *Debugger) printLocation(reason string) {
+	fmt.Fprintf(d.out, "%s at 0x%03X\n", reason, d.c8.Registers().PC)
+	d.disassemble(d.c8.Registers().PC, 1)
+}
+
+func (d *Debugger) breakpointIDs() []int {
+	ids := make([]int, 0, len(d.breakpoints))
+	for id := range d.breakpoints {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (d *Debugger) watchpointIDs() []int {
+	ids := make([]int, 0, len(d.watchpoints))
+	for id := range d.watchpoints {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,191 @@
+package debug
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/valep27/GChip8/src/emu"
+)
+
+// program calls a subroutine that increments V3 and stores it at 0x300.
+var program = []byte{
+	0xA3, 0x00, // 200: i := 0x300
+	0x22, 0x08, // 202: call 0x208
+	0x12, 0x02, // 204: jump 0x202
+	0x00, 0x00, // 206: unused
+	0x73, 0x01, // 208: v3 += 1
+	0xF3, 0x55, // 20A: save v3
+	0x00, 0xEE, // 20C: return
+}
+
+func newDebugger(t *testing.T) (*Debugger, *emu.Chip8, *bytes.Buffer) {
+	t.Helper()
+
+	c8 := emu.New()
+	if err := c8.LoadBytes(program); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	return New(c8, &out), c8, &out
+}
+
+// run executes a command, then runs frames until the program is paused again.
+// Commands that do not resume execution return immediately.
+func run(t *testing.T, d *Debugger, command string) {
+	t.Helper()
+
+	if err := d.Execute(command); err != nil {
+		t.Fatalf("Execute(%q) error = %v", command, err)
+	}
+
+	for i := 0; i < 100 && !d.Paused(); i++ {
+		if err := d.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !d.Paused() {
+		t.Fatalf("%q did not stop", command)
+	}
+}
+
+func TestStepping(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []string
+		wantPC   uint16
+		wantSP   uint16
+	}{
+		{"step", []string{"step"}, 0x202, 0},
+		{"step into call", []string{"step 2"}, 0x208, 1},
+		{"step over call", []string{"step", "next"}, 0x204, 0},
+		{"next without call", []string{"next"}, 0x202, 0},
+		{"finish", []string{"step 3", "finish"}, 0x204, 0},
+		{"breakpoint", []string{"break 0x20C", "continue"}, 0x20C, 1},
+		{"breakpoint on label", []string{"break inc", "continue"}, 0x208, 1},
+		{"next stops at breakpoints", []string{"step", "break 0x20A", "next"}, 0x20A, 1},
+		{"conditional breakpoint", []string{"break 0x208 if V3 == 2", "continue"}, 0x208, 1},
+		{"condition anywhere", []string{"break if [0x303] >= 3", "continue"}, 0x20C, 1},
+		{"write watchpoint", []string{"watch 0x300 w", "continue"}, 0x20A, 1},
+		{"read watchpoint ignores writes", []string{"watch 0x300 r", "break 0x204", "continue"}, 0x204, 0},
+		{"deleted breakpoint", []string{"break 0x208", "break 0x204", "delete 1", "continue"}, 0x204, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, c8, _ := newDebugger(t)
+			d.SetSymbols(map[string]uint16{"inc": 0x208})
+
+			for _, command := range tt.commands {
+				run(t, d, command)
+			}
+
+			r := c8.Registers()
+			if r.PC != tt.wantPC || r.SP != tt.wantSP {
+				t.Errorf("PC = %#04x, SP = %d, want %#04x and %d", r.PC, r.SP, tt.wantPC, tt.wantSP)
+			}
+		})
+	}
+}
+
+func TestConditionalBreakpointValue(t *testing.T) {
+	d, c8, _ := newDebugger(t)
+
+	run(t, d, "break 0x20A if V3 == 0x10")
+	run(t, d, "continue")
+
+	if v := c8.Registers().V[3]; v != 0x10 {
+		t.Errorf("stopped with V3 = %#x, want 0x10", v)
+	}
+
+	// the breakpoint left must not stop execution again
+	run(t, d, "break 0x204")
+	run(t, d, "continue")
+	if pc := c8.Registers().PC; pc != 0x204 {
+		t.Errorf("PC = %#04x, want 0x204", pc)
+	}
+}
+
+func TestTimersFrozenWhilePaused(t *testing.T) {
+	d, c8, _ := newDebugger(t)
+	c8.LoadBytes([]byte{0x60, 0x30, 0xF0, 0x15, 0x12, 0x04})
+
+	run(t, d, "step 2")
+	for i := 0; i < 10; i++ {
+		if err := d.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if dt := c8.Registers().DelayTimer; dt != 0x30 {
+		t.Errorf("delay timer = %#x while paused, want 0x30", dt)
+	}
+
+	d.Execute("continue")
+	d.RunFrame()
+	if dt := c8.Registers().DelayTimer; dt != 0x2F {
+		t.Errorf("delay timer = %#x after a frame, want 0x2F", dt)
+	}
+}
+
+func TestBlockingREPL(t *testing.T) {
+	d, c8, _ := newDebugger(t)
+	d.SetBlocking(true)
+
+	var out bytes.Buffer
+	d.out = &out
+	d.Start(strings.NewReader("break 0x20A\nc\nregs\nstack\nmem 0x300 4\ndis\n\nquit\n"))
+
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = d.RunFrame()
+	}
+
+	if err != ErrQuit {
+		t.Fatalf("RunFrame() error = %v, want ErrQuit", err)
+	}
+	if pc := c8.Registers().PC; pc != 0x20A {
+		t.Errorf("PC = %#04x, want 0x20A", pc)
+	}
+
+	for _, want := range []string{
+		"breakpoint 1 at 0x20A",
+		"V0=00 V1=00 V2=00 V3=01",
+		"I=0300 PC=020A SP=1",
+		"#1  0x204, called at 0x202",
+		"0300  00 00 00 00",
+		"=> 020A  F355  save v3",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"jump", "unknown command 'jump'"},
+		{"break nowhere", "invalid address 'nowhere'"},
+		{"break if V3 = 2", "invalid condition"},
+		{"break 0x200 if VG == 2", "invalid number 'VG'"},
+		{"watch", "usage: watch"},
+		{"finish", "not in a subroutine"},
+		{"delete 7", "no breakpoint or watchpoint 7"},
+		{"press 10", "invalid key '10'"},
+		{"mem 0x10000", "out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			d, _, _ := newDebugger(t)
+
+			err := d.Execute(tt.command)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Execute(%q) error = %v, want %q", tt.command, err, tt.want)
+			}
+		})
+	}
+}
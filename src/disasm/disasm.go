@@ -0,0 +1,200 @@
+// Package disasm disassembles CHIP-8 programs, using the same instruction decoding as the emulator.
+//
+// Code is told apart from data by following the flow of the program from its entry point:
+// bytes that are never reached as instructions are considered data, and data pointed to
+// by I is assumed to hold sprites.
+package disasm
+
+import (
+	"github.com/valep27/GChip8/src/emu"
+	"github.com/valep27/GChip8/src/util"
+)
+
+// Origin is the address where programs are loaded and start executing.
+const Origin = 0x200
+
+// Kind tells what a byte of the program has been found to contain.
+type Kind uint8
+
+// The possible kinds of bytes.
+const (
+	// Data is a byte that is never executed.
+	Data Kind = iota
+	// Sprite is data pointed to by I, most likely a sprite.
+	Sprite
+	// Code is the first byte of an instruction.
+	Code
+	// Operand is a byte following the first one of an instruction.
+	Operand
+)
+
+// Program is a disassembled program.
+type Program struct {
+	// Origin is the address of the first byte of the program.
+	Origin uint16
+	// ROM holds the bytes of the program.
+	ROM []byte
+	// Kinds holds the kind of every byte of the program.
+	Kinds []Kind
+	// Labels holds the names of the addresses that are jumped to, called or loaded into I.
+	Labels map[uint16]string
+}
+
+// Instruction is a decoded instruction of the program.
+type Instruction struct {
+	emu.Instruction
+	Addr uint16
+	// Long is the 16 bit operand of F000 NNNN.
+	Long uint16
+}
+
+// Disassemble analyzes a program loaded at origin, starting execution from its first byte.
+func Disassemble(rom []byte, origin uint16) *Program {
+	p := &Program{
+		Origin: origin,
+		ROM:    rom,
+		Kinds:  make([]Kind, len(rom)),
+		Labels: make(map[uint16]string),
+	}
+
+	p.trace(origin)
+	p.Labels[origin] = "main"
+
+	return p
+}
+
+// contains returns true if addr is inside the program.
+func (p *Program) contains(addr uint16) bool {
+	return addr >= p.Origin && int(addr-p.Origin) < len(p.ROM)
+}
+
+// Decode decodes the instruction at addr.
+// The second return value is false if there is no valid instruction at addr.
+func (p *Program) Decode(addr uint16) (Instruction, bool) {
+	if !p.contains(addr) || !p.contains(addr+1) {
+		return Instruction{}, false
+	}
+
+	i := addr - p.Origin
+	opcode := util.CombineBytes(p.ROM[i+1], p.ROM[i])
+	decoded, ok := emu.Decode(opcode)
+	in := Instruction{Instruction: decoded, Addr: addr}
+
+	if !ok {
+		return in, false
+	}
+
+	if in.Op == emu.OpF000 {
+		if !p.contains(addr + 3) {
+			return in, false
+		}
+		in.Long = util.CombineBytes(p.ROM[i+3], p.ROM[i+2])
+	}
+
+	return in, true
+}
+
+// Successors returns the addresses that can be executed after the instruction.
+// Targets that cannot be known statically, like the ones of BNNN, are not included.
+func (p *Program) Successors(in Instruction) []uint16 {
+	next := in.Addr + in.Size()
+
+	if in.Op.IsSkip() {
+		skipped := next + 2
+		if following, ok := p.Decode(next); ok {
+			skipped = next + following.Size()
+		}
+		return []uint16{next, skipped}
+	}
+
+	switch in.Op {
+	case emu.Op1NNN:
+		return []uint16{in.NNN}
+	case emu.Op2NNN:
+		return []uint16{in.NNN, next}
+	case emu.Op00EE, emu.Op00FD, emu.OpBNNN:
+		return nil
+	}
+
+	return []uint16{next}
+}
+
+// trace marks as code all the instructions reachable from entry.
+func (p *Program) trace(entry uint16) {
+	pending := []uint16{entry}
+
+	for len(pending) > 0 {
+		addr := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if !p.contains(addr) || p.Kinds[addr-p.Origin] == Code {
+			continue
+		}
+
+		in, ok := p.Decode(addr)
+		if !ok || !p.free(addr, in.Size()) {
+			continue
+		}
+
+		p.Kinds[addr-p.Origin] = Code
+		for i := uint16(1); i < in.Size(); i++ {
+			p.Kinds[addr-p.Origin+i] = Operand
+		}
+
+		switch in.Op {
+		case emu.Op1NNN:
+			p.label(in.NNN, "L")
+		case emu.Op2NNN:
+			p.label(in.NNN, "sub")
+		case emu.OpANNN:
+			p.markSprite(in.NNN)
+		case emu.OpF000:
+			p.markSprite(in.Long)
+		}
+
+		pending = append(pending, p.Successors(in)...)
+	}
+
+	// I can point to data that later turned out to be code
+	for addr := range p.Labels {
+		if p.contains(addr) && p.Kinds[addr-p.Origin] == Operand {
+			delete(p.Labels, addr)
+		}
+	}
+}
+
+// free returns true if none of the size bytes at addr are already part of an instruction.
+func (p *Program) free(addr, size uint16) bool {
+	for i := uint16(0); i < size; i++ {
+		if !p.contains(addr + i) {
+			return false
+		}
+
+		if k := p.Kinds[addr-p.Origin+i]; k == Code || k == Operand {
+			return false
+		}
+	}
+
+	return true
+}
+
+// markSprite records that I points to addr, marking it as sprite data if it is not code.
+func (p *Program) markSprite(addr uint16) {
+	if !p.contains(addr) {
+		return
+	}
+
+	p.label(addr, "D")
+	if p.Kinds[addr-p.Origin] == Data {
+		p.Kinds[addr-p.Origin] = Sprite
+	}
+}
+
+// label names addr, unless it already has a name or is outside the program.
+func (p *Program) label(addr uint16, prefix string) {
+	if _, ok := p.Labels[addr]; ok || !p.contains(addr) {
+		return
+	}
+
+	p.Labels[addr] = labelName(prefix, addr)
+}
@@ -0,0 +1,146 @@
+package disasm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/valep27/GChip8/src/emu"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		bytes  []byte
+		octo   string
+		cowgod string
+	}{
+		{"clear", []byte{0x00, 0xE0}, "clear", "CLS"},
+		{"scroll down", []byte{0x00, 0xC4}, "scroll-down 4", "SCD 4"},
+		{"set immediate", []byte{0x6A, 0x2F}, "va := 0x2F", "LD VA, #2F"},
+		{"skip if equal", []byte{0x31, 0x05}, "if v1 != 0x05 then", "SE V1, #05"},
+		{"skip if key", []byte{0xE3, 0x9E}, "if v3 -key then", "SKP V3"},
+		{"subtract reverse", []byte{0x81, 0x27}, "v1 =- v2", "SUBN V1, V2"},
+		{"draw", []byte{0xD0, 0x1F}, "sprite v0 v1 15", "DRW V0, V1, 15"},
+		{"store", []byte{0xF4, 0x55}, "save v4", "LD [I], V4"},
+		{"register range", []byte{0x52, 0x43}, "load v2 - v4", "LOAD V2, V4"},
+		{"long load", []byte{0xF0, 0x00, 0xBE, 0xEF}, "i := long 0xBEEF", "LD I, #BEEF"},
+		{"jump out of the program", []byte{0x13, 0x00}, "jump 0x300", "JP #300"},
+		{"loose encoding", []byte{0x91, 0x21}, "0x91 0x21", "SNE V1, V2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Disassemble(tt.bytes, Origin)
+			in, ok := p.Decode(Origin)
+
+			if !ok {
+				t.Fatalf("Decode() failed")
+			}
+			if got := p.Format(in, Octo); got != tt.octo {
+				t.Errorf("Format(Octo) = %q, want %q", got, tt.octo)
+			}
+			if got := p.Format(in, Cowgod); got != tt.cowgod {
+				t.Errorf("Format(Cowgod) = %q, want %q", got, tt.cowgod)
+			}
+		})
+	}
+}
+
+func TestCodeAndDataSeparation(t *testing.T) {
+	rom := []byte{
+		0xA2, 0x0A, // 200: i := sprite
+		0x22, 0x08, // 202: call 208
+		0x12, 0x04, // 204: jump 204
+		0xFF, 0xFF, // 206: unreachable
+		0xD0, 0x15, // 208: sprite v0 v0 5
+		0x00, 0xEE, // 20A: return, also the sprite start
+	}
+	rom = append(rom, 0xF0, 0x90)
+
+	p := Disassemble(rom, Origin)
+	want := []Kind{Code, Operand, Code, Operand, Code, Operand, Data, Data, Code, Operand, Code, Operand, Data, Data}
+
+	for i, kind := range want {
+		if p.Kinds[i] != kind {
+			t.Errorf("kind of %#x = %v, want %v", Origin+i, p.Kinds[i], kind)
+		}
+	}
+	if p.Labels[0x208] != "sub208" || p.Labels[0x204] != "L204" || p.Labels[0x200] != "main" {
+		t.Errorf("labels = %v", p.Labels)
+	}
+}
+
+func TestSpriteData(t *testing.T) {
+	rom := []byte{
+		0xA2, 0x04, // 200: i := 204
+		0x12, 0x02, // 202: loop
+		0xF0, 0x90,
+	}
+
+	p := Disassemble(rom, Origin)
+	if p.Kinds[4] != Sprite || p.Kinds[5] != Data {
+		t.Errorf("kinds = %v, want sprite at 0x204", p.Kinds)
+	}
+
+	var octo, cowgod bytes.Buffer
+	if err := p.Write(&octo, Octo); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Write(&cowgod, Cowgod); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{": main\n", "i := D204", ": D204\n", "0b11110000", "0b10010000"} {
+		if !strings.Contains(octo.String(), want) {
+			t.Errorf("Octo output does not contain %q:\n%s", want, octo.String())
+		}
+	}
+	for _, want := range []string{"204  F0         DB #F0    ; ####....", "200  A204       LD I, #204"} {
+		if !strings.Contains(cowgod.String(), want) {
+			t.Errorf("Cowgod output does not contain %q:\n%s", want, cowgod.String())
+		}
+	}
+}
+
+func TestSkipOverLongInstruction(t *testing.T) {
+	rom := []byte{
+		0x30, 0x00, // 200: skip if v0 == 0
+		0xF0, 0x00, 0x12, 0x34, // 202: i := long 0x1234
+		0x00, 0xFD, // 206: exit
+	}
+
+	p := Disassemble(rom, Origin)
+	for _, addr := range []uint16{0x200, 0x202, 0x206} {
+		if p.Kinds[addr-Origin] != Code {
+			t.Errorf("%#x is not code", addr)
+		}
+	}
+	if in, _ := p.Decode(0x202); in.Op != emu.OpF000 || in.Long != 0x1234 {
+		t.Errorf("Decode(0x202) = %+v", in)
+	}
+}
+
+func TestDisassembleGames(t *testing.T) {
+	for _, name := range []string{"PONG", "BRIX", "INVADERS"} {
+		rom, err := readGame(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := Disassemble(rom, Origin)
+		code := 0
+		for _, kind := range p.Kinds {
+			if kind == Code {
+				code++
+			}
+		}
+		if code < 50 {
+			t.Errorf("%s: found only %d instructions", name, code)
+		}
+	}
+}
+
+func readGame(name string) ([]byte, error) {
+	return ioutil.ReadFile("../../games/" + name)
+}
@@ -0,0 +1,302 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/valep27/GChip8/src/emu"
+)
+
+// Syntax is the assembly language used to print instructions.
+type Syntax int
+
+// The supported syntaxes.
+const (
+	// Octo is the syntax of the Octo assembler. The output can be assembled again.
+	Octo Syntax = iota
+	// Cowgod is the classic syntax of Cowgod's CHIP-8 technical reference.
+	Cowgod
+)
+
+// ParseSyntax returns the syntax with the given name, "octo" or "cowgod".
+func ParseSyntax(name string) (Syntax, bool) {
+	switch strings.ToLower(name) {
+	case "octo":
+		return Octo, true
+	case "cowgod":
+		return Cowgod, true
+	}
+
+	return Octo, false
+}
+
+// labelName returns the default name of a label.
+func labelName(prefix string, addr uint16) string {
+	return fmt.Sprintf("%s%03X", prefix, addr)
+}
+
+// address formats an address operand, using its label if it has one.
+func (p *Program) address(addr uint16, syntax Syntax) string {
+	if syntax == Octo {
+		if name, ok := p.Labels[addr]; ok {
+			return name
+		}
+		return fmt.Sprintf("0x%03X", addr)
+	}
+
+	return fmt.Sprintf("#%03X", addr)
+}
+
+// Format returns the text of an instruction in the given syntax.
+// In Octo syntax, addresses with a label are replaced by their name and opcodes
+// that are not canonical are written as raw bytes, so that they assemble back the same.
+func (p *Program) Format(in Instruction, syntax Syntax) string {
+	if syntax == Cowgod {
+		return p.formatCowgod(in)
+	}
+
+	return p.formatOcto(in)
+}
+
+func (p *Program) formatOcto(in Instruction) string {
+	// opcodes decoding loosely, like 9XY1 as 9XY0, would be assembled back to another opcode
+	if !in.Canonical() {
+		return rawOcto(in)
+	}
+
+	x, y := in.X, in.Y
+
+	switch in.Op {
+	case emu.Op00E0:
+		return "clear"
+	case emu.Op00EE:
+		return "return"
+	case emu.Op00CN:
+		return fmt.Sprintf("scroll-down %d", in.N)
+	case emu.Op00FB:
+		return "scroll-right"
+	case emu.Op00FC:
+		return "scroll-left"
+	case emu.Op00FD:
+		return "exit"
+	case emu.Op00FE:
+		return "lores"
+	case emu.Op00FF:
+		return "hires"
+	case emu.Op1NNN:
+		return "jump " + p.address(in.NNN, Octo)
+	case emu.Op2NNN:
+		return ":call " + p.address(in.NNN, Octo)
+	// Octo conditions describe when the next instruction runs, the opposite of the skip
+	case emu.Op3XNN:
+		return fmt.Sprintf("if v%x != 0x%02X then", x, in.NN)
+	case emu.Op4XNN:
+		return fmt.Sprintf("if v%x == 0x%02X then", x, in.NN)
+	case emu.Op5XY0:
+		return fmt.Sprintf("if v%x != v%x then", x, y)
+	case emu.Op5XY2:
+		return fmt.Sprintf("save v%x - v%x", x, y)
+	case emu.Op5XY3:
+		return fmt.Sprintf("load v%x - v%x", x, y)
+	case emu.Op6XNN:
+		return fmt.Sprintf("v%x := 0x%02X", x, in.NN)
+	case emu.Op7XNN:
+		return fmt.Sprintf("v%x += 0x%02X", x, in.NN)
+	case emu.Op8XY0:
+		return fmt.Sprintf("v%x := v%x", x, y)
+	case emu.Op8XY1:
+		return fmt.Sprintf("v%x |= v%x", x, y)
+	case emu.Op8XY2:
+		return fmt.Sprintf("v%x &= v%x", x, y)
+	case emu.Op8XY3:
+		return fmt.Sprintf("v%x ^= v%x", x, y)
+	case emu.Op8XY4:
+		return fmt.Sprintf("v%x += v%x", x, y)
+	case emu.Op8XY5:
+		return fmt.Sprintf("v%x -= v%x", x, y)
+	case emu.Op8XY6:
+		return fmt.Sprintf("v%x >>= v%x", x, y)
+	case emu.Op8XY7:
+		return fmt.Sprintf("v%x =- v%x", x, y)
+	case emu.Op8XYE:
+		return fmt.Sprintf("v%x <<= v%x", x, y)
+	case emu.Op9XY0:
+		return fmt.Sprintf("if v%x == v%x then", x, y)
+	case emu.OpANNN:
+		return "i := " + p.address(in.NNN, Octo)
+	case emu.OpBNNN:
+		return "jump0 " + p.address(in.NNN, Octo)
+	case emu.OpCXNN:
+		return fmt.Sprintf("v%x := random 0x%02X", x, in.NN)
+	case emu.OpDXYN:
+		return fmt.Sprintf("sprite v%x v%x %d", x, y, in.N)
+	case emu.OpEX9E:
+		return fmt.Sprintf("if v%x -key then", x)
+	case emu.OpEXA1:
+		return fmt.Sprintf("if v%x key then", x)
+	case emu.OpF000:
+		if name, ok := p.Labels[in.Long]; ok {
+			return "i := long " + name
+		}
+		return fmt.Sprintf("i := long 0x%04X", in.Long)
+	case emu.OpFN01:
+		return fmt.Sprintf("plane %d", x)
+	case emu.OpF002:
+		return "audio"
+	case emu.OpFX07:
+		return fmt.Sprintf("v%x := delay", x)
+	case emu.OpFX0A:
+		return fmt.Sprintf("v%x := key", x)
+	case emu.OpFX15:
+		return fmt.Sprintf("delay := v%x", x)
+	case emu.OpFX18:
+		return fmt.Sprintf("buzzer := v%x", x)
+	case emu.OpFX1E:
+		return fmt.Sprintf("i += v%x", x)
+	case emu.OpFX29:
+		return fmt.Sprintf("i := hex v%x", x)
+	case emu.OpFX30:
+		return fmt.Sprintf("i := bighex v%x", x)
+	case emu.OpFX33:
+		return fmt.Sprintf("bcd v%x", x)
+	case emu.OpFX3A:
+		return fmt.Sprintf("pitch := v%x", x)
+	case emu.OpFX55:
+		return fmt.Sprintf("save v%x", x)
+	case emu.OpFX65:
+		return fmt.Sprintf("load v%x", x)
+	case emu.OpFX75:
+		return fmt.Sprintf("saveflags v%x", x)
+	case emu.OpFX85:
+		return fmt.Sprintf("loadflags v%x", x)
+	}
+
+	return rawOcto(in)
+}
+
+// rawOcto returns the bytes of an opcode as Octo data.
+func rawOcto(in Instruction) string {
+	return fmt.Sprintf("0x%02X 0x%02X", in.Opcode>>8, in.Opcode&0xFF)
+}
+
+func (p *Program) formatCowgod(in Instruction) string {
+	x, y, m := in.X, in.Y, in.Mnemonic()
+
+	switch in.Op {
+	case emu.Op00E0, emu.Op00EE, emu.Op00FB, emu.Op00FC, emu.Op00FD, emu.Op00FE, emu.Op00FF, emu.OpF002:
+		return m
+	case emu.Op00CN:
+		return fmt.Sprintf("%s %d", m, in.N)
+	case emu.Op1NNN, emu.Op2NNN:
+		return m + " " + p.address(in.NNN, Cowgod)
+	case emu.Op3XNN, emu.Op4XNN, emu.Op6XNN, emu.Op7XNN, emu.OpCXNN:
+		return fmt.Sprintf("%s V%X, #%02X", m, x, in.NN)
+	case emu.Op5XY0, emu.Op5XY2, emu.Op5XY3, emu.Op9XY0,
+		emu.Op8XY0, emu.Op8XY1, emu.Op8XY2, emu.Op8XY3, emu.Op8XY4, emu.Op8XY5, emu.Op8XY6, emu.Op8XY7, emu.Op8XYE:
+		return fmt.Sprintf("%s V%X, V%X", m, x, y)
+	case emu.OpANNN:
+		return m + " I, " + p.address(in.NNN, Cowgod)
+	case emu.OpBNNN:
+		return m + " V0, " + p.address(in.NNN, Cowgod)
+	case emu.OpDXYN:
+		return fmt.Sprintf("%s V%X, V%X, %d", m, x, y, in.N)
+	case emu.OpEX9E, emu.OpEXA1, emu.OpFX3A:
+		return fmt.Sprintf("%s V%X", m, x)
+	case emu.OpF000:
+		return fmt.Sprintf("%s I, #%04X", m, in.Long)
+	case emu.OpFN01:
+		return fmt.Sprintf("%s %d", m, x)
+	case emu.OpFX07:
+		return fmt.Sprintf("%s V%X, DT", m, x)
+	case emu.OpFX0A:
+		return fmt.Sprintf("%s V%X, K", m, x)
+	case emu.OpFX15:
+		return fmt.Sprintf("%s DT, V%X", m, x)
+	case emu.OpFX18:
+		return fmt.Sprintf("%s ST, V%X", m, x)
+	case emu.OpFX1E:
+		return fmt.Sprintf("%s I, V%X", m, x)
+	case emu.OpFX29:
+		return fmt.Sprintf("%s F, V%X", m, x)
+	case emu.OpFX30:
+		return fmt.Sprintf("%s HF, V%X", m, x)
+	case emu.OpFX33:
+		return fmt.Sprintf("%s B, V%X", m, x)
+	case emu.OpFX55:
+		return fmt.Sprintf("%s [I], V%X", m, x)
+	case emu.OpFX65:
+		return fmt.Sprintf("%s V%X, [I]", m, x)
+	case emu.OpFX75:
+		return fmt.Sprintf("%s R, V%X", m, x)
+	case emu.OpFX85:
+		return fmt.Sprintf("%s V%X, R", m, x)
+	}
+
+	return fmt.Sprintf("%s #%04X", m, in.Opcode)
+}
+
+// spriteArt draws the bits of a byte, '#' for 1 and '.' for 0.
+func spriteArt(b byte) string {
+	var art [8]byte
+
+	for i := range art {
+		art[i] = '.'
+		if b&(0x80>>uint(i)) != 0 {
+			art[i] = '#'
+		}
+	}
+
+	return string(art[:])
+}
+
+// Write prints the whole program in the given syntax.
+//
+// Every line holds the address and the raw bytes, followed by the instruction or data.
+// Data bytes are printed one per line, along with their bits drawn as sprite art.
+// In Octo syntax addresses and raw bytes are comments and labels are declared,
+// so the output can be assembled again.
+func (p *Program) Write(w io.Writer, syntax Syntax) error {
+	out := bufio.NewWriter(w)
+
+	for i := 0; i < len(p.ROM); {
+		addr := p.Origin + uint16(i)
+
+		if name, ok := p.Labels[addr]; ok && syntax == Octo {
+			fmt.Fprintf(out, ": %s\n", name)
+		}
+
+		if p.Kinds[i] == Code {
+			in, _ := p.Decode(addr)
+			raw := fmt.Sprintf("%04X", in.Opcode)
+			if in.Op == emu.OpF000 {
+				raw += fmt.Sprintf(" %04X", in.Long)
+			}
+
+			p.writeLine(out, syntax, addr, raw, p.Format(in, syntax))
+			i += int(in.Size())
+			continue
+		}
+
+		b := p.ROM[i]
+		if syntax == Octo {
+			p.writeLine(out, syntax, addr, fmt.Sprintf("%02X", b), fmt.Sprintf("0b%08b", b))
+		} else {
+			p.writeLine(out, syntax, addr, fmt.Sprintf("%02X", b), fmt.Sprintf("DB #%02X", b)+"    ; "+spriteArt(b))
+		}
+		i++
+	}
+
+	return out.Flush()
+}
+
+// writeLine prints a line of the listing.
+func (p *Program) writeLine(out *bufio.Writer, syntax Syntax, addr uint16, raw, text string) {
+	if syntax == Octo {
+		fmt.Fprintf(out, "\t%-24s # %03X  %s\n", text, addr, raw)
+		return
+	}
+
+	fmt.Fprintf(out, "%03X  %-9s  %s\n", addr, raw, text)
+}
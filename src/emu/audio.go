@@ -0,0 +1,38 @@
+package emu
+
+import "math"
+
+const (
+	// patternSize is the size in bytes of the XO-CHIP audio pattern buffer (128 1-bit samples).
+	patternSize = 16
+	// defaultPitch plays the audio pattern at 4000 samples per second.
+	defaultPitch = 64
+)
+
+// defaultPattern is a square wave that produces a 250 Hz beep at the default pitch,
+// used by programs that never load their own pattern.
+var defaultPattern = [patternSize]uint8{
+	0xFF, 0x00, 0xFF, 0x00, 0xFF, 0x00, 0xFF, 0x00,
+	0xFF, 0x00, 0xFF, 0x00, 0xFF, 0x00, 0xFF, 0x00,
+}
+
+// AudioState describes what the sound hardware should be playing.
+type AudioState struct {
+	// Pattern holds 128 1-bit samples, starting from the most significant bit of the first byte.
+	Pattern [patternSize]uint8
+	// Pitch is the XO-CHIP pitch register, see PlaybackRate.
+	Pitch uint8
+	// Playing is true while the sound timer is active.
+	Playing bool
+}
+
+// PlaybackRate returns the number of pattern samples (bits) played per second.
+// It is 4000 Hz for the default pitch of 64, doubling every 48 pitch steps.
+func (a AudioState) PlaybackRate() float64 {
+	return 4000 * math.Pow(2, (float64(a.Pitch)-64)/48)
+}
+
+// Audio returns the current state of the sound hardware.
+func (c8 *Chip8) Audio() AudioState {
+	return AudioState{c8.pattern, c8.pitch, c8.soundt > 0}
+}
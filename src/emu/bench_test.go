@@ -0,0 +1,168 @@
+package emu
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// BenchmarkGames runs every game in the games directory, one instruction per iteration.
+// The timers tick every 1000 instructions, and keys are pressed and released regularly
+// so that the games waiting for input keep running.
+func BenchmarkGames(b *testing.B) {
+	games, err := ioutil.ReadDir("../../games")
+	if err != nil {
+		b.Skip("games directory not available")
+	}
+
+	for _, game := range games {
+		path := filepath.Join("../../games", game.Name())
+
+		b.Run(game.Name(), func(b *testing.B) {
+			c8 := New()
+			if err := c8.LoadRom(path); err != nil {
+				b.Fatal(err)
+			}
+			c8.SeedRandom(1)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if i%1000 == 0 {
+					c8.Tick()
+					c8.HandleKeyEvent(uint8(i/1000)%16, i%2000 != 0)
+				}
+
+				if err := c8.Step(); err != nil || c8.Exited() {
+					// start over, the benchmark measures the speed of the interpreter
+					b.StopTimer()
+					c8.Reset()
+					if err := c8.LoadRom(path); err != nil {
+						b.Fatal(err)
+					}
+					b.StartTimer()
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDecode decodes every possible opcode in turn, one per iteration, through the table
+// used by Decode and through decodeOp, the switch that fills it, as the interpreter did before
+// the table: "switch" is the reference the table is compared against.
+func BenchmarkDecode(b *testing.B) {
+	b.Run("table", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			decoded, _ = Decode(uint16(i))
+		}
+	})
+
+	b.Run("switch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			decoded, _ = decodeSwitch(uint16(i))
+		}
+	})
+}
+
+// decoded keeps the results of BenchmarkDecode, so that the decoding is not optimized away.
+var decoded Instruction
+
+// decodeSwitch decodes an opcode without the table, extracting the operands like decodeAll.
+func decodeSwitch(opcode uint16) (Instruction, bool) {
+	op, ok := decodeOp(opcode)
+	return Instruction{
+		Opcode: opcode,
+		Op:     op,
+		X:      uint8(opcode>>8) & 0xF,
+		Y:      uint8(opcode>>4) & 0xF,
+		N:      uint8(opcode) & 0xF,
+		NN:     uint8(opcode),
+		NNN:    opcode & 0x0FFF,
+	}, ok
+}
+
+// BenchmarkRunFrame runs every game in the games directory one frame of 1000 instructions
+// per iteration, with and without the block cache.
+func BenchmarkRunFrame(b *testing.B) {
+	games, err := ioutil.ReadDir("../../games")
+	if err != nil {
+		b.Skip("games directory not available")
+	}
+
+	for _, blocks := range []bool{false, true} {
+		engine := "step"
+		if blocks {
+			engine = "blocks"
+		}
+
+		for _, game := range games {
+			path := filepath.Join("../../games", game.Name())
+
+			b.Run(engine+"/"+game.Name(), func(b *testing.B) {
+				c8 := New()
+				if err := c8.LoadRom(path); err != nil {
+					b.Fatal(err)
+				}
+				c8.SeedRandom(1)
+				c8.SetInstructionsPerFrame(1000)
+				c8.SetBlockCache(blocks)
+
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					c8.HandleKeyEvent(uint8(i)%16, i%2 != 0)
+
+					if err := c8.RunFrame(); err != nil || c8.Exited() {
+						b.StopTimer()
+						c8.Reset()
+						if err := c8.LoadRom(path); err != nil {
+							b.Fatal(err)
+						}
+						b.StartTimer()
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkRunFrameLoop runs a loop of arithmetic without draws, where the dispatch of
+// instructions dominates, one frame of 1000 instructions per iteration.
+func BenchmarkRunFrameLoop(b *testing.B) {
+	program := []byte{
+		0x70, 0x01, // 0x200 ADD V0, 1
+		0x81, 0x04, // 0x202 ADD V1, V0
+		0x62, 0x05, // 0x204 LD V2, 5
+		0x82, 0x15, // 0x206 SUB V2, V1
+		0xA3, 0x00, // 0x208 LD I, 0x300
+		0xF2, 0x1E, // 0x20A ADD I, V2
+		0x83, 0x20, // 0x20C LD V3, V2
+		0x12, 0x00, // 0x20E JP 0x200
+	}
+
+	for _, blocks := range []bool{false, true} {
+		engine := "step"
+		if blocks {
+			engine = "blocks"
+		}
+
+		b.Run(engine, func(b *testing.B) {
+			c8 := New()
+			if err := c8.LoadBytes(program); err != nil {
+				b.Fatal(err)
+			}
+			c8.SetInstructionsPerFrame(1000)
+			c8.SetBlockCache(blocks)
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if err := c8.RunFrame(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package emu
+
+// The block cache is an optional execution engine for RunFrame, faster than executing
+// one instruction at a time with Step. Straight-line runs of instructions, called blocks,
+// are translated once into chains of closures with the operands already bound, and
+// cached by start address. Writes to the memory of a cached block invalidate it.
+//
+// The result is identical to Step: every closure is checked for errors and for a PC
+// that did not move to the following instruction, in which case the block is left.
+
+// maxBlockLength is the maximum number of instructions of a block.
+const maxBlockLength = 64
+
+// maxBlockSize is the maximum size of a block in bytes: F000 NNNN is 4 bytes long.
+const maxBlockSize = maxBlockLength * 4
+
+// blockOp is an instruction of a block.
+type blockOp struct {
+	exec func(c8 *Chip8)
+	// addr is the address of the instruction and next the one of the following instruction.
+	addr, next uint16
+	opcode     uint16
+}
+
+// block is a straight-line run of instructions, ending with a jump, a call, a return,
+// a skip or any instruction that can change the flow of the program.
+type block struct {
+	ops []blockOp
+	// start and end delimit the memory of the block, end excluded.
+	start, end int
+	// valid is false once the block has been invalidated by a write.
+	valid bool
+}
+
+// blockCache holds the blocks translated so far.
+type blockCache struct {
+	// blocks holds the block starting at every address, if any.
+	blocks []*block
+	// coverage counts the cached blocks including every byte of memory.
+	coverage []uint16
+}
+
+func newBlockCache() *blockCache {
+	return &blockCache{
+		blocks:   make([]*block, memorySize),
+		coverage: make([]uint16, memorySize),
+	}
+}
+
+// SetBlockCache enables or disables the block cache, which makes RunFrame faster.
+// It is not used while a tracer or an observer is set, nor by Step,
+// so debuggers and other tools always see every instruction.
+func (c8 *Chip8) SetBlockCache(enabled bool) {
+	if !enabled {
+		c8.blocks = nil
+	} else if c8.blocks == nil {
+		c8.blocks = newBlockCache()
+	}
+}
+
+// flushBlocks discards the cached blocks, after the memory is replaced.
+func (c8 *Chip8) flushBlocks() {
+	if c8.blocks != nil {
+		c8.blocks = newBlockCache()
+	}
+}
+
+// invalidate discards the blocks including any of the size bytes at addr.
+func (bc *blockCache) invalidate(addr uint16, size int) {
+	for a := int(addr); a < int(addr)+size && a < memorySize; a++ {
+		if bc.coverage[a] == 0 {
+			continue
+		}
+
+		// the blocks including a start at most maxBlockSize bytes before it
+		first := a - maxBlockSize + 1
+		if first < 0 {
+			first = 0
+		}
+		for start := first; start <= a; start++ {
+			if b := bc.blocks[start]; b != nil && b.end > a {
+				bc.remove(b)
+			}
+		}
+	}
+}
+
+func (bc *blockCache) remove(b *block) {
+	b.valid = false
+	bc.blocks[b.start] = nil
+
+	for a := b.start; a < b.end; a++ {
+		bc.coverage[a]--
+	}
+}
+
+// lookup returns the block starting at addr, translating it if needed.
+// It returns nil if there is no valid instruction at addr.
+func (c8 *Chip8) lookup(addr uint16) *block {
+	bc := c8.blocks
+	if b := bc.blocks[addr]; b != nil {
+		return b
+	}
+
+	b := c8.translate(addr)
+	if b == nil {
+		return nil
+	}
+
+	bc.blocks[addr] = b
+	for a := b.start; a < b.end; a++ {
+		bc.coverage[a]++
+	}
+
+	return b
+}
+
+// translate builds the block starting at addr.
+func (c8 *Chip8) translate(addr uint16) *block {
+	b := &block{start: int(addr), valid: true}
+	pc := int(addr)
+
+	for len(b.ops) < maxBlockLength && pc+2 <= memorySize {
+		in := instructions[uint16(c8.memory[pc])<<8|uint16(c8.memory[pc+1])]
+		if in.Op == OpInvalid {
+			// left to Step, which reports the error
+			break
+		}
+
+		size := int(in.Size())
+		if pc+size > memorySize {
+			break
+		}
+
+		b.ops = append(b.ops, blockOp{compile(in), uint16(pc), uint16(pc + size), in.Opcode})
+		pc += size
+
+		// FX0A stops the machine, which leaves the block anyway
+		if in.Op.EndsBlock() || in.Op == OpFX0A {
+			break
+		}
+	}
+
+	if len(b.ops) == 0 {
+		return nil
+	}
+
+	b.end = pc
+	return b
+}
+
+// compile returns a closure executing an instruction.
+// The most common instructions that do not depend on quirks nor fail are inlined,
+// the others call their handler.
+func compile(in Instruction) func(c8 *Chip8) {
+	x, y, nn, nnn := in.X, in.Y, in.NN, in.NNN
+
+	switch in.Op {
+	case Op1NNN:
+		return func(c8 *Chip8) {
+			c8.pc = nnn
+		}
+	case Op6XNN:
+		return func(c8 *Chip8) {
+			c8.V[x] = nn
+			c8.pc += 2
+		}
+	case Op7XNN:
+		return func(c8 *Chip8) {
+			c8.V[x] += nn
+			c8.pc += 2
+		}
+	case Op8XY0:
+		return func(c8 *Chip8) {
+			c8.V[x] = c8.V[y]
+			c8.pc += 2
+		}
+	case OpANNN:
+		return func(c8 *Chip8) {
+			c8.I = nnn
+			c8.pc += 2
+		}
+	case OpFX1E:
+		return func(c8 *Chip8) {
+			c8.I += uint16(c8.V[x])
+			c8.pc += 2
+		}
+	}
+
+	handler := handlers[in.Op]
+	return func(c8 *Chip8) {
+		handler(c8, in)
+	}
+}
+
+// runBlocks executes up to steps instructions through the block cache, like as many calls to Step.
+func (c8 *Chip8) runBlocks(steps int) error {
+	for steps > 0 {
+		if c8.stopped || c8.exited {
+			// Step would do nothing for the remaining steps
+			return nil
+		}
+
+		b := c8.lookup(c8.pc)
+		if b == nil {
+			// invalid instruction or end of memory: Step returns the error
+			if err := c8.step(); err != nil {
+				return err
+			}
+			steps--
+			continue
+		}
+
+		for i := range b.ops {
+			if steps == 0 {
+				break
+			}
+
+			op := &b.ops[i]
+			c8.opcode = op.opcode
+			op.exec(c8)
+			steps--
+
+			if c8.fault != nil {
+				err := &ExecError{op.addr, op.opcode, c8.fault}
+				c8.fault = nil
+				return err
+			}
+
+			// the block is left after a branch, a wait or a write to its own code
+			if c8.pc != op.next || c8.stopped || !b.valid {
+				break
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package emu
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// runBoth runs the same program with and without the block cache, checking after every frame
+// that the two machines are in the same state and returned the same error.
+func runBoth(t *testing.T, load func(c8 *Chip8) error, quirks Quirks, frames int) {
+	t.Helper()
+
+	var machines [2]*Chip8
+	for i := range machines {
+		c8 := New()
+		if err := load(c8); err != nil {
+			t.Fatal(err)
+		}
+		c8.SetQuirks(quirks)
+		c8.SeedRandom(1)
+		c8.SetInstructionsPerFrame(50)
+		machines[i] = c8
+	}
+	machines[1].SetBlockCache(true)
+
+	for frame := 0; frame < frames; frame++ {
+		// press and release keys regularly, so that the games keep running
+		if frame%10 == 0 {
+			for _, c8 := range machines {
+				c8.HandleKeyEvent(uint8(frame/10)%16, frame%20 != 0)
+			}
+		}
+
+		want, got := machines[0].RunFrame(), machines[1].RunFrame()
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("frame %d: RunFrame() error = %v with blocks, %v without", frame, got, want)
+		}
+		if !bytes.Equal(machines[1].Snapshot(), machines[0].Snapshot()) {
+			t.Fatalf("frame %d: the state differs with blocks (PC %03X, want %03X)", frame, machines[1].pc, machines[0].pc)
+		}
+		if want != nil {
+			return
+		}
+	}
+}
+
+func TestBlockCacheGames(t *testing.T) {
+	games, err := ioutil.ReadDir("../../games")
+	if err != nil {
+		t.Skip("games directory not available")
+	}
+
+	for _, quirks := range []string{"default", "vip"} {
+		for _, game := range games {
+			path := filepath.Join("../../games", game.Name())
+
+			t.Run(quirks+"/"+game.Name(), func(t *testing.T) {
+				q, _ := QuirksPreset(quirks)
+				runBoth(t, func(c8 *Chip8) error { return c8.LoadRom(path) }, q, 300)
+			})
+		}
+	}
+}
+
+func TestBlockCacheSelfModifyingCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+	}{
+		{"write to the running block", []byte{
+			0xA2, 0x0A, // 200: i := 0x20A
+			0x60, 0x73, // 202: v0 := 0x73
+			0x61, 0x05, // 204: v1 := 0x05
+			0xF1, 0x55, // 206: save v1, 0x20A becomes v3 += 5
+			0x73, 0x01, // 208: v3 += 1
+			0x74, 0x01, // 20A: v4 += 1
+			0x12, 0x00, // 20C: jump 0x200
+		}},
+		{"write to another block", []byte{
+			0xA2, 0x0F, // 200: i := 0x20F
+			0x22, 0x0C, // 202: call 0x20C
+			0x80, 0x30, // 204: v0 := v3
+			0xF0, 0x55, // 206: save v0, changes the operand of 0x20E
+			0x73, 0x01, // 208: v3 += 1
+			0x12, 0x02, // 20A: jump 0x202
+			0x74, 0x01, // 20C: v4 += 1
+			0x75, 0x00, // 20E: v5 += <written by save>
+			0x00, 0xEE, // 210: return
+		}},
+		{"invalid opcode", []byte{
+			0x60, 0x01, // 200: v0 := 1
+			0x70, 0x01, // 202: v0 += 1
+			0xFF, 0xFF, // 204: invalid
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runBoth(t, func(c8 *Chip8) error { return c8.LoadBytes(tt.program) }, Quirks{}, 20)
+		})
+	}
+}
+
+func TestBlockCacheInvalidation(t *testing.T) {
+	c8 := New()
+	c8.SetBlockCache(true)
+	if err := c8.LoadBytes([]byte{0x60, 0x01, 0x70, 0x01, 0x12, 0x02}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := c8.lookup(0x200)
+	if b == nil || len(b.ops) != 3 || b.end != 0x206 {
+		t.Fatalf("lookup(0x200) = %+v, want a block of 3 instructions", b)
+	}
+
+	c8.blocks.invalidate(0x206, 2)
+	if !b.valid || c8.blocks.blocks[0x200] != b {
+		t.Errorf("a write after the block invalidated it")
+	}
+
+	c8.blocks.invalidate(0x205, 1)
+	if b.valid || c8.blocks.blocks[0x200] != nil || c8.blocks.coverage[0x200] != 0 {
+		t.Errorf("a write to the block did not invalidate it")
+	}
+}
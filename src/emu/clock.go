@@ -0,0 +1,86 @@
+package emu
+
+const (
+	// TimerFrequency is the rate (in Hz) at which the delay and sound timers count down.
+	// It is also the rate at which frames are produced by RunFrame.
+	TimerFrequency = 60
+
+	// DefaultClockSpeed is the default number of instructions executed per second.
+	DefaultClockSpeed = 600
+)
+
+// SetClockSpeed sets how many instructions per second the CPU executes.
+// Values lower than the timer frequency are clamped so that at least one
+// instruction runs every frame.
+func (c8 *Chip8) SetClockSpeed(instructionsPerSecond int) {
+	if instructionsPerSecond < TimerFrequency {
+		instructionsPerSecond = TimerFrequency
+	}
+
+	c8.clockSpeed = instructionsPerSecond
+	c8.cycleDebt = 0
+}
+
+// SetInstructionsPerFrame sets the CPU clock as a number of instructions
+// executed for every 60 Hz frame.
+func (c8 *Chip8) SetInstructionsPerFrame(instructionsPerFrame int) {
+	c8.SetClockSpeed(instructionsPerFrame * TimerFrequency)
+}
+
+// ClockSpeed returns the number of instructions executed per second.
+func (c8 *Chip8) ClockSpeed() int {
+	return c8.clockSpeed
+}
+
+// Tick updates the delay and sound timers.
+// It should be called at TimerFrequency, independently of how many instructions are executed.
+func (c8 *Chip8) Tick() {
+	c8.vblank = true
+
+	if c8.delayt > 0 {
+		c8.delayt--
+		if c8.delayt == 0 && c8.observer != nil {
+			c8.observer.Timer(TimerDelay, false)
+		}
+	}
+
+	if c8.soundt > 0 {
+		c8.soundt--
+		if c8.soundt == 0 && c8.observer != nil {
+			c8.observer.Timer(TimerSound, false)
+		}
+	}
+}
+
+// RunFrame emulates a single 60 Hz frame: it executes as many instructions
+// as the clock speed allows in 1/60th of a second, then ticks the timers once.
+// When the clock speed is not a multiple of 60, the remainder is carried over
+// to the following frames so that the average speed is respected.
+// If an instruction fails, the frame is interrupted and the error returned without ticking the timers.
+func (c8 *Chip8) RunFrame() error {
+	c8.cycleDebt += c8.clockSpeed
+	steps := c8.cycleDebt / TimerFrequency
+	c8.cycleDebt %= TimerFrequency
+
+	if err := c8.run(steps); err != nil {
+		return err
+	}
+
+	c8.Tick()
+	return nil
+}
+
+// run executes the given number of instructions, through the block cache if enabled.
+func (c8 *Chip8) run(steps int) error {
+	if c8.blocks != nil && c8.tracer == nil && c8.observer == nil {
+		return c8.runBlocks(steps)
+	}
+
+	for i := 0; i < steps; i++ {
+		if err := c8.Step(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
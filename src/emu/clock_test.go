@@ -0,0 +1,70 @@
+package emu
+
+import (
+	"testing"
+)
+
+// loopRom is a program that jumps to itself forever: 1200 (jump 0x200).
+var loopRom = []uint8{0x12, 0x00}
+
+func newLoopingChip8() *Chip8 {
+	c8 := New()
+	copy(c8.memory[0x200:], loopRom)
+	return c8
+}
+
+func TestRunFrameTicksTimersOnce(t *testing.T) {
+	tests := []struct {
+		name      string
+		speed     int
+		wantDelay uint8
+	}{
+		{"slow clock", 60, 9},
+		{"default clock", DefaultClockSpeed, 9},
+		{"fast clock", 6000, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c8 := newLoopingChip8()
+			c8.SetClockSpeed(tt.speed)
+			c8.delayt = 10
+
+			c8.RunFrame()
+
+			if c8.delayt != tt.wantDelay {
+				t.Errorf("RunFrame() delay = %v, want %v", c8.delayt, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestStepDoesNotTouchTimers(t *testing.T) {
+	c8 := newLoopingChip8()
+	c8.delayt = 10
+	c8.soundt = 10
+
+	for i := 0; i < 100; i++ {
+		c8.Step()
+	}
+
+	if c8.delayt != 10 || c8.soundt != 10 {
+		t.Errorf("Step() changed timers: delay = %v, sound = %v", c8.delayt, c8.soundt)
+	}
+}
+
+func TestRunFrameCarriesFractionalInstructions(t *testing.T) {
+	// 90 instructions per second is 1.5 instructions per frame
+	c8 := New()
+	for i := 0x200; i < 0x300; i += 2 {
+		// 6000: V0 = 0, a harmless instruction that advances the PC
+		c8.memory[i] = 0x60
+	}
+	c8.SetClockSpeed(90)
+
+	c8.RunFrame()
+	c8.RunFrame()
+
+	if c8.pc != 0x200+3*2 {
+		t.Errorf("after two frames pc = %#x, want %#x", c8.pc, 0x200+3*2)
+	}
+}
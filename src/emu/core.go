@@ -2,16 +2,28 @@ package emu
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
+	"os"
 
 	"github.com/valep27/GChip8/src/util"
 )
 
 const (
-	memorySize      = 4096
-	vramSize        = 64 * 32
+	memorySize      = 0x10000
+	programStart    = 0x200
+	lowresWidth     = 64
+	lowresHeight    = 32
+	hiresWidth      = 128
+	hiresHeight     = 64
+	vramSize        = hiresWidth * hiresHeight
 	registersNumber = 16
+	keysNumber      = 16
+	noKey           = 0xFF
 	stackSize       = 16
+	rplFlagsNumber  = 16
+	bigFontAddr     = 0x50
 )
 
 // Sprites representing hex numbers from 0 to F
@@ -34,6 +46,27 @@ var fontSet = [...]uint8{
 	0xF0, 0x80, 0xF0, 0x80, 0x80, // F
 }
 
+// Big sprites representing hex numbers from 0 to F, used by SUPER-CHIP.
+// They are 8x10 pixels and are stored in memory starting at bigFontAddr.
+var bigFontSet = [...]uint8{
+	0x3C, 0x7E, 0xE7, 0xC3, 0xC3, 0xC3, 0xC3, 0xE7, 0x7E, 0x3C, // 0
+	0x18, 0x38, 0x58, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x3C, // 1
+	0x3E, 0x7F, 0xC3, 0x06, 0x0C, 0x18, 0x30, 0x60, 0xFF, 0xFF, // 2
+	0x3C, 0x7E, 0xC3, 0x03, 0x0E, 0x0E, 0x03, 0xC3, 0x7E, 0x3C, // 3
+	0x06, 0x0E, 0x1E, 0x36, 0x66, 0xC6, 0xFF, 0xFF, 0x06, 0x06, // 4
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFC, 0xFE, 0x03, 0xC3, 0x7E, 0x3C, // 5
+	0x3E, 0x7C, 0xE0, 0xC0, 0xFC, 0xFE, 0xC3, 0xC3, 0x7E, 0x3C, // 6
+	0xFF, 0xFF, 0x03, 0x06, 0x0C, 0x18, 0x30, 0x60, 0x60, 0x60, // 7
+	0x3C, 0x7E, 0xC3, 0xC3, 0x7E, 0x7E, 0xC3, 0xC3, 0x7E, 0x3C, // 8
+	0x3C, 0x7E, 0xC3, 0xC3, 0x7F, 0x3F, 0x03, 0x03, 0x3E, 0x7C, // 9
+	0x7E, 0xFF, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xC3, // A
+	0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, // B
+	0x3C, 0xFF, 0xC3, 0xC0, 0xC0, 0xC0, 0xC0, 0xC3, 0xFF, 0x3C, // C
+	0xFC, 0xFE, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFE, 0xFC, // D
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // E
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xC0, 0xC0, // F
+}
+
 // Chip8 is the main struct holding all data relevant to the emulator.
 // This includes registers (V0 to VF, PC, etc.), ram and framebuffer.
 type Chip8 struct {
@@ -50,83 +83,246 @@ type Chip8 struct {
 	opcode   uint16
 	drawFlag bool
 	stopped  bool
+
+	// clockSpeed is the number of instructions executed per second,
+	// cycleDebt keeps track of fractional instructions between frames.
+	clockSpeed int
+	cycleDebt  int
+
+	// quirks selects the behaviour of ambiguous instructions,
+	// vblank is set by every timer tick and is used to implement the display wait quirk.
+	quirks Quirks
+	vblank bool
+
+	// SUPER-CHIP state: high resolution mode, RPL user flags
+	// and whether the program exited through 00FD.
+	hires  bool
+	rpl    []uint8
+	exited bool
+
+	// planes is the bitmask of the XO-CHIP bitplanes selected for drawing.
+	planes uint8
+
+	// XO-CHIP audio: the 1-bit sample pattern played while the sound timer
+	// is active and the pitch register that controls its playback rate.
+	pattern [patternSize]uint8
+	pitch   uint8
+
+	// fault is the error raised by the instruction being executed, if any.
+	fault error
+
+	// FX0A state: while stopped, keyWaitReg is the register receiving the key
+	// and keyWaitKey is the key pressed so far (noKey if none) when waiting for its release.
+	keyWaitReg uint8
+	keyWaitKey uint8
+
+	// rng is the random source used by CXNN, owned by this machine.
+	rng rand.Source
+
+	// tracer, if set, is called after every instruction executed by Step.
+	tracer     TraceFunc
+	traceEntry TraceEntry
+
+	// observer, if set, receives the events of the machine.
+	observer Observer
+
+	// blocks, if set, caches the blocks of instructions run by RunFrame.
+	blocks *blockCache
 }
 
-// OpcodeFunc is a function that implements an opcode for Chip8
-type OpcodeFunc func(*Chip8)
+// OpcodeFunc is a function that implements an opcode for Chip8,
+// receiving the decoded instruction.
+type OpcodeFunc func(*Chip8, Instruction)
 
 // New initializes basic Chip8 data, but the emulator won't be in a runnable
 // state until something is loaded.
 func New() *Chip8 {
 	c8 := &Chip8{
-		0,
-		0x200,
-		0,
-		make([]uint16, stackSize, stackSize),
-		make([]uint8, registersNumber, registersNumber),
-		make([]uint8, memorySize, memorySize),
-		make([]uint8, vramSize, vramSize),
-		make([]uint8, 16, 16),
-		0,
-		0,
-		0,
-		false,
-		false,
+		stack:      make([]uint16, stackSize, stackSize),
+		V:          make([]uint8, registersNumber, registersNumber),
+		memory:     make([]uint8, memorySize, memorySize),
+		vram:       make([]uint8, vramSize, vramSize),
+		keypad:     make([]uint8, keysNumber, keysNumber),
+		clockSpeed: DefaultClockSpeed,
+		rpl:        make([]uint8, rplFlagsNumber, rplFlagsNumber),
+		rng:        NewRandSource(timeSeed()),
 	}
 
-	for i := 0; i < len(fontSet); i++ {
-		c8.memory[i] = fontSet[i]
+	c8.Reset()
+	return c8
+}
+
+// Reset brings the machine back to its power-on state, as returned by New:
+// registers, memory, screen and keypad are cleared and the fonts are reloaded.
+// The configuration (clock speed, quirks and random source) is kept, and no memory is reallocated.
+// A program must be loaded again after a reset.
+func (c8 *Chip8) Reset() {
+	c8.I = 0
+	c8.pc = programStart
+	c8.sp = 0
+	c8.delayt = 0
+	c8.soundt = 0
+	c8.opcode = 0
+	c8.drawFlag = false
+	c8.stopped = false
+	c8.cycleDebt = 0
+	c8.vblank = false
+	c8.hires = false
+	c8.exited = false
+	c8.planes = plane1
+	c8.pattern = defaultPattern
+	c8.pitch = defaultPitch
+	c8.fault = nil
+	c8.keyWaitReg = 0
+	c8.keyWaitKey = noKey
+
+	clear16(c8.stack)
+	clear8(c8.V)
+	clear8(c8.memory)
+	clear8(c8.vram)
+	clear8(c8.keypad)
+	clear8(c8.rpl)
+
+	copy(c8.memory, fontSet[:])
+	copy(c8.memory[bigFontAddr:], bigFontSet[:])
+	c8.flushBlocks()
+}
+
+func clear8(s []uint8) {
+	for i := range s {
+		s[i] = 0
 	}
+}
 
-	return c8
+func clear16(s []uint16) {
+	for i := range s {
+		s[i] = 0
+	}
 }
 
 // LoadRom will load a rom file in memory, starting at address 0x200 (512).
-func (c8 *Chip8) LoadRom(path string) {
-	buffer, err := ioutil.ReadFile(path)
+// The whole 64 KB XO-CHIP address space is available, so roms can be larger than 3.5 KB.
+// An error wrapping ErrRomTooLarge is returned if the rom does not fit in memory.
+func (c8 *Chip8) LoadRom(path string) error {
+	file, err := os.Open(path)
 
 	if err != nil {
-		panic(fmt.Sprintf("Cannot read file %v, error: %s\n", path, err.Error()))
+		return fmt.Errorf("cannot read rom %s: %w", path, err)
 	}
+	defer file.Close()
 
-	for i := 0; i < len(buffer); i++ {
-		c8.memory[0x200+i] = buffer[i]
+	if err := c8.LoadProgram(file); err != nil {
+		return fmt.Errorf("cannot load rom %s: %w", path, err)
 	}
+
+	return nil
 }
 
-// Step executes a single cycle of emulation.
-func (c8 *Chip8) Step() {
-	if c8.stopped {
-		return
+// LoadProgram reads a program from r and loads it in memory at address 0x200.
+func (c8 *Chip8) LoadProgram(r io.Reader) error {
+	return c8.LoadProgramAt(r, programStart)
+}
+
+// LoadProgramAt reads a program from r and loads it in memory at the given address,
+// which is also where execution will start.
+// Reading stops with an error wrapping ErrRomTooLarge as soon as the program
+// goes past the end of memory.
+func (c8 *Chip8) LoadProgramAt(r io.Reader, addr uint16) error {
+	if err := checkLoadAddress(addr); err != nil {
+		return err
+	}
+
+	maxSize := int64(memorySize - int(addr))
+	program, err := ioutil.ReadAll(io.LimitReader(r, maxSize+1))
+
+	if err != nil {
+		return err
+	}
+
+	return c8.LoadBytesAt(program, addr)
+}
+
+// LoadBytes loads a program in memory at address 0x200.
+func (c8 *Chip8) LoadBytes(program []byte) error {
+	return c8.LoadBytesAt(program, programStart)
+}
+
+// LoadBytesAt loads a program in memory at the given address, which is also where execution will start.
+// Addresses below 0x200 are reserved to the interpreter and return ErrInvalidLoadAddress,
+// programs not fitting between the address and the end of memory return ErrRomTooLarge.
+// Nothing is written to memory if an error is returned.
+func (c8 *Chip8) LoadBytesAt(program []byte, addr uint16) error {
+	if err := checkLoadAddress(addr); err != nil {
+		return err
+	}
+
+	if maxSize := memorySize - int(addr); len(program) > maxSize {
+		return fmt.Errorf("%w: program is %d bytes, maximum at %#04x is %d", ErrRomTooLarge, len(program), addr, maxSize)
+	}
+
+	copy(c8.memory[addr:], program)
+	c8.flushBlocks()
+	c8.pc = addr
+	return nil
+}
+
+func checkLoadAddress(addr uint16) error {
+	if addr < programStart {
+		return fmt.Errorf("%w: %#04x is below %#04x", ErrInvalidLoadAddress, addr, programStart)
+	}
+
+	return nil
+}
+
+// Step executes a single instruction.
+// Timers are not affected: they are updated separately by Tick.
+// If the instruction cannot be executed, an *ExecError is returned and the machine state is left
+// as it was before the instruction, so the error is returned again by the following calls.
+func (c8 *Chip8) Step() error {
+	if c8.tracer != nil {
+		return c8.traceStep()
+	}
+
+	return c8.step()
+}
+
+// step executes a single instruction, as documented by Step.
+func (c8 *Chip8) step() error {
+	if c8.stopped || c8.exited {
+		return nil
 	}
 
 	// fetch
+	if int(c8.pc)+2 > len(c8.memory) {
+		return &ExecError{c8.pc, 0, ErrMemoryOutOfBounds}
+	}
+
 	opcode := util.CombineBytes(c8.memory[c8.pc+1], c8.memory[c8.pc])
 	c8.opcode = opcode
 
+	if c8.observer != nil {
+		c8.observer.Fetch(c8.pc, opcode)
+	}
+
 	// decode
-	instr, ok := Decode(opcode)
+	in := instructions[opcode]
 
-	if ok {
-		// exec
-		instr(c8)
-	} else {
+	if in.Op == OpInvalid {
 		// opcode not found
-		panic(fmt.Sprintf("No instruction for opcode: %v", opcode))
+		return &ExecError{c8.pc, opcode, ErrUnknownOpcode}
 	}
 
-	// update timers
-	if c8.delayt > 0 {
-		c8.delayt--
-	}
+	// exec
+	pc := c8.pc
+	handlers[in.Op](c8, in)
 
-	if c8.soundt > 0 {
-		if c8.soundt == 1 {
-			// TODO beep boop
-			fmt.Println("BOOP")
-		}
-		c8.soundt--
+	if c8.fault != nil {
+		err := &ExecError{pc, opcode, c8.fault}
+		c8.fault = nil
+		return err
 	}
+
+	return nil
 }
 
 // IsKeyPressed checks whether key 0 to 15 was pressed on the keypad.
@@ -135,23 +331,60 @@ func (c8 *Chip8) IsKeyPressed(key uint8) bool {
 }
 
 // GetPixelFrameBuffer returns a slice representing the framebuffer.
-// Every element in the slice represents one pixel color, which can be 0 (black) or 1 (white).
+// Every element in the slice represents one pixel color, which can be 0 (black) or 1 (white),
+// or up to 3 when both XO-CHIP bitplanes are in use: bit 0 is the first plane, bit 1 the second one.
+// The size of the framebuffer depends on the current resolution, see Resolution.
 func (c8 *Chip8) GetPixelFrameBuffer() []uint8 {
-	return c8.vram
+	width, height := c8.Resolution()
+	return c8.vram[:width*height]
+}
+
+// Exited returns true if the program terminated through the SUPER-CHIP exit instruction (00FD).
+func (c8 *Chip8) Exited() bool {
+	return c8.exited
 }
 
 // HandleKeyEvent alters the interpreter keypad memory according to the passed event data.
+// If the interpreter is waiting for a key (FX0A), the event may also resume execution.
 func (c8 *Chip8) HandleKeyEvent(key uint8, up bool) {
 	// skip command keys (quit, none, etc.)
 	if key > 0xF {
 		return
 	}
 
-	c8.stopped = false
-
 	if up {
 		c8.keypad[key] = 0
 	} else {
 		c8.keypad[key] = 1
 	}
+
+	if c8.stopped {
+		c8.handleKeyWait(key, up)
+	}
+}
+
+// IsWaitingForKey returns true while the interpreter is halted by FX0A.
+func (c8 *Chip8) IsWaitingForKey() bool {
+	return c8.stopped
+}
+
+// handleKeyWait resumes execution after FX0A, when a key is pressed or,
+// with the KeyWaitRelease quirk, when the first key pressed is released.
+func (c8 *Chip8) handleKeyWait(key uint8, up bool) {
+	switch {
+	case !up && !c8.quirks.KeyWaitRelease:
+		c8.resumeAfterKeyWait(key)
+	case !up && c8.keyWaitKey == noKey:
+		c8.keyWaitKey = key
+	case up && c8.quirks.KeyWaitRelease && key == c8.keyWaitKey:
+		c8.resumeAfterKeyWait(key)
+	}
+}
+
+// resumeAfterKeyWait stores the key in the register given to FX0A and moves past the instruction.
+func (c8 *Chip8) resumeAfterKeyWait(key uint8) {
+	c8.V[c8.keyWaitReg] = key
+	c8.keyWaitKey = noKey
+	c8.stopped = false
+	c8.pc += 2
 }
@@ -0,0 +1,142 @@
+package emu
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestLoadBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		addr    uint16
+		wantErr error
+	}{
+		{"small program", 10, 0x200, nil},
+		{"fills memory", memorySize - 0x200, 0x200, nil},
+		{"too large", memorySize - 0x200 + 1, 0x200, ErrRomTooLarge},
+		{"ETI-660 address", 10, 0x600, nil},
+		{"too large at high address", memorySize - 0x600 + 1, 0x600, ErrRomTooLarge},
+		{"interpreter area", 10, 0x100, ErrInvalidLoadAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := bytes.Repeat([]byte{0xAB}, tt.size)
+
+			for _, load := range []func(*Chip8) error{
+				func(c8 *Chip8) error { return c8.LoadBytesAt(program, tt.addr) },
+				func(c8 *Chip8) error { return c8.LoadProgramAt(bytes.NewReader(program), tt.addr) },
+			} {
+				c8 := New()
+				err := load(c8)
+
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("load error = %v, want %v", err, tt.wantErr)
+				}
+				if err != nil {
+					if c8.memory[tt.addr] != 0 {
+						t.Errorf("memory written after a failed load")
+					}
+					continue
+				}
+				if c8.pc != tt.addr || c8.memory[tt.addr] != 0xAB || c8.memory[int(tt.addr)+tt.size-1] != 0xAB {
+					t.Errorf("program not loaded at %#x", tt.addr)
+				}
+			}
+		})
+	}
+}
+
+func TestReset(t *testing.T) {
+	c8 := New()
+	c8.SetClockSpeed(1200)
+	c8.SetQuirks(QuirksCosmacVIP)
+	if err := c8.LoadBytes([]byte{0x00, 0xFF, 0x60, 0x12, 0xA3, 0x00, 0x22, 0x08}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := c8.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	memory, vram := &c8.memory[0], &c8.vram[0]
+
+	c8.Reset()
+
+	fresh := New()
+	if c8.pc != fresh.pc || c8.sp != fresh.sp || c8.I != fresh.I || c8.V[0] != 0 || c8.hires {
+		t.Errorf("registers not reset: pc = %#x, sp = %v, I = %#x, V0 = %v", c8.pc, c8.sp, c8.I, c8.V[0])
+	}
+	if !bytes.Equal(c8.memory, fresh.memory) {
+		t.Errorf("memory not reset")
+	}
+	if &c8.memory[0] != memory || &c8.vram[0] != vram {
+		t.Errorf("Reset() reallocated memory")
+	}
+	if c8.ClockSpeed() != 1200 || c8.Quirks() != QuirksCosmacVIP {
+		t.Errorf("Reset() changed the configuration")
+	}
+}
+
+func TestWaitForKey(t *testing.T) {
+	type event struct {
+		key uint8
+		up  bool
+	}
+	tests := []struct {
+		name        string
+		quirks      Quirks
+		events      []event
+		wantWaiting bool
+		wantV3      uint8
+	}{
+		{"no events", Quirks{}, nil, true, 0},
+		{"release does not resume", Quirks{}, []event{{5, true}}, true, 0},
+		{"press resumes", Quirks{}, []event{{5, false}}, false, 5},
+		{"press waits for release", Quirks{KeyWaitRelease: true}, []event{{5, false}}, true, 0},
+		{"release of another key", Quirks{KeyWaitRelease: true}, []event{{5, false}, {6, false}, {6, true}}, true, 0},
+		{"press and release resumes", Quirks{KeyWaitRelease: true}, []event{{5, false}, {5, true}}, false, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c8 := New()
+			c8.SetQuirks(tt.quirks)
+			// V0 = 10, delay timer = V0, wait for key in V3
+			if err := c8.LoadBytes([]byte{0x60, 0x0A, 0xF0, 0x15, 0xF3, 0x0A}); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 3; i++ {
+				if err := c8.Step(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// timers keep running while waiting
+			for i := 0; i < 3; i++ {
+				if err := c8.RunFrame(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if c8.delayt != 7 {
+				t.Errorf("delay timer = %v while waiting, want 7", c8.delayt)
+			}
+
+			for _, e := range tt.events {
+				c8.HandleKeyEvent(e.key, e.up)
+			}
+
+			if c8.IsWaitingForKey() != tt.wantWaiting || c8.V[3] != tt.wantV3 {
+				t.Errorf("waiting = %v, V3 = %v, want %v, %v", c8.IsWaitingForKey(), c8.V[3], tt.wantWaiting, tt.wantV3)
+			}
+
+			wantPC := uint16(0x206)
+			if tt.wantWaiting {
+				wantPC = 0x204
+			}
+			if c8.pc != wantPC {
+				t.Errorf("pc = %#x, want %#x", c8.pc, wantPC)
+			}
+		})
+	}
+}
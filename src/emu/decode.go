@@ -0,0 +1,435 @@
+package emu
+
+import "strconv"
+
+// Op identifies an instruction independently of its operands.
+// It is the result of decoding an opcode, shared by the interpreter and the tools
+// that inspect programs, like the disassembler.
+type Op uint8
+
+// The instructions understood by the emulator, named after the opcode they decode.
+const (
+	OpInvalid Op = iota
+	Op00E0       // clear the screen
+	Op00EE       // return from subroutine
+	Op00CN       // scroll down N pixels
+	Op00FB       // scroll right
+	Op00FC       // scroll left
+	Op00FD       // exit
+	Op00FE       // low resolution
+	Op00FF       // high resolution
+	Op1NNN       // jump
+	Op2NNN       // call subroutine
+	Op3XNN       // skip if Vx == NN
+	Op4XNN       // skip if Vx != NN
+	Op5XY0       // skip if Vx == Vy
+	Op5XY2       // save Vx to Vy
+	Op5XY3       // load Vx to Vy
+	Op6XNN       // Vx = NN
+	Op7XNN       // Vx += NN
+	Op8XY0       // Vx = Vy
+	Op8XY1       // Vx |= Vy
+	Op8XY2       // Vx &= Vy
+	Op8XY3       // Vx ^= Vy
+	Op8XY4       // Vx += Vy
+	Op8XY5       // Vx -= Vy
+	Op8XY6       // Vx >>= 1
+	Op8XY7       // Vx = Vy - Vx
+	Op8XYE       // Vx <<= 1
+	Op9XY0       // skip if Vx != Vy
+	OpANNN       // I = NNN
+	OpBNNN       // jump to NNN + V0
+	OpCXNN       // Vx = rand() & NN
+	OpDXYN       // draw sprite
+	OpEX9E       // skip if key Vx is pressed
+	OpEXA1       // skip if key Vx is not pressed
+	OpF000       // I = NNNN, the following 16 bits
+	OpFN01       // select planes
+	OpF002       // load audio pattern
+	OpFX07       // Vx = delay timer
+	OpFX0A       // wait for key
+	OpFX15       // delay timer = Vx
+	OpFX18       // sound timer = Vx
+	OpFX1E       // I += Vx
+	OpFX29       // I = font sprite of Vx
+	OpFX30       // I = big font sprite of Vx
+	OpFX33       // store BCD of Vx
+	OpFX3A       // pitch = Vx
+	OpFX55       // store V0 to Vx
+	OpFX65       // load V0 to Vx
+	OpFX75       // save V0 to Vx in the RPL flags
+	OpFX85       // load V0 to Vx from the RPL flags
+	opCount
+)
+
+// opNames holds the name of every instruction, the opcode pattern it decodes.
+var opNames = [opCount]string{
+	OpInvalid: "invalid",
+	Op00E0:    "00E0",
+	Op00EE:    "00EE",
+	Op00CN:    "00CN",
+	Op00FB:    "00FB",
+	Op00FC:    "00FC",
+	Op00FD:    "00FD",
+	Op00FE:    "00FE",
+	Op00FF:    "00FF",
+	Op1NNN:    "1NNN",
+	Op2NNN:    "2NNN",
+	Op3XNN:    "3XNN",
+	Op4XNN:    "4XNN",
+	Op5XY0:    "5XY0",
+	Op5XY2:    "5XY2",
+	Op5XY3:    "5XY3",
+	Op6XNN:    "6XNN",
+	Op7XNN:    "7XNN",
+	Op8XY0:    "8XY0",
+	Op8XY1:    "8XY1",
+	Op8XY2:    "8XY2",
+	Op8XY3:    "8XY3",
+	Op8XY4:    "8XY4",
+	Op8XY5:    "8XY5",
+	Op8XY6:    "8XY6",
+	Op8XY7:    "8XY7",
+	Op8XYE:    "8XYE",
+	Op9XY0:    "9XY0",
+	OpANNN:    "ANNN",
+	OpBNNN:    "BNNN",
+	OpCXNN:    "CXNN",
+	OpDXYN:    "DXYN",
+	OpEX9E:    "EX9E",
+	OpEXA1:    "EXA1",
+	OpF000:    "F000",
+	OpFN01:    "FN01",
+	OpF002:    "F002",
+	OpFX07:    "FX07",
+	OpFX0A:    "FX0A",
+	OpFX15:    "FX15",
+	OpFX18:    "FX18",
+	OpFX1E:    "FX1E",
+	OpFX29:    "FX29",
+	OpFX30:    "FX30",
+	OpFX33:    "FX33",
+	OpFX3A:    "FX3A",
+	OpFX55:    "FX55",
+	OpFX65:    "FX65",
+	OpFX75:    "FX75",
+	OpFX85:    "FX85",
+}
+
+// String returns the opcode pattern of the instruction, like "8XY4", or "invalid".
+func (op Op) String() string {
+	if op >= opCount {
+		return "invalid"
+	}
+
+	return opNames[op]
+}
+
+// IsSkip returns true if the instruction can skip the following one.
+func (op Op) IsSkip() bool {
+	switch op {
+	case Op3XNN, Op4XNN, Op5XY0, Op9XY0, OpEX9E, OpEXA1:
+		return true
+	}
+
+	return false
+}
+
+// EndsBlock returns true if the instruction can continue anywhere but the following one:
+// jumps, calls, returns, exit and skips.
+func (op Op) EndsBlock() bool {
+	switch op {
+	case Op00EE, Op00FD, Op1NNN, Op2NNN, OpBNNN:
+		return true
+	}
+
+	return op.IsSkip()
+}
+
+// Size returns the size in bytes of the instruction, including its operands.
+func (op Op) Size() uint16 {
+	if op == OpF000 {
+		return 4
+	}
+
+	return 2
+}
+
+// Instruction is a decoded opcode: the instruction it encodes, with its operands extracted.
+// The operands are extracted from every opcode, whether the instruction uses them or not.
+type Instruction struct {
+	Opcode uint16
+	Op     Op
+	// X and Y are the register operands, the second and third nibbles.
+	X, Y uint8
+	// N is the lowest nibble and NN the lowest byte.
+	N, NN uint8
+	// NNN is the address operand, the lowest 12 bits.
+	NNN uint16
+}
+
+// mnemonics holds the mnemonic of every instruction, as in Cowgod's CHIP-8 technical reference
+// and its SUPER-CHIP and XO-CHIP extensions.
+var mnemonics = [opCount]string{
+	OpInvalid: "DW",
+	Op00E0:    "CLS",
+	Op00EE:    "RET",
+	Op00CN:    "SCD",
+	Op00FB:    "SCR",
+	Op00FC:    "SCL",
+	Op00FD:    "EXIT",
+	Op00FE:    "LOW",
+	Op00FF:    "HIGH",
+	Op1NNN:    "JP",
+	Op2NNN:    "CALL",
+	Op3XNN:    "SE",
+	Op4XNN:    "SNE",
+	Op5XY0:    "SE",
+	Op5XY2:    "SAVE",
+	Op5XY3:    "LOAD",
+	Op6XNN:    "LD",
+	Op7XNN:    "ADD",
+	Op8XY0:    "LD",
+	Op8XY1:    "OR",
+	Op8XY2:    "AND",
+	Op8XY3:    "XOR",
+	Op8XY4:    "ADD",
+	Op8XY5:    "SUB",
+	Op8XY6:    "SHR",
+	Op8XY7:    "SUBN",
+	Op8XYE:    "SHL",
+	Op9XY0:    "SNE",
+	OpANNN:    "LD",
+	OpBNNN:    "JP",
+	OpCXNN:    "RND",
+	OpDXYN:    "DRW",
+	OpEX9E:    "SKP",
+	OpEXA1:    "SKNP",
+	OpF000:    "LD",
+	OpFN01:    "PLANE",
+	OpF002:    "AUDIO",
+	OpFX07:    "LD",
+	OpFX0A:    "LD",
+	OpFX15:    "LD",
+	OpFX18:    "LD",
+	OpFX1E:    "ADD",
+	OpFX29:    "LD",
+	OpFX30:    "LD",
+	OpFX33:    "LD",
+	OpFX3A:    "PITCH",
+	OpFX55:    "LD",
+	OpFX65:    "LD",
+	OpFX75:    "LD",
+	OpFX85:    "LD",
+}
+
+// Mnemonic returns the mnemonic of the instruction, like "ADD", or "DW" for invalid opcodes.
+func (in Instruction) Mnemonic() string {
+	return mnemonics[in.Op]
+}
+
+// Size returns the size in bytes of the instruction, including its operands.
+func (in Instruction) Size() uint16 {
+	return in.Op.Size()
+}
+
+// Canonical returns true if the opcode matches every fixed digit of the pattern of its
+// instruction. Some opcodes decode loosely, like 9XY1 as 9XY0 or 01E0 as 00E0:
+// an assembler writes them back as the canonical opcode, losing bits.
+func (in Instruction) Canonical() bool {
+	if in.Op == OpInvalid {
+		return false
+	}
+
+	pattern := opNames[in.Op]
+	for i := 0; i < len(pattern); i++ {
+		digit, err := strconv.ParseUint(pattern[i:i+1], 16, 8)
+		if err == nil && uint64(in.Opcode>>(12-4*i)&0xF) != digit {
+			return false
+		}
+	}
+
+	return true
+}
+
+// instructions holds the decoding of every possible opcode, computed once
+// so that the interpreter does not decode the same opcodes over and over.
+var instructions = decodeAll()
+
+func decodeAll() *[0x10000]Instruction {
+	var table [0x10000]Instruction
+
+	for i := range table {
+		opcode := uint16(i)
+		op, _ := decodeOp(opcode)
+		table[i] = Instruction{
+			Opcode: opcode,
+			Op:     op,
+			X:      uint8(opcode>>8) & 0xF,
+			Y:      uint8(opcode>>4) & 0xF,
+			N:      uint8(opcode) & 0xF,
+			NN:     uint8(opcode),
+			NNN:    opcode & 0x0FFF,
+		}
+	}
+
+	return &table
+}
+
+// Decode returns the instruction encoded by an opcode.
+// The second return value is false if the opcode is unknown, the instruction being OpInvalid.
+func Decode(opcode uint16) (Instruction, bool) {
+	in := instructions[opcode]
+	return in, in.Op != OpInvalid
+}
+
+// DecodeOp maps an opcode to the instruction it encodes, see Decode.
+func DecodeOp(opcode uint16) (op Op, ok bool) {
+	op = instructions[opcode].Op
+	return op, op != OpInvalid
+}
+
+// decodeOp maps an opcode to the instruction it encodes, filling the table of Decode.
+func decodeOp(opcode uint16) (op Op, ok bool) {
+	ok = true
+
+	switch opcode & 0xF000 {
+	case 0x0:
+		switch opcode & 0x00FF {
+		case 0xE0:
+			op = Op00E0
+		case 0xEE:
+			op = Op00EE
+		case 0xFB:
+			op = Op00FB
+		case 0xFC:
+			op = Op00FC
+		case 0xFD:
+			op = Op00FD
+		case 0xFE:
+			op = Op00FE
+		case 0xFF:
+			op = Op00FF
+		default:
+			if opcode&0x00F0 == 0xC0 {
+				op = Op00CN
+			} else {
+				ok = false
+			}
+		}
+	case 0x1000:
+		op = Op1NNN
+	case 0x2000:
+		op = Op2NNN
+	case 0x3000:
+		op = Op3XNN
+	case 0x4000:
+		op = Op4XNN
+	case 0x5000:
+		switch opcode & 0x000F {
+		case 0x0:
+			op = Op5XY0
+		case 0x2:
+			op = Op5XY2
+		case 0x3:
+			op = Op5XY3
+		default:
+			ok = false
+		}
+	case 0x6000:
+		op = Op6XNN
+	case 0x7000:
+		op = Op7XNN
+	case 0x8000:
+		switch opcode & 0x000F {
+		case 0x0:
+			op = Op8XY0
+		case 0x1:
+			op = Op8XY1
+		case 0x2:
+			op = Op8XY2
+		case 0x3:
+			op = Op8XY3
+		case 0x4:
+			op = Op8XY4
+		case 0x5:
+			op = Op8XY5
+		case 0x6:
+			op = Op8XY6
+		case 0x7:
+			op = Op8XY7
+		case 0xE:
+			op = Op8XYE
+		default:
+			ok = false
+		}
+	case 0x9000:
+		op = Op9XY0
+	case 0xA000:
+		op = OpANNN
+	case 0xB000:
+		op = OpBNNN
+	case 0xC000:
+		op = OpCXNN
+	case 0xD000:
+		op = OpDXYN
+	case 0xE000:
+		switch opcode & 0x00FF {
+		case 0x9E:
+			op = OpEX9E
+		case 0xA1:
+			op = OpEXA1
+		default:
+			ok = false
+		}
+	case 0xF000:
+		switch opcode & 0x00FF {
+		case 0x00:
+			if opcode == 0xF000 {
+				op = OpF000
+			} else {
+				ok = false
+			}
+		case 0x01:
+			op = OpFN01
+		case 0x02:
+			if opcode == 0xF002 {
+				op = OpF002
+			} else {
+				ok = false
+			}
+		case 0x07:
+			op = OpFX07
+		case 0x0A:
+			op = OpFX0A
+		case 0x15:
+			op = OpFX15
+		case 0x18:
+			op = OpFX18
+		case 0x1E:
+			op = OpFX1E
+		case 0x29:
+			op = OpFX29
+		case 0x30:
+			op = OpFX30
+		case 0x33:
+			op = OpFX33
+		case 0x3A:
+			op = OpFX3A
+		case 0x55:
+			op = OpFX55
+		case 0x65:
+			op = OpFX65
+		case 0x75:
+			op = OpFX75
+		case 0x85:
+			op = OpFX85
+		default:
+			ok = false
+		}
+	default:
+		ok = false
+	}
+
+	return
+}
@@ -0,0 +1,142 @@
+package emu
+
+import "github.com/valep27/GChip8/src/util"
+
+// XO-CHIP bitplanes. Each pixel in vram holds one bit per plane,
+// so its value goes from 0 (no plane set) to 3 (both planes set).
+const (
+	plane1 uint8 = 1 << iota
+	plane2
+)
+
+// Resolution returns the current width and height of the screen in pixels.
+// It is 64x32 in the default low resolution mode, 128x64 in SUPER-CHIP high resolution mode.
+func (c8 *Chip8) Resolution() (width, height int) {
+	if c8.hires {
+		return hiresWidth, hiresHeight
+	}
+
+	return lowresWidth, lowresHeight
+}
+
+// setHires switches between low and high resolution, clearing the screen.
+func (c8 *Chip8) setHires(hires bool) {
+	c8.hires = hires
+
+	for i := 0; i < len(c8.vram); i++ {
+		c8.vram[i] = 0
+	}
+
+	c8.drawFlag = true
+}
+
+// drawSprite xors a sprite of the given size (width is 8 or 16) read from memory at addr
+// on a single plane, with the top left corner at (x, y).
+// It returns true if any pixel of the plane was turned off.
+func (c8 *Chip8) drawSprite(x, y int, addr uint16, width, height int, plane uint8) (collision bool) {
+	screenWidth, screenHeight := c8.Resolution()
+	x %= screenWidth
+	y %= screenHeight
+
+	for row := 0; row < height; row++ {
+		var pixelRow uint16
+
+		if width == 16 {
+			rowAddr := addr + uint16(row*2)
+			pixelRow = util.CombineBytes(c8.memory[rowAddr+1], c8.memory[rowAddr])
+		} else {
+			pixelRow = uint16(c8.memory[addr+uint16(row)]) << 8
+		}
+
+		py := y + row
+
+		if py >= screenHeight {
+			if !c8.quirks.WrapSprites {
+				break
+			}
+			py %= screenHeight
+		}
+
+		for col := 0; col < width; col++ {
+			// check if pixel went from 0 to 1
+			colMask := uint16(0x8000 >> uint(col))
+			pixelUpdated := (colMask & pixelRow) != 0
+			px := x + col
+
+			if px >= screenWidth {
+				if !c8.quirks.WrapSprites {
+					break
+				}
+				px %= screenWidth
+			}
+
+			pixelAddress := px + py*screenWidth
+
+			if pixelUpdated {
+				// if pixel was already set, there's a collision
+				if c8.vram[pixelAddress]&plane != 0 {
+					collision = true
+				}
+
+				// flip the pixel
+				c8.vram[pixelAddress] ^= plane
+			}
+		}
+	}
+
+	return
+}
+
+// scrollPixel replaces the selected planes of the pixel at dst with the ones of src.
+func (c8 *Chip8) scrollPixel(dst int, src uint8) {
+	c8.vram[dst] = (c8.vram[dst] &^ c8.planes) | (src & c8.planes)
+}
+
+// scrollDown moves the content of the selected planes down by n pixels,
+// filling the top with blank pixels.
+func (c8 *Chip8) scrollDown(n int) {
+	width, height := c8.Resolution()
+
+	for y := height - 1; y >= 0; y-- {
+		for x := 0; x < width; x++ {
+			var pixel uint8
+			if y >= n {
+				pixel = c8.vram[x+(y-n)*width]
+			}
+			c8.scrollPixel(x+y*width, pixel)
+		}
+	}
+
+	c8.drawFlag = true
+}
+
+// scrollHorizontal moves the content of the selected planes by n pixels, right if n is positive,
+// left otherwise. Blank pixels are shifted in from the opposite side.
+func (c8 *Chip8) scrollHorizontal(n int) {
+	width, height := c8.Resolution()
+
+	for y := 0; y < height; y++ {
+		rowStart := y * width
+		row := c8.vram[rowStart : rowStart+width]
+
+		if n > 0 {
+			for x := width - 1; x >= 0; x-- {
+				var pixel uint8
+				if x >= n {
+					pixel = row[x-n]
+				}
+				c8.scrollPixel(rowStart+x, pixel)
+			}
+		} else {
+			for x := 0; x < width; x++ {
+				var pixel uint8
+				if x-n < width {
+					pixel = row[x-n]
+				}
+				c8.scrollPixel(rowStart+x, pixel)
+			}
+		}
+	}
+
+	c8.drawFlag = true
+}
@@ -0,0 +1,92 @@
+package emu
+
+import (
+	"testing"
+)
+
+// runProgram loads the given opcodes at 0x200 and executes them until the PC goes past them.
+func runProgram(c8 *Chip8, opcodes ...uint16) {
+	for i, opcode := range opcodes {
+		c8.memory[0x200+2*i] = uint8(opcode >> 8)
+		c8.memory[0x200+2*i+1] = uint8(opcode)
+	}
+
+	end := 0x200 + 2*len(opcodes)
+	for steps := 0; int(c8.pc) < end && steps < len(opcodes); steps++ {
+		c8.Step()
+	}
+}
+
+func TestHighResolution(t *testing.T) {
+	c8 := New()
+
+	runProgram(c8, 0x00FF)
+	if w, h := c8.Resolution(); w != 128 || h != 64 || len(c8.GetPixelFrameBuffer()) != 128*64 {
+		t.Errorf("after 00FF resolution = %vx%v, want 128x64", w, h)
+	}
+
+	c8 = New()
+	runProgram(c8, 0x00FF, 0x00FE)
+	if w, h := c8.Resolution(); w != 64 || h != 32 || len(c8.GetPixelFrameBuffer()) != 64*32 {
+		t.Errorf("after 00FE resolution = %vx%v, want 64x32", w, h)
+	}
+}
+
+func TestBigSprite(t *testing.T) {
+	c8 := New()
+	c8.I = 0x300
+	for i := 0; i < 32; i++ {
+		c8.memory[0x300+i] = 0xFF
+	}
+
+	// hires, then draw a 16x16 sprite at (120, 0): V0 = 120, V1 = 0
+	runProgram(c8, 0x00FF, 0x6078, 0x6100, 0xD010)
+
+	fb := c8.GetPixelFrameBuffer()
+	if fb[120] != 1 || fb[127] != 1 || fb[15*128+127] != 1 || fb[16*128+120] != 0 || fb[128] != 0 {
+		t.Errorf("16x16 sprite not drawn correctly")
+	}
+}
+
+func TestScroll(t *testing.T) {
+	tests := []struct {
+		name   string
+		opcode uint16
+		want   int
+	}{
+		{"scroll down 3", 0x00C3, 10 + 3*64},
+		{"scroll right", 0x00FB, 14},
+		{"scroll left", 0x00FC, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c8 := New()
+			c8.vram[10] = 1
+
+			runProgram(c8, tt.opcode)
+
+			for i, pixel := range c8.GetPixelFrameBuffer() {
+				if (pixel == 1) != (i == tt.want) {
+					t.Errorf("pixel %v = %v after %04X", i, pixel, tt.opcode)
+				}
+			}
+		})
+	}
+}
+
+func TestSuperChipMisc(t *testing.T) {
+	c8 := New()
+
+	// V0 = 1, V1 = 2, FX30 with V1, save flags, reset registers, load flags
+	runProgram(c8, 0x6001, 0x6102, 0xF130, 0xF175, 0x6000, 0x6100, 0xF185, 0x00FD, 0x6005)
+
+	if c8.I != bigFontAddr+20 {
+		t.Errorf("FX30 I = %#x, want %#x", c8.I, bigFontAddr+20)
+	}
+	if c8.V[0] != 1 || c8.V[1] != 2 {
+		t.Errorf("FX85 V0 = %v, V1 = %v, want 1, 2", c8.V[0], c8.V[1])
+	}
+	if !c8.Exited() || c8.pc != 0x20E {
+		t.Errorf("00FD did not stop the interpreter, pc = %#x", c8.pc)
+	}
+}
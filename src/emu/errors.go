@@ -0,0 +1,62 @@
+package emu
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the emulator.
+// Errors happening while executing an instruction are wrapped in an *ExecError,
+// so they can be checked with errors.Is and inspected with errors.As.
+var (
+	// ErrUnknownOpcode is returned when the fetched opcode is not a valid instruction.
+	ErrUnknownOpcode = errors.New("unknown opcode")
+	// ErrStackOverflow is returned when calling a subroutine with a full stack.
+	ErrStackOverflow = errors.New("stack overflow")
+	// ErrStackUnderflow is returned when returning from a subroutine with an empty stack.
+	ErrStackUnderflow = errors.New("stack underflow")
+	// ErrMemoryOutOfBounds is returned when an instruction accesses memory past the end of the address space.
+	ErrMemoryOutOfBounds = errors.New("memory access out of bounds")
+	// ErrRomTooLarge is returned when a rom does not fit in the program memory.
+	ErrRomTooLarge = errors.New("rom too large")
+	// ErrInvalidLoadAddress is returned when loading a program over the memory reserved to the interpreter.
+	ErrInvalidLoadAddress = errors.New("invalid load address")
+	// ErrInvalidSnapshot is returned when restoring a snapshot that is corrupted or in an unsupported format.
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+)
+
+// ExecError describes an error that happened while executing an instruction.
+type ExecError struct {
+	// PC is the address of the instruction.
+	PC uint16
+	// Opcode is the instruction that caused the error.
+	Opcode uint16
+	// Err is the cause of the error, one of the Err* values.
+	Err error
+}
+
+func (e *ExecError) Error() string {
+	return fmt.Sprintf("%s: opcode %04X at %#04x", e.Err, e.Opcode, e.PC)
+}
+
+// Unwrap returns the cause of the error.
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// fail records an error for the instruction being executed, which will be returned by Step.
+// The instruction should return right away without changing the machine state any further.
+func (c8 *Chip8) fail(err error) {
+	c8.fault = err
+}
+
+// checkMemory verifies that size bytes starting at addr are inside the address space,
+// recording ErrMemoryOutOfBounds otherwise.
+func (c8 *Chip8) checkMemory(addr uint16, size int) bool {
+	if int(addr)+size > len(c8.memory) {
+		c8.fail(ErrMemoryOutOfBounds)
+		return false
+	}
+
+	return true
+}
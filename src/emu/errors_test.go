@@ -0,0 +1,62 @@
+package emu
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestStepErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		opcode  uint16
+		setup   func(c8 *Chip8)
+		wantErr error
+	}{
+		{"unknown opcode", 0xFFFF, func(c8 *Chip8) {}, ErrUnknownOpcode},
+		{"stack overflow", 0x2200, func(c8 *Chip8) { c8.sp = stackSize }, ErrStackOverflow},
+		{"stack underflow", 0x00EE, func(c8 *Chip8) {}, ErrStackUnderflow},
+		{"register dump past memory end", 0xFF55, func(c8 *Chip8) { c8.I = 0xFFFA }, ErrMemoryOutOfBounds},
+		{"sprite past memory end", 0xD01F, func(c8 *Chip8) { c8.I = 0xFFFA }, ErrMemoryOutOfBounds},
+		{"BCD past memory end", 0xF033, func(c8 *Chip8) { c8.I = 0xFFFE }, ErrMemoryOutOfBounds},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c8 := New()
+			c8.memory[0x200] = uint8(tt.opcode >> 8)
+			c8.memory[0x201] = uint8(tt.opcode)
+			tt.setup(c8)
+
+			err := c8.Step()
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Step() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var execErr *ExecError
+			if !errors.As(err, &execErr) || execErr.PC != 0x200 || execErr.Opcode != tt.opcode {
+				t.Errorf("Step() error = %#v, want PC 0x200 and opcode %04X", err, tt.opcode)
+			}
+			if c8.pc != 0x200 {
+				t.Errorf("Step() moved pc to %#x after an error", c8.pc)
+			}
+		})
+	}
+}
+
+func TestLoadRomErrors(t *testing.T) {
+	dir := t.TempDir()
+	large := filepath.Join(dir, "large.ch8")
+	if err := ioutil.WriteFile(large, make([]uint8, memorySize), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := New().LoadRom(large); !errors.Is(err, ErrRomTooLarge) {
+		t.Errorf("LoadRom() error = %v, want %v", err, ErrRomTooLarge)
+	}
+
+	if err := New().LoadRom(filepath.Join(dir, "missing.ch8")); err == nil {
+		t.Errorf("LoadRom() of a missing file should fail")
+	}
+}
@@ -0,0 +1,102 @@
+package emu
+
+import "github.com/valep27/GChip8/src/util"
+
+// Registers is a copy of the CPU state, as shown by debuggers.
+type Registers struct {
+	V          [registersNumber]uint8
+	I          uint16
+	PC         uint16
+	SP         uint16
+	DelayTimer uint8
+	SoundTimer uint8
+	// Stack holds the address of the active subroutine calls, the outermost first.
+	// A subroutine returns to the instruction following its call.
+	Stack []uint16
+}
+
+// Registers returns a copy of the CPU registers and of the active part of the stack.
+func (c8 *Chip8) Registers() Registers {
+	r := Registers{
+		I:          c8.I,
+		PC:         c8.pc,
+		SP:         c8.sp,
+		DelayTimer: c8.delayt,
+		SoundTimer: c8.soundt,
+		Stack:      append([]uint16(nil), c8.stack[:c8.sp]...),
+	}
+	copy(r.V[:], c8.V)
+
+	return r
+}
+
+// ReadMemory returns a copy of size bytes of memory starting at addr,
+// truncated at the end of memory. A negative size reads nothing.
+func (c8 *Chip8) ReadMemory(addr uint16, size int) []byte {
+	if size < 0 {
+		size = 0
+	}
+
+	end := int(addr) + size
+	if end > memorySize {
+		end = memorySize
+	}
+
+	return append([]byte(nil), c8.memory[addr:end]...)
+}
+
+// MemoryAccess is a range of memory read or written by an instruction.
+type MemoryAccess struct {
+	Addr  uint16
+	Size  int
+	Write bool
+}
+
+// Contains returns true if addr falls inside the accessed range.
+func (a MemoryAccess) Contains(addr uint16) bool {
+	return int(addr) >= int(a.Addr) && int(addr) < int(a.Addr)+a.Size
+}
+
+// NextMemoryAccesses returns the data memory that the instruction at the PC will access
+// when executed, without executing it. Fetching the instruction itself is not included.
+// Debuggers use it to stop before the access happens.
+func (c8 *Chip8) NextMemoryAccesses() []MemoryAccess {
+	if c8.stopped || c8.exited || int(c8.pc)+2 > len(c8.memory) {
+		return nil
+	}
+
+	opcode := util.CombineBytes(c8.memory[c8.pc+1], c8.memory[c8.pc])
+	op, ok := DecodeOp(opcode)
+	if !ok {
+		return nil
+	}
+
+	x := int(opcode>>8) & 0xF
+	y := int(opcode>>4) & 0xF
+
+	switch op {
+	case OpFX55:
+		return []MemoryAccess{{c8.I, x + 1, true}}
+	case OpFX65:
+		return []MemoryAccess{{c8.I, x + 1, false}}
+	case OpFX33:
+		return []MemoryAccess{{c8.I, 3, true}}
+	case Op5XY2, Op5XY3:
+		size := y - x + 1
+		if x > y {
+			size = x - y + 1
+		}
+		return []MemoryAccess{{c8.I, size, op == Op5XY2}}
+	case OpF002:
+		return []MemoryAccess{{c8.I, patternSize, false}}
+	case OpDXYN:
+		height, width := int(opcode&0xF), 8
+		if height == 0 {
+			height, width = 16, 16
+		}
+		planes := int(c8.planes&plane1) + int(c8.planes&plane2)>>1
+		return []MemoryAccess{{c8.I, width / 8 * height * planes, false}}
+	}
+
+	return nil
+}
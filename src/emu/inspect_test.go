@@ -0,0 +1,65 @@
+package emu
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegisters(t *testing.T) {
+	c8 := New()
+	c8.LoadBytes([]byte{0x62, 0x07, 0xA3, 0x00, 0x22, 0x08, 0x00, 0x00, 0xF2, 0x15})
+	for i := 0; i < 4; i++ {
+		if err := c8.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := c8.Registers()
+	if r.V[2] != 7 || r.I != 0x300 || r.PC != 0x20A || r.DelayTimer != 7 {
+		t.Errorf("Registers() = %+v", r)
+	}
+	if !reflect.DeepEqual(r.Stack, []uint16{0x204}) || r.SP != 1 {
+		t.Errorf("stack = %v, sp = %d, want [0x204] and 1", r.Stack, r.SP)
+	}
+
+	if got := c8.ReadMemory(0x200, 2); !reflect.DeepEqual(got, []byte{0x62, 0x07}) {
+		t.Errorf("ReadMemory() = % X", got)
+	}
+	if got := c8.ReadMemory(0xFFFF, 4); len(got) != 1 {
+		t.Errorf("ReadMemory() at the end of memory returned %d bytes, want 1", len(got))
+	}
+	if got := c8.ReadMemory(0x200, -1); len(got) != 0 {
+		t.Errorf("ReadMemory() with a negative size returned %d bytes, want 0", len(got))
+	}
+}
+
+func TestNextMemoryAccesses(t *testing.T) {
+	tests := []struct {
+		name   string
+		opcode uint16
+		planes uint8
+		want   []MemoryAccess
+	}{
+		{"save", 0xF355, plane1, []MemoryAccess{{0x300, 4, true}}},
+		{"load", 0xF065, plane1, []MemoryAccess{{0x300, 1, false}}},
+		{"bcd", 0xF133, plane1, []MemoryAccess{{0x300, 3, true}}},
+		{"save range backwards", 0x5412, plane1, []MemoryAccess{{0x300, 4, true}}},
+		{"load range", 0x5143, plane1, []MemoryAccess{{0x300, 4, false}}},
+		{"audio", 0xF002, plane1, []MemoryAccess{{0x300, patternSize, false}}},
+		{"sprite", 0xD125, plane1, []MemoryAccess{{0x300, 5, false}}},
+		{"big sprite on two planes", 0xD120, plane1 | plane2, []MemoryAccess{{0x300, 64, false}}},
+		{"no access", 0x6123, plane1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c8 := New()
+			c8.LoadBytes([]byte{uint8(tt.opcode >> 8), uint8(tt.opcode)})
+			c8.I = 0x300
+			c8.planes = tt.planes
+
+			if got := c8.NextMemoryAccesses(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NextMemoryAccesses() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
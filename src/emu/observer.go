@@ -0,0 +1,96 @@
+package emu
+
+// TimerKind identifies one of the two timers.
+type TimerKind uint8
+
+// The timers.
+const (
+	TimerDelay TimerKind = iota
+	TimerSound
+)
+
+// Observer receives the events of a Chip8, for tools built on top of the core like
+// debuggers, cheat finders or achievement trackers.
+// Events are delivered synchronously while the machine runs: observers must not modify it,
+// and must copy the slices they receive to keep them.
+// Embed NopObserver to handle only some of the events.
+type Observer interface {
+	// Fetch is called when the instruction at pc is fetched, before it is executed.
+	// It is not called while waiting for a key or after the program has exited.
+	Fetch(pc, opcode uint16)
+	// MemoryRead is called for every byte of data read by an instruction, including sprites.
+	// Instruction fetches are not reported.
+	MemoryRead(addr uint16, value uint8)
+	// MemoryWrite is called for every byte written by an instruction, after it is written.
+	MemoryWrite(addr uint16, value uint8)
+	// Draw is called after DXYN draws sprite at (x, y), the values of VX and VY.
+	// The sprite holds the data of every selected XO-CHIP plane, one after the other.
+	// collision is the value given to VF.
+	Draw(x, y uint8, sprite []byte, collision bool)
+	// KeyQuery is called when EX9E or EXA1 checks whether a key is pressed.
+	KeyQuery(key uint8, pressed bool)
+	// Timer is called when a timer starts, being set to a non zero value while stopped,
+	// and when it stops, reaching zero. A running sound timer means that sound is playing.
+	Timer(timer TimerKind, running bool)
+}
+
+// NopObserver implements Observer ignoring every event.
+type NopObserver struct{}
+
+// Fetch implements Observer.
+func (NopObserver) Fetch(pc, opcode uint16) {}
+
+// MemoryRead implements Observer.
+func (NopObserver) MemoryRead(addr uint16, value uint8) {}
+
+// MemoryWrite implements Observer.
+func (NopObserver) MemoryWrite(addr uint16, value uint8) {}
+
+// Draw implements Observer.
+func (NopObserver) Draw(x, y uint8, sprite []byte, collision bool) {}
+
+// KeyQuery implements Observer.
+func (NopObserver) KeyQuery(key uint8, pressed bool) {}
+
+// Timer implements Observer.
+func (NopObserver) Timer(timer TimerKind, running bool) {}
+
+// SetObserver registers the observer of the events of the machine, replacing any previous one.
+// A nil observer disables the events: the interpreter then only pays for a nil check
+// where they would be reported.
+func (c8 *Chip8) SetObserver(o Observer) {
+	c8.observer = o
+}
+
+// observeReads reports the size bytes of memory starting at addr as read.
+// Like observeWrites and observeTimer, it must only be called when an observer is set.
+func (c8 *Chip8) observeReads(addr uint16, size int) {
+	for i := 0; i < size; i++ {
+		c8.observer.MemoryRead(addr+uint16(i), c8.memory[int(addr)+i])
+	}
+}
+
+// wrote is called after an instruction wrote size bytes of memory at addr,
+// to notify the observer and invalidate the cached blocks holding them.
+func (c8 *Chip8) wrote(addr uint16, size int) {
+	if c8.observer != nil {
+		c8.observeWrites(addr, size)
+	}
+	if c8.blocks != nil {
+		c8.blocks.invalidate(addr, size)
+	}
+}
+
+// observeWrites reports the size bytes of memory starting at addr as written.
+func (c8 *Chip8) observeWrites(addr uint16, size int) {
+	for i := 0; i < size; i++ {
+		c8.observer.MemoryWrite(addr+uint16(i), c8.memory[int(addr)+i])
+	}
+}
+
+// observeTimer reports a timer that started or stopped when its value changed from old to value.
+func (c8 *Chip8) observeTimer(timer TimerKind, old, value uint8) {
+	if (old == 0) != (value == 0) {
+		c8.observer.Timer(timer, value != 0)
+	}
+}
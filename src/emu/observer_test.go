@@ -0,0 +1,91 @@
+package emu
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// recorder records the events as text, ignoring fetches unless fetches is set.
+type recorder struct {
+	NopObserver
+	fetches bool
+	events  []string
+}
+
+func (r *recorder) Fetch(pc, opcode uint16) {
+	if r.fetches {
+		r.events = append(r.events, fmt.Sprintf("fetch %03X %04X", pc, opcode))
+	}
+}
+
+func (r *recorder) MemoryRead(addr uint16, value uint8) {
+	r.events = append(r.events, fmt.Sprintf("read %03X %d", addr, value))
+}
+
+func (r *recorder) MemoryWrite(addr uint16, value uint8) {
+	r.events = append(r.events, fmt.Sprintf("write %03X %d", addr, value))
+}
+
+func (r *recorder) Draw(x, y uint8, sprite []byte, collision bool) {
+	r.events = append(r.events, fmt.Sprintf("draw %d,%d % X %t", x, y, sprite, collision))
+}
+
+func (r *recorder) KeyQuery(key uint8, pressed bool) {
+	r.events = append(r.events, fmt.Sprintf("key %X %t", key, pressed))
+}
+
+func (r *recorder) Timer(timer TimerKind, running bool) {
+	r.events = append(r.events, fmt.Sprintf("timer %d %t", timer, running))
+}
+
+func TestObserver(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+		keys    []uint8
+		ticks   int
+		want    []string
+	}{
+		{"fetch", []byte{0x60, 0x05, 0xF0, 0x00, 0x03, 0x00}, nil, 0,
+			[]string{"fetch 200 6005", "fetch 202 F000"}},
+		{"bcd and load", []byte{0x60, 0x7B, 0xA3, 0x00, 0xF0, 0x33, 0xF1, 0x65}, nil, 0,
+			[]string{"write 300 1", "write 301 2", "write 302 3", "read 300 1", "read 301 2"}},
+		{"save and load ranges", []byte{0x60, 0x07, 0x61, 0x09, 0xA3, 0x00, 0x50, 0x12, 0x51, 0x03}, nil, 0,
+			[]string{"write 300 7", "write 301 9", "read 300 7", "read 301 9"}},
+		{"draw twice", []byte{0xA0, 0x00, 0xD0, 0x11, 0xD0, 0x11}, nil, 0,
+			[]string{"read 000 240", "draw 0,0 F0 false", "read 000 240", "draw 0,0 F0 true"}},
+		{"keys", []byte{0x63, 0x04, 0xE3, 0xA1, 0xE3, 0x9E}, []uint8{4}, 0,
+			[]string{"key 4 true", "key 4 true"}},
+		{"timers", []byte{0x60, 0x02, 0xF0, 0x15, 0xF0, 0x18, 0xF0, 0x15}, nil, 2,
+			[]string{"timer 0 true", "timer 1 true", "timer 0 false", "timer 1 false"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c8 := New()
+			if err := c8.LoadBytes(tt.program); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range tt.keys {
+				c8.HandleKeyEvent(key, false)
+			}
+
+			r := &recorder{fetches: tt.name == "fetch"}
+			c8.SetObserver(r)
+
+			for c8.pc < programStart+uint16(len(tt.program)) {
+				if err := c8.Step(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < tt.ticks; i++ {
+				c8.Tick()
+			}
+
+			if !reflect.DeepEqual(r.events, tt.want) {
+				t.Errorf("events = %q, want %q", r.events, tt.want)
+			}
+		})
+	}
+}
@@ -1,133 +1,83 @@
 package emu
 
 import (
-	"math/rand"
-
 	"github.com/valep27/GChip8/src/util"
 )
 
-// Decode maps an opcode to the function that implements it.
-// It's wonderful. I love it. Just look at it.
-func Decode(opcode uint16) (instr OpcodeFunc, ok bool) {
-	ok = true
-
-	switch opcode & 0xF000 {
-	case 0x0:
-		switch opcode & 0x00FF {
-		case 0xE0:
-			instr = clearScreen
-		case 0xEE:
-			instr = returnFromSub
-		default:
-			ok = false
-		}
-	case 0x1000:
-		instr = jumpAddr
-	case 0x2000:
-		instr = callSubAtNNN
-	case 0x3000:
-		instr = skipIfVxEqualToNN
-	case 0x4000:
-		instr = skipIfVxNotEqualToNN
-	case 0x5000:
-		instr = skipIfVxEqualToVy
-	case 0x6000:
-		instr = setVxToImmediate
-	case 0x7000:
-		instr = addNNToVx
-	case 0x8000:
-		switch opcode & 0x000F {
-		case 0x0:
-			instr = assignVyToVx
-		case 0x1:
-			instr = vxOrVy
-		case 0x2:
-			instr = vxAndVy
-		case 0x3:
-			instr = vxXorVy
-		case 0x4:
-			instr = addVyToVx
-		case 0x5:
-			instr = subVyToVx
-		case 0x6:
-			instr = shiftVxRight
-		case 0x7:
-			instr = subVxToVy
-		case 0xE:
-			instr = shiftVxLeft
-		default:
-			ok = false
-		}
-	case 0x9000:
-		instr = skipIfVxNotEqualToVy
-	case 0xA000:
-		instr = setMemoryNNN
-	case 0xB000:
-		instr = jumpAddrSum
-	case 0xC000:
-		instr = randToVx
-	case 0xD000:
-		instr = draw
-	case 0xE000:
-		switch opcode & 0x000F {
-		case 0xE:
-			instr = skipIfKeyPressed
-		case 0x1:
-			instr = skipIfKeyNotPressed
-		default:
-			ok = false
-		}
-	case 0xF000:
-		switch opcode & 0x00FF {
-		case 0x07:
-			instr = setVxToDelay
-		case 0x0A:
-			instr = waitForKeyPress
-		case 0x15:
-			instr = setDelayToVx
-		case 0x18:
-			instr = setSoundToVx
-		case 0x1E:
-			instr = addVxToI
-		case 0x29:
-			instr = setIToSpriteAddr
-		case 0x33:
-			instr = setBCD
-		case 0x55:
-			instr = dumpRegisters
-		case 0x65:
-			instr = loadRegisters
-		default:
-			ok = false
-		}
-	default:
-		ok = false
-	}
-
-	return
+// handlers maps every instruction to the function that implements it.
+var handlers = [opCount]OpcodeFunc{
+	Op00E0: clearScreen,
+	Op00EE: returnFromSub,
+	Op00CN: scrollDownN,
+	Op00FB: scrollRight,
+	Op00FC: scrollLeft,
+	Op00FD: exit,
+	Op00FE: lowRes,
+	Op00FF: highRes,
+	Op1NNN: jumpAddr,
+	Op2NNN: callSubAtNNN,
+	Op3XNN: skipIfVxEqualToNN,
+	Op4XNN: skipIfVxNotEqualToNN,
+	Op5XY0: skipIfVxEqualToVy,
+	Op5XY2: saveRegisterRange,
+	Op5XY3: loadRegisterRange,
+	Op6XNN: setVxToImmediate,
+	Op7XNN: addNNToVx,
+	Op8XY0: assignVyToVx,
+	Op8XY1: vxOrVy,
+	Op8XY2: vxAndVy,
+	Op8XY3: vxXorVy,
+	Op8XY4: addVyToVx,
+	Op8XY5: subVyToVx,
+	Op8XY6: shiftVxRight,
+	Op8XY7: subVxToVy,
+	Op8XYE: shiftVxLeft,
+	Op9XY0: skipIfVxNotEqualToVy,
+	OpANNN: setMemoryNNN,
+	OpBNNN: jumpAddrSum,
+	OpCXNN: randToVx,
+	OpDXYN: draw,
+	OpEX9E: skipIfKeyPressed,
+	OpEXA1: skipIfKeyNotPressed,
+	OpF000: setILong,
+	OpFN01: selectPlanes,
+	OpF002: loadAudioPattern,
+	OpFX07: setVxToDelay,
+	OpFX0A: waitForKeyPress,
+	OpFX15: setDelayToVx,
+	OpFX18: setSoundToVx,
+	OpFX1E: addVxToI,
+	OpFX29: setIToSpriteAddr,
+	OpFX30: setIToBigSpriteAddr,
+	OpFX33: setBCD,
+	OpFX3A: setPitchToVx,
+	OpFX55: dumpRegisters,
+	OpFX65: loadRegisters,
+	OpFX75: saveFlags,
+	OpFX85: loadFlags,
 }
 
 // Nop does nothing
 // This is not an actual opcode, just a placeholder.
-func nop(c8 *Chip8) {
+func nop(c8 *Chip8, in Instruction) {
 	c8.pc += 2
 }
 
 // SetVxToImmediate implements opcode 6XNN.
 // It will set NN (8 bit immediate) to the register Vx.
-func setVxToImmediate(c8 *Chip8) {
-	x := (c8.opcode & 0x0F00) >> 8
-	nn := uint8(c8.opcode & 0x00FF)
+func setVxToImmediate(c8 *Chip8, in Instruction) {
+	x := in.X
+	nn := in.NN
 
 	c8.V[x] = nn
 	c8.pc += 2
 }
 
 // ClearScreen implements opcode 00E0.
-// Resets the screen pixel values
-func clearScreen(c8 *Chip8) {
+// Resets the screen pixel values of the selected planes.
+func clearScreen(c8 *Chip8, in Instruction) {
 	for i := 0; i < len(c8.vram); i++ {
-		c8.vram[i] = 0
+		c8.vram[i] &^= c8.planes
 	}
 
 	c8.drawFlag = true
@@ -136,33 +86,43 @@ func clearScreen(c8 *Chip8) {
 
 // ReturnFromSub implements opcode 00EE.
 // Returns from a subroutine, meaning it will set the PC to the last stack value.
-func returnFromSub(c8 *Chip8) {
+func returnFromSub(c8 *Chip8, in Instruction) {
+	if c8.sp == 0 {
+		c8.fail(ErrStackUnderflow)
+		return
+	}
+
 	c8.sp--
 	c8.pc = c8.stack[c8.sp] + 2
 }
 
 // JumpAddr implements opcode 1NNN.
 // Sets the program counter to NNN.
-func jumpAddr(c8 *Chip8) {
-	c8.pc = c8.opcode & 0x0FFF
+func jumpAddr(c8 *Chip8, in Instruction) {
+	c8.pc = in.NNN
 }
 
 // CallSubAtNNN implements opcode 2NNN.
 // It will call the subroutine at address NNN, i.e. move the PC to it.
-func callSubAtNNN(c8 *Chip8) {
+func callSubAtNNN(c8 *Chip8, in Instruction) {
+	if int(c8.sp) >= len(c8.stack) {
+		c8.fail(ErrStackOverflow)
+		return
+	}
+
 	c8.stack[c8.sp] = c8.pc
 	c8.sp++
-	c8.pc = c8.opcode & 0x0FFF
+	c8.pc = in.NNN
 }
 
 // SkipIfVxEqualToNN implements opcode 3XNN.
 // It will skip the next instruction if Vx == NN.
-func skipIfVxEqualToNN(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
-	nn := c8.opcode & 0x00FF
+func skipIfVxEqualToNN(c8 *Chip8, in Instruction) {
+	x := in.X
+	nn := in.NN
 
-	if c8.V[x] == uint8(nn) {
-		c8.pc += 4
+	if c8.V[x] == nn {
+		c8.skipNextInstruction()
 	} else {
 		c8.pc += 2
 	}
@@ -170,12 +130,12 @@ func skipIfVxEqualToNN(c8 *Chip8) {
 
 // SkipIfVxNotEqualToNN implements opcode 4XNN.
 // It will skip the next instruction if Vx != NN.
-func skipIfVxNotEqualToNN(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
-	nn := c8.opcode & 0x00FF
+func skipIfVxNotEqualToNN(c8 *Chip8, in Instruction) {
+	x := in.X
+	nn := in.NN
 
-	if c8.V[x] != uint8(nn) {
-		c8.pc += 4
+	if c8.V[x] != nn {
+		c8.skipNextInstruction()
 	} else {
 		c8.pc += 2
 	}
@@ -183,103 +143,197 @@ func skipIfVxNotEqualToNN(c8 *Chip8) {
 
 // SkipIfVxEqualToVy implements opcode 5XY0.
 // It will skip the next instruction if Vx == Vy.
-func skipIfVxEqualToVy(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
-	y := (c8.opcode >> 4) & 0x000F
+func skipIfVxEqualToVy(c8 *Chip8, in Instruction) {
+	x := in.X
+	y := in.Y
 
 	if c8.V[x] == c8.V[y] {
+		c8.skipNextInstruction()
+	} else {
+		c8.pc += 2
+	}
+}
+
+// skipNextInstruction moves the PC past the instruction following the current one.
+// The XO-CHIP F000 NNNN instruction is 4 bytes long and is skipped entirely.
+func (c8 *Chip8) skipNextInstruction() {
+	c8.pc += 2
+
+	if util.CombineBytes(c8.memory[c8.pc+1], c8.memory[c8.pc]) == 0xF000 {
 		c8.pc += 4
 	} else {
 		c8.pc += 2
 	}
 }
 
+// SaveRegisterRange implements opcode 5XY2
+// MEM	save(Vx-Vy)	Stores VX to VY (inclusive, in any order) in memory starting at address I. I is not modified.
+func saveRegisterRange(c8 *Chip8, in Instruction) {
+	x := int(in.X)
+	y := int(in.Y)
+	step := 1
+
+	if x > y {
+		step = -1
+	}
+
+	if !c8.checkMemory(c8.I, (y-x)*step+1) {
+		return
+	}
+
+	for i, reg := 0, x; ; i, reg = i+1, reg+step {
+		c8.memory[c8.I+uint16(i)] = c8.V[reg]
+
+		if reg == y {
+			break
+		}
+	}
+
+	c8.wrote(c8.I, (y-x)*step+1)
+
+	c8.pc += 2
+}
+
+// LoadRegisterRange implements opcode 5XY3
+// MEM	load(Vx-Vy)	Fills VX to VY (inclusive, in any order) with values from memory starting at address I. I is not modified.
+func loadRegisterRange(c8 *Chip8, in Instruction) {
+	x := int(in.X)
+	y := int(in.Y)
+	step := 1
+
+	if x > y {
+		step = -1
+	}
+
+	if !c8.checkMemory(c8.I, (y-x)*step+1) {
+		return
+	}
+
+	for i, reg := 0, x; ; i, reg = i+1, reg+step {
+		c8.V[reg] = c8.memory[c8.I+uint16(i)]
+
+		if reg == y {
+			break
+		}
+	}
+
+	if c8.observer != nil {
+		c8.observeReads(c8.I, (y-x)*step+1)
+	}
+
+	c8.pc += 2
+}
+
 // AddNNToVx implements opcode 7XNN
 // It will add NN to the Vx register
-func addNNToVx(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
-	nn := uint8(c8.opcode & 0x00FF)
+func addNNToVx(c8 *Chip8, in Instruction) {
+	x := in.X
+	nn := in.NN
 	c8.V[x] += nn
 	c8.pc += 2
 }
 
 // AssignVyToVx implements opcode 8XY0
 // Assigns the value of Vy to Vx
-func assignVyToVx(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
-	y := (c8.opcode >> 4) & 0x000F
+func assignVyToVx(c8 *Chip8, in Instruction) {
+	x := in.X
+	y := in.Y
 	c8.V[x] = c8.V[y]
 	c8.pc += 2
 }
 
 // VxOrVy implements opcode 8XY1
 // Assigns the value of Vx | Vy to Vx
-func vxOrVy(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
-	y := (c8.opcode >> 4) & 0x000F
+func vxOrVy(c8 *Chip8, in Instruction) {
+	x := in.X
+	y := in.Y
 	c8.V[x] = c8.V[x] | c8.V[y]
+
+	if c8.quirks.ResetVFOnLogic {
+		c8.V[0xF] = 0
+	}
+
 	c8.pc += 2
 }
 
 // VxAndVy implements opcode 8XY2
 // Assigns the value of Vx & Vy to Vx
-func vxAndVy(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
-	y := (c8.opcode >> 4) & 0x000F
+func vxAndVy(c8 *Chip8, in Instruction) {
+	x := in.X
+	y := in.Y
 	c8.V[x] = c8.V[x] & c8.V[y]
+
+	if c8.quirks.ResetVFOnLogic {
+		c8.V[0xF] = 0
+	}
+
 	c8.pc += 2
 }
 
 // VxXorVy implements opcode 8XY3
 // Assigns the value of Vx xor Vy to Vx
-func vxXorVy(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
-	y := (c8.opcode >> 4) & 0x000F
+func vxXorVy(c8 *Chip8, in Instruction) {
+	x := in.X
+	y := in.Y
 	c8.V[x] = c8.V[x] ^ c8.V[y]
+
+	if c8.quirks.ResetVFOnLogic {
+		c8.V[0xF] = 0
+	}
+
 	c8.pc += 2
 }
 
 // AddVyToVx implements opcode 8XY4
 // Math	Vx += Vy	Adds VY to VX. VF is set to 1 when there's a carry, and to 0 when there isn't.
-func addVyToVx(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
-	y := (c8.opcode >> 4) & 0x000F
+func addVyToVx(c8 *Chip8, in Instruction) {
+	x := in.X
+	y := in.Y
 
 	result, carry := util.CheckedAdd(c8.V[x], c8.V[y])
-	c8.V[0xF] = 0
 	c8.V[x] = result
-
-	if carry {
-		c8.V[0xF] = 1
-	}
+	// the flag is written last, so it wins when X is F
+	c8.V[0xF] = flagValue(carry)
 
 	c8.pc += 2
 }
 
 // SubVyToVx implements opcode 8XY5
 // Math	Vx -= Vy	VY is subtracted from VX. VF is set to 0 when there's a borrow, and 1 when there isn't.
-func subVyToVx(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
-	y := (c8.opcode >> 4) & 0x000F
+func subVyToVx(c8 *Chip8, in Instruction) {
+	x := in.X
+	y := in.Y
 
 	result, borrow := util.CheckedSub(c8.V[x], c8.V[y])
-	c8.V[0xF] = 0
 	c8.V[x] = result
+	c8.V[0xF] = flagValue(!borrow)
 
-	if borrow {
-		c8.V[0xF] = 1
+	c8.pc += 2
+}
+
+// flagValue converts a condition to the 0 or 1 value stored in VF.
+func flagValue(set bool) uint8 {
+	if set {
+		return 1
 	}
 
-	c8.pc += 2
+	return 0
 }
 
 // ShiftVxRight implements opcode 8XY6
 // BitOp	Vx >> 1	Shifts VX right by one. VF is set to the value of the least significant bit of VX before the shift.[2]
-func shiftVxRight(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
+// With the ShiftUsesVy quirk, VY is shifted and the result stored in VX.
+func shiftVxRight(c8 *Chip8, in Instruction) {
+	x := in.X
+	y := in.Y
+
+	src := c8.V[x]
+	if c8.quirks.ShiftUsesVy {
+		src = c8.V[y]
+	}
 
-	lsb := uint8(x) & 1
-	c8.V[x] = c8.V[x] >> 1
+	lsb := src & 1
+	c8.V[x] = src >> 1
 	c8.V[0xF] = lsb
 
 	c8.pc += 2
@@ -287,28 +341,31 @@ func shiftVxRight(c8 *Chip8) {
 
 // SubVxToVy implements opcode 8XY7
 // Math	Vx=Vy-Vx	Sets VX to VY minus VX. VF is set to 0 when there's a borrow, and 1 when there isn't.
-func subVxToVy(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
-	y := (c8.opcode >> 4) & 0x000F
+func subVxToVy(c8 *Chip8, in Instruction) {
+	x := in.X
+	y := in.Y
 
 	result, borrow := util.CheckedSub(c8.V[y], c8.V[x])
-	c8.V[0xF] = 0
 	c8.V[x] = result
-
-	if borrow {
-		c8.V[0xF] = 1
-	}
+	c8.V[0xF] = flagValue(!borrow)
 
 	c8.pc += 2
 }
 
 // ShiftVxLeft implements opcode 8XYE
 // BitOp	Vx << 1	Shifts VX left by one. VF is set to the value of the most significant bit of VX before the shift.[2]
-func shiftVxLeft(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
+// With the ShiftUsesVy quirk, VY is shifted and the result stored in VX.
+func shiftVxLeft(c8 *Chip8, in Instruction) {
+	x := in.X
+	y := in.Y
+
+	src := c8.V[x]
+	if c8.quirks.ShiftUsesVy {
+		src = c8.V[y]
+	}
 
-	msb := uint8(x) & 0x80
-	c8.V[x] = c8.V[x] << 1
+	msb := src >> 7
+	c8.V[x] = src << 1
 	c8.V[0xF] = msb
 
 	c8.pc += 2
@@ -316,12 +373,12 @@ func shiftVxLeft(c8 *Chip8) {
 
 // SkipIfVxNotEqualToVy implements opcode 9XY0
 // Cond	if(Vx!=Vy)	Skips the next instruction if VX doesn't equal VY.
-func skipIfVxNotEqualToVy(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
-	y := (c8.opcode >> 4) & 0x000F
+func skipIfVxNotEqualToVy(c8 *Chip8, in Instruction) {
+	x := in.X
+	y := in.Y
 
 	if c8.V[x] != c8.V[y] {
-		c8.pc += 4
+		c8.skipNextInstruction()
 	} else {
 		c8.pc += 2
 	}
@@ -329,58 +386,87 @@ func skipIfVxNotEqualToVy(c8 *Chip8) {
 
 // SetMemoryNNN implements opcode ANNN
 // MEM	I = NNN	Sets I to the address NNN.
-func setMemoryNNN(c8 *Chip8) {
-	c8.I = c8.opcode & 0x0FFF
+func setMemoryNNN(c8 *Chip8, in Instruction) {
+	c8.I = in.NNN
 	c8.pc += 2
 }
 
 // JumpAddrSum implements opcode BNNN
 // Flow PC=V0+NNN	Jumps to the address NNN plus V0.
-func jumpAddrSum(c8 *Chip8) {
-	c8.pc = (c8.opcode & 0x0FFF) + uint16(c8.V[0])
+// With the JumpUsesVx quirk, this is BXNN: jumps to the address XNN plus VX.
+func jumpAddrSum(c8 *Chip8, in Instruction) {
+	reg := uint16(0)
+	if c8.quirks.JumpUsesVx {
+		reg = uint16(in.X)
+	}
+
+	c8.pc = (in.NNN) + uint16(c8.V[reg])
 }
 
 // RandToVx implements opcode CXNN
 // Rand Vx=rand()&NN	Sets VX to the result of a bitwise and operation on a random number (Typically: 0 to 255) and NN.
-func randToVx(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
-	nn := uint8(c8.opcode)
+// The random number comes from the random source of the machine, see SetRandSource.
+func randToVx(c8 *Chip8, in Instruction) {
+	x := in.X
+	nn := in.NN
 
-	c8.V[x] = uint8(rand.Intn(256)) & nn
+	c8.V[x] = c8.randomByte() & nn
 
 	c8.pc += 2
 }
 
 // Draw implements opcode DXYN
 // Disp	draw(Vx,Vy,N)	Draws a sprite at coordinate (VX, VY)
-func draw(c8 *Chip8) {
-	x := int(c8.V[(c8.opcode>>8)&0xF])
-	y := int(c8.V[(c8.opcode>>4)&0xF])
-	height := int(c8.opcode & 0xF)
+// When N is 0 (DXY0), a 16x16 SUPER-CHIP sprite is drawn, made of 16 rows of two bytes each.
+// The sprite is drawn on every selected XO-CHIP plane, each plane using the sprite data
+// following the one of the previous plane.
+// The starting coordinate always wraps around the screen, while pixels going past
+// the edges are clipped, or wrapped with the WrapSprites quirk.
+// With the DisplayWait quirk, the draw is delayed until the next vertical blank.
+func draw(c8 *Chip8, in Instruction) {
+	x := int(c8.V[in.X])
+	y := int(c8.V[in.Y])
+	height := int(in.N)
+	width := 8
+
+	if height == 0 {
+		height = 16
+		width = 16
+	}
 
-	c8.V[0xF] = 0
+	spriteSize := width / 8 * height
+	planes := int(c8.planes&plane1) + int(c8.planes&plane2)>>1
 
-	for row := 0; row < height; row++ {
-		pixelRow := c8.memory[c8.I+uint16(row)]
+	if !c8.checkMemory(c8.I, spriteSize*planes) {
+		return
+	}
 
-		for col := 0; col < 8; col++ {
-			// check if pixel went from 0 to 1
-			colMask := uint8(0x80 >> uint(col))
-			pixelUpdated := (colMask & pixelRow) != 0
-			pixelAddress := (x + col + ((y + row) * 64))
+	if c8.quirks.DisplayWait {
+		if !c8.vblank {
+			// try again on the next step, without advancing the PC
+			return
+		}
+		c8.vblank = false
+	}
 
-			if pixelAddress < len(c8.vram) && pixelUpdated {
-				// if pixel was already 1, there's a collision
-				collision := c8.vram[pixelAddress] == 1
+	c8.V[0xF] = 0
+	addr := c8.I
 
-				if collision {
-					c8.V[0xF] = 1
-				}
+	for _, plane := range [...]uint8{plane1, plane2} {
+		if c8.planes&plane == 0 {
+			continue
+		}
 
-				// flip the pixel
-				c8.vram[pixelAddress] ^= 1
-			}
+		if c8.drawSprite(x, y, addr, width, height, plane) {
+			c8.V[0xF] = 1
 		}
+
+		addr += uint16(spriteSize)
+	}
+
+	if c8.observer != nil {
+		c8.observeReads(c8.I, spriteSize*planes)
+		c8.observer.Draw(uint8(x), uint8(y), c8.memory[c8.I:int(c8.I)+spriteSize*planes], c8.V[0xF] != 0)
 	}
 
 	c8.drawFlag = true
@@ -389,11 +475,16 @@ func draw(c8 *Chip8) {
 
 // SkipIfKeyPressed implements opcode EX9E
 // KeyOp	if(key()==Vx)	Skips the next instruction if the key stored in VX is pressed. (Usually the next instruction is a jump to skip a code block)
-func skipIfKeyPressed(c8 *Chip8) {
-	x := uint8((c8.opcode >> 8) & 0x000F)
+func skipIfKeyPressed(c8 *Chip8, in Instruction) {
+	x := in.X
 
-	if c8.IsKeyPressed(x) {
-		c8.pc += 4
+	pressed := c8.IsKeyPressed(c8.V[x] & 0xF)
+	if c8.observer != nil {
+		c8.observer.KeyQuery(c8.V[x]&0xF, pressed)
+	}
+
+	if pressed {
+		c8.skipNextInstruction()
 	} else {
 		c8.pc += 2
 	}
@@ -401,96 +492,261 @@ func skipIfKeyPressed(c8 *Chip8) {
 
 // SkipIfKeyNotPressed implements opcode EXA1
 // KeyOp	if(key()!=Vx)	Skips the next instruction if the key stored in VX isn't pressed. (Usually the next instruction is a jump to skip a code block)
-func skipIfKeyNotPressed(c8 *Chip8) {
-	x := uint8((c8.opcode >> 8) & 0x000F)
+func skipIfKeyNotPressed(c8 *Chip8, in Instruction) {
+	x := in.X
 
-	if c8.IsKeyPressed(x) == false {
-		c8.pc += 4
+	pressed := c8.IsKeyPressed(c8.V[x] & 0xF)
+	if c8.observer != nil {
+		c8.observer.KeyQuery(c8.V[x]&0xF, pressed)
+	}
+
+	if pressed == false {
+		c8.skipNextInstruction()
 	} else {
 		c8.pc += 2
 	}
 }
 
+// SetILong implements opcode F000 NNNN
+// MEM	I = NNNN	Sets I to the 16 bit address stored in the two bytes following the opcode.
+// This is the only 4 bytes long instruction.
+func setILong(c8 *Chip8, in Instruction) {
+	if !c8.checkMemory(c8.pc, 4) {
+		return
+	}
+
+	c8.I = util.CombineBytes(c8.memory[c8.pc+3], c8.memory[c8.pc+2])
+	c8.pc += 4
+}
+
+// SelectPlanes implements opcode FN01
+// Disp	plane(N)	Selects the XO-CHIP bitplanes affected by drawing, clearing and scrolling.
+// N is a bitmask: 0 selects no plane, 1 the first, 2 the second and 3 both.
+func selectPlanes(c8 *Chip8, in Instruction) {
+	c8.planes = in.X & (plane1 | plane2)
+	c8.pc += 2
+}
+
+// LoadAudioPattern implements opcode F002
+// Sound	audio(&I)	Loads the 16 bytes starting at address I in the XO-CHIP audio pattern buffer.
+func loadAudioPattern(c8 *Chip8, in Instruction) {
+	if !c8.checkMemory(c8.I, patternSize) {
+		return
+	}
+
+	for i := 0; i < patternSize; i++ {
+		c8.pattern[i] = c8.memory[c8.I+uint16(i)]
+	}
+
+	if c8.observer != nil {
+		c8.observeReads(c8.I, patternSize)
+	}
+
+	c8.pc += 2
+}
+
 // SetVxToDelay implements opcode FX07
 // Timer	Vx = get_delay()	Sets VX to the value of the delay timer.
-func setVxToDelay(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
+func setVxToDelay(c8 *Chip8, in Instruction) {
+	x := in.X
 	c8.V[x] = c8.delayt
 	c8.pc += 2
 }
 
 // WaitForKeyPress implements opcode FX0A
 // KeyOp	Vx = get_key()	A key press is awaited, and then stored in VX. (Blocking Operation. All instruction halted until next key event)
-func waitForKeyPress(c8 *Chip8) {
+// The PC stays on this instruction until HandleKeyEvent receives the key, while timers keep running.
+// With the KeyWaitRelease quirk, the key must also be released, like on the COSMAC VIP.
+func waitForKeyPress(c8 *Chip8, in Instruction) {
 	c8.stopped = true
-	c8.pc += 2
+	c8.keyWaitReg = in.X
+	c8.keyWaitKey = noKey
 }
 
 // SetDelayToVx implements opcode FX15
 // Timer	delay_timer(Vx)	Sets the delay timer to VX.
-func setDelayToVx(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
+func setDelayToVx(c8 *Chip8, in Instruction) {
+	x := in.X
+	if c8.observer != nil {
+		c8.observeTimer(TimerDelay, c8.delayt, c8.V[x])
+	}
 	c8.delayt = c8.V[x]
 	c8.pc += 2
 }
 
 // SetSoundToVx implements opcode FX18
 // Sound	sound_timer(Vx)	Sets the sound timer to VX.
-func setSoundToVx(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
+func setSoundToVx(c8 *Chip8, in Instruction) {
+	x := in.X
+	if c8.observer != nil {
+		c8.observeTimer(TimerSound, c8.soundt, c8.V[x])
+	}
 	c8.soundt = c8.V[x]
 	c8.pc += 2
 }
 
 // AddVxToI implements opcode FX1E
 // MEM	I +=Vx	Adds VX to I.[3]
-func addVxToI(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
+func addVxToI(c8 *Chip8, in Instruction) {
+	x := in.X
 	c8.I += uint16(c8.V[x])
 	c8.pc += 2
 }
 
 // SetIToSpriteAddr implements opcode FX29
 // MEM	I=sprite_addr[Vx]	Sets I to the location of the sprite for the character in VX. Characters 0-F (in hexadecimal) are represented by a 4x5 font.
-func setIToSpriteAddr(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
+func setIToSpriteAddr(c8 *Chip8, in Instruction) {
+	x := in.X
 	c8.I = uint16(c8.V[x]) * 5
 	c8.pc += 2
 }
 
+// SetIToBigSpriteAddr implements opcode FX30
+// MEM	I=big_sprite_addr[Vx]	Sets I to the location of the 8x10 SUPER-CHIP sprite for the character in VX.
+func setIToBigSpriteAddr(c8 *Chip8, in Instruction) {
+	x := in.X
+	c8.I = bigFontAddr + uint16(c8.V[x]&0xF)*10
+	c8.pc += 2
+}
+
+// SetPitchToVx implements opcode FX3A
+// Sound	pitch(Vx)	Sets the XO-CHIP pitch register, which controls the audio pattern playback rate.
+func setPitchToVx(c8 *Chip8, in Instruction) {
+	x := in.X
+	c8.pitch = c8.V[x]
+	c8.pc += 2
+}
+
 // SetBCD implements opcode FX33
 // BCD	set_BCD(Vx);
-func setBCD(c8 *Chip8) {
-	x := (c8.opcode >> 8) & 0x000F
+func setBCD(c8 *Chip8, in Instruction) {
+	x := in.X
 	bcdValue := c8.V[x]
 
+	if !c8.checkMemory(c8.I, 3) {
+		return
+	}
+
 	c8.memory[c8.I] = bcdValue / 100
 	c8.memory[c8.I+1] = (bcdValue % 100) / 10
 	c8.memory[c8.I+2] = (bcdValue % 100) % 10
 
+	c8.wrote(c8.I, 3)
+
 	c8.pc += 2
 }
 
 // DumpRegisters implements opcode FX55
 // MEM	reg_dump(Vx,&I)	Stores V0 to VX (including VX) in memory starting at address I.[4]
-func dumpRegisters(c8 *Chip8) {
-	x := int((c8.opcode >> 8) & 0x000F)
+func dumpRegisters(c8 *Chip8, in Instruction) {
+	x := int(in.X)
+
+	if !c8.checkMemory(c8.I, x+1) {
+		return
+	}
 
 	for i := 0; i <= x; i++ {
 		c8.memory[int(c8.I)+i] = c8.V[i]
 	}
 
+	c8.wrote(c8.I, x+1)
+
+	c8.incrementIAfterLoadStore(x)
 	c8.pc += 2
 }
 
 // LoadRegisters implements opcode FX65
 // MEM	reg_load(Vx,&I)	Fills V0 to VX (including VX) with values from memory starting at address I.[4]
-func loadRegisters(c8 *Chip8) {
-	x := int((c8.opcode >> 8) & 0x000F)
+func loadRegisters(c8 *Chip8, in Instruction) {
+	x := int(in.X)
+
+	if !c8.checkMemory(c8.I, x+1) {
+		return
+	}
 
 	for i := 0; i <= x; i++ {
 		c8.V[i] = c8.memory[int(c8.I)+i]
 	}
 
+	if c8.observer != nil {
+		c8.observeReads(c8.I, x+1)
+	}
+
+	c8.incrementIAfterLoadStore(x)
+	c8.pc += 2
+}
+
+// incrementIAfterLoadStore updates I after FX55 or FX65 according to the LoadStoreIncrement quirk.
+func (c8 *Chip8) incrementIAfterLoadStore(x int) {
+	switch c8.quirks.LoadStoreIncrement {
+	case IncrementByX:
+		c8.I += uint16(x)
+	case IncrementByXPlusOne:
+		c8.I += uint16(x) + 1
+	}
+}
+
+// SaveFlags implements opcode FX75
+// MEM	flags_dump(Vx)	Stores V0 to VX (including VX) in the RPL user flags.
+func saveFlags(c8 *Chip8, in Instruction) {
+	x := int(in.X)
+
+	for i := 0; i <= x; i++ {
+		c8.rpl[i] = c8.V[i]
+	}
+
+	c8.pc += 2
+}
+
+// LoadFlags implements opcode FX85
+// MEM	flags_load(Vx)	Fills V0 to VX (including VX) with values from the RPL user flags.
+func loadFlags(c8 *Chip8, in Instruction) {
+	x := int(in.X)
+
+	for i := 0; i <= x; i++ {
+		c8.V[i] = c8.rpl[i]
+	}
+
+	c8.pc += 2
+}
+
+// ScrollDownN implements opcode 00CN
+// Disp	scroll_down(N)	Scrolls the screen down by N pixels.
+func scrollDownN(c8 *Chip8, in Instruction) {
+	c8.scrollDown(int(in.N))
+	c8.pc += 2
+}
+
+// ScrollRight implements opcode 00FB
+// Disp	scroll_right()	Scrolls the screen right by 4 pixels.
+func scrollRight(c8 *Chip8, in Instruction) {
+	c8.scrollHorizontal(4)
+	c8.pc += 2
+}
+
+// ScrollLeft implements opcode 00FC
+// Disp	scroll_left()	Scrolls the screen left by 4 pixels.
+func scrollLeft(c8 *Chip8, in Instruction) {
+	c8.scrollHorizontal(-4)
+	c8.pc += 2
+}
+
+// Exit implements opcode 00FD
+// Flow	exit()	Stops the interpreter.
+func exit(c8 *Chip8, in Instruction) {
+	c8.exited = true
+}
+
+// LowRes implements opcode 00FE
+// Disp	lores()	Switches to the 64x32 low resolution mode.
+func lowRes(c8 *Chip8, in Instruction) {
+	c8.setHires(false)
+	c8.pc += 2
+}
+
+// HighRes implements opcode 00FF
+// Disp	hires()	Switches to the 128x64 high resolution mode.
+func highRes(c8 *Chip8, in Instruction) {
+	c8.setHires(true)
 	c8.pc += 2
 }
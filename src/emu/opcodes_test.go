@@ -0,0 +1,688 @@
+package emu
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// opcodeTest describes the execution of a single instruction at 0x200.
+// A zero wantPC means 0x202, i.e. the instruction just advances the PC,
+// and a zero wantI means that I must be left unchanged.
+type opcodeTest struct {
+	name    string
+	program []uint16
+	quirks  Quirks
+	v       map[int]uint8
+	i       uint16
+	mem     map[uint16]uint8
+	setup   func(c8 *Chip8)
+	wantV   map[int]uint8
+	wantI   uint16
+	wantPC  uint16
+	wantMem map[uint16]uint8
+	wantErr error
+	// check verifies effects not covered by the other fields, returning a description of the failure.
+	check func(c8 *Chip8) string
+}
+
+func (tt opcodeTest) run(t *testing.T) {
+	c8 := New()
+	c8.SetQuirks(tt.quirks)
+	c8.I = tt.i
+
+	for i, opcode := range tt.program {
+		c8.memory[0x200+2*i] = uint8(opcode >> 8)
+		c8.memory[0x200+2*i+1] = uint8(opcode)
+	}
+	for reg, value := range tt.v {
+		c8.V[reg] = value
+	}
+	for addr, value := range tt.mem {
+		c8.memory[addr] = value
+	}
+	if tt.setup != nil {
+		tt.setup(c8)
+	}
+
+	err := c8.Step()
+	if !errors.Is(err, tt.wantErr) {
+		t.Fatalf("Step() error = %v, want %v", err, tt.wantErr)
+	}
+
+	wantPC, wantI := tt.wantPC, tt.wantI
+	if wantPC == 0 {
+		wantPC = 0x202
+	}
+	if wantI == 0 {
+		wantI = tt.i
+	}
+
+	if c8.pc != wantPC {
+		t.Errorf("pc = %#x, want %#x", c8.pc, wantPC)
+	}
+	if c8.I != wantI {
+		t.Errorf("I = %#x, want %#x", c8.I, wantI)
+	}
+	for reg, want := range tt.wantV {
+		if c8.V[reg] != want {
+			t.Errorf("V%X = %#x, want %#x", reg, c8.V[reg], want)
+		}
+	}
+	for addr, want := range tt.wantMem {
+		if c8.memory[addr] != want {
+			t.Errorf("memory[%#x] = %#x, want %#x", addr, c8.memory[addr], want)
+		}
+	}
+	if tt.check != nil {
+		if failure := tt.check(c8); failure != "" {
+			t.Error(failure)
+		}
+	}
+}
+
+func TestFlowOpcodes(t *testing.T) {
+	tests := []opcodeTest{
+		{
+			name:    "00EE returns after the call",
+			program: []uint16{0x00EE},
+			setup:   func(c8 *Chip8) { c8.stack[0], c8.sp = 0x300, 1 },
+			wantPC:  0x302,
+			check:   spIs(0),
+		},
+		{
+			name:    "00EE with empty stack",
+			program: []uint16{0x00EE},
+			wantPC:  0x200,
+			wantErr: ErrStackUnderflow,
+		},
+		{
+			name:    "1NNN jumps",
+			program: []uint16{0x1345},
+			wantPC:  0x345,
+		},
+		{
+			name:    "2NNN calls",
+			program: []uint16{0x2345},
+			wantPC:  0x345,
+			check: func(c8 *Chip8) string {
+				if c8.sp != 1 || c8.stack[0] != 0x200 {
+					return fmt.Sprintf("sp = %v, stack[0] = %#x, want 1, 0x200", c8.sp, c8.stack[0])
+				}
+				return ""
+			},
+		},
+		{
+			name:    "2NNN with full stack",
+			program: []uint16{0x2345},
+			setup:   func(c8 *Chip8) { c8.sp = stackSize },
+			wantPC:  0x200,
+			wantErr: ErrStackOverflow,
+		},
+		{name: "3XNN skips if equal", program: []uint16{0x3142}, v: map[int]uint8{1: 0x42}, wantPC: 0x204},
+		{name: "3XNN does not skip if different", program: []uint16{0x3142}, v: map[int]uint8{1: 0x41}},
+		{name: "4XNN skips if different", program: []uint16{0x4142}, v: map[int]uint8{1: 0x41}, wantPC: 0x204},
+		{name: "4XNN does not skip if equal", program: []uint16{0x4142}, v: map[int]uint8{1: 0x42}},
+		{name: "5XY0 skips if equal", program: []uint16{0x5120}, v: map[int]uint8{1: 7, 2: 7}, wantPC: 0x204},
+		{name: "5XY0 does not skip if different", program: []uint16{0x5120}, v: map[int]uint8{1: 7, 2: 8}},
+		{name: "9XY0 skips if different", program: []uint16{0x9120}, v: map[int]uint8{1: 7, 2: 8}, wantPC: 0x204},
+		{name: "9XY0 does not skip if equal", program: []uint16{0x9120}, v: map[int]uint8{1: 7, 2: 7}},
+		{name: "BNNN jumps to NNN + V0", program: []uint16{0xB300}, v: map[int]uint8{0: 4, 3: 8}, wantPC: 0x304},
+		{
+			name:    "BXNN jumps to XNN + VX",
+			program: []uint16{0xB300},
+			quirks:  Quirks{JumpUsesVx: true},
+			v:       map[int]uint8{0: 4, 3: 8},
+			wantPC:  0x308,
+		},
+		{
+			name:    "00FD exits",
+			program: []uint16{0x00FD},
+			wantPC:  0x200,
+			check: func(c8 *Chip8) string {
+				if !c8.Exited() {
+					return "machine did not exit"
+				}
+				return ""
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, tt.run)
+	}
+}
+
+func TestRegisterOpcodes(t *testing.T) {
+	tests := []opcodeTest{
+		{name: "6XNN sets VX", program: []uint16{0x6A42}, wantV: map[int]uint8{0xA: 0x42}},
+		{
+			name:    "7XNN adds without carry flag",
+			program: []uint16{0x71FF},
+			v:       map[int]uint8{1: 2, 0xF: 5},
+			wantV:   map[int]uint8{1: 1, 0xF: 5},
+		},
+		{name: "8XY0 copies VY", program: []uint16{0x8120}, v: map[int]uint8{2: 9}, wantV: map[int]uint8{1: 9, 2: 9}},
+		{
+			name:    "8XY1 or",
+			program: []uint16{0x8121},
+			v:       map[int]uint8{1: 0x0C, 2: 0x0A, 0xF: 5},
+			wantV:   map[int]uint8{1: 0x0E, 0xF: 5},
+		},
+		{
+			name:    "8XY2 and",
+			program: []uint16{0x8122},
+			v:       map[int]uint8{1: 0x0C, 2: 0x0A, 0xF: 5},
+			wantV:   map[int]uint8{1: 0x08, 0xF: 5},
+		},
+		{
+			name:    "8XY3 xor",
+			program: []uint16{0x8123},
+			v:       map[int]uint8{1: 0x0C, 2: 0x0A, 0xF: 5},
+			wantV:   map[int]uint8{1: 0x06, 0xF: 5},
+		},
+		{
+			name:    "8XY1 resets VF with quirk",
+			program: []uint16{0x8121},
+			quirks:  Quirks{ResetVFOnLogic: true},
+			v:       map[int]uint8{1: 0x0C, 2: 0x0A, 0xF: 5},
+			wantV:   map[int]uint8{1: 0x0E, 0xF: 0},
+		},
+		{
+			name:    "8XY4 without carry",
+			program: []uint16{0x8124},
+			v:       map[int]uint8{1: 100, 2: 50, 0xF: 5},
+			wantV:   map[int]uint8{1: 150, 0xF: 0},
+		},
+		{
+			name:    "8XY4 with carry",
+			program: []uint16{0x8124},
+			v:       map[int]uint8{1: 200, 2: 100},
+			wantV:   map[int]uint8{1: 44, 0xF: 1},
+		},
+		{
+			name:    "8FY4 stores the flag in VF",
+			program: []uint16{0x8F24},
+			v:       map[int]uint8{2: 1, 0xF: 1},
+			wantV:   map[int]uint8{0xF: 0},
+		},
+		{
+			name:    "8XY5 without borrow",
+			program: []uint16{0x8125},
+			v:       map[int]uint8{1: 5, 2: 3},
+			wantV:   map[int]uint8{1: 2, 0xF: 1},
+		},
+		{
+			name:    "8XY5 with borrow",
+			program: []uint16{0x8125},
+			v:       map[int]uint8{1: 3, 2: 5, 0xF: 1},
+			wantV:   map[int]uint8{1: 0xFE, 0xF: 0},
+		},
+		{
+			name:    "8XY5 of equal values does not borrow",
+			program: []uint16{0x8125},
+			v:       map[int]uint8{1: 5, 2: 5},
+			wantV:   map[int]uint8{1: 0, 0xF: 1},
+		},
+		{
+			name:    "8FY5 stores the flag in VF",
+			program: []uint16{0x8F25},
+			v:       map[int]uint8{2: 3, 0xF: 5},
+			wantV:   map[int]uint8{0xF: 1},
+		},
+		{
+			name:    "8XY6 shifts VX right",
+			program: []uint16{0x8126},
+			v:       map[int]uint8{1: 0x04, 2: 0xFF},
+			wantV:   map[int]uint8{1: 0x02, 0xF: 0},
+		},
+		{
+			name:    "8XY6 sets VF to the LSB of VX",
+			program: []uint16{0x8226},
+			v:       map[int]uint8{2: 0x05},
+			wantV:   map[int]uint8{2: 0x02, 0xF: 1},
+		},
+		{
+			name:    "8XY6 shifts VY with quirk",
+			program: []uint16{0x8126},
+			quirks:  Quirks{ShiftUsesVy: true},
+			v:       map[int]uint8{1: 0x04, 2: 0x07},
+			wantV:   map[int]uint8{1: 0x03, 2: 0x07, 0xF: 1},
+		},
+		{
+			name:    "8XY7 without borrow",
+			program: []uint16{0x8127},
+			v:       map[int]uint8{1: 3, 2: 5},
+			wantV:   map[int]uint8{1: 2, 0xF: 1},
+		},
+		{
+			name:    "8XY7 with borrow",
+			program: []uint16{0x8127},
+			v:       map[int]uint8{1: 5, 2: 3, 0xF: 1},
+			wantV:   map[int]uint8{1: 0xFE, 0xF: 0},
+		},
+		{
+			name:    "8XYE shifts VX left",
+			program: []uint16{0x812E},
+			v:       map[int]uint8{1: 0x81, 2: 0x01},
+			wantV:   map[int]uint8{1: 0x02, 0xF: 1},
+		},
+		{
+			name:    "8XYE sets VF to the MSB of VX",
+			program: []uint16{0x818E},
+			v:       map[int]uint8{1: 0x40, 8: 0x80},
+			wantV:   map[int]uint8{1: 0x80, 0xF: 0},
+		},
+		{
+			name:    "8XYE shifts VY with quirk",
+			program: []uint16{0x812E},
+			quirks:  Quirks{ShiftUsesVy: true},
+			v:       map[int]uint8{1: 0x01, 2: 0xC0},
+			wantV:   map[int]uint8{1: 0x80, 0xF: 1},
+		},
+		{
+			name:    "CXNN masks the random byte",
+			program: []uint16{0xC10F},
+			v:       map[int]uint8{1: 0xFF},
+			check: func(c8 *Chip8) string {
+				if c8.V[1] > 0x0F {
+					return fmt.Sprintf("V1 = %#x, want at most 0x0f", c8.V[1])
+				}
+				return ""
+			},
+		},
+		{name: "CXNN with zero mask", program: []uint16{0xC100}, v: map[int]uint8{1: 0xFF}, wantV: map[int]uint8{1: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, tt.run)
+	}
+}
+
+func TestMemoryOpcodes(t *testing.T) {
+	tests := []opcodeTest{
+		{name: "ANNN sets I", program: []uint16{0xA123}, wantI: 0x123},
+		{name: "F000 NNNN sets I to a long address", program: []uint16{0xF000, 0xBEEF}, wantI: 0xBEEF, wantPC: 0x204},
+		{name: "FX1E adds VX to I", program: []uint16{0xF11E}, i: 0x100, v: map[int]uint8{1: 0x20}, wantI: 0x120},
+		{name: "FX29 points I to the font", program: []uint16{0xF129}, v: map[int]uint8{1: 0xA}, wantI: 50},
+		{name: "FX30 points I to the big font", program: []uint16{0xF130}, v: map[int]uint8{1: 2}, wantI: bigFontAddr + 20},
+		{
+			name:    "FX33 stores BCD",
+			program: []uint16{0xF133},
+			i:       0x300,
+			v:       map[int]uint8{1: 159},
+			wantMem: map[uint16]uint8{0x300: 1, 0x301: 5, 0x302: 9},
+		},
+		{
+			name:    "FX33 out of memory",
+			program: []uint16{0xF133},
+			i:       0xFFFE,
+			wantPC:  0x200,
+			wantErr: ErrMemoryOutOfBounds,
+		},
+		{
+			name:    "FX55 stores V0 to VX",
+			program: []uint16{0xF255},
+			i:       0x300,
+			v:       map[int]uint8{0: 1, 1: 2, 2: 3, 3: 4},
+			wantMem: map[uint16]uint8{0x300: 1, 0x301: 2, 0x302: 3, 0x303: 0},
+		},
+		{
+			name:    "FX55 increments I with quirk",
+			program: []uint16{0xF255},
+			quirks:  Quirks{LoadStoreIncrement: IncrementByXPlusOne},
+			i:       0x300,
+			wantI:   0x303,
+		},
+		{
+			name:    "FX65 loads V0 to VX",
+			program: []uint16{0xF265},
+			i:       0x300,
+			mem:     map[uint16]uint8{0x300: 1, 0x301: 2, 0x302: 3, 0x303: 4},
+			wantV:   map[int]uint8{0: 1, 1: 2, 2: 3, 3: 0},
+		},
+		{
+			name:    "FX65 increments I by X with quirk",
+			program: []uint16{0xF265},
+			quirks:  Quirks{LoadStoreIncrement: IncrementByX},
+			i:       0x300,
+			wantI:   0x302,
+		},
+		{
+			name:    "5XY2 stores VX to VY",
+			program: []uint16{0x5132},
+			i:       0x300,
+			v:       map[int]uint8{1: 1, 2: 2, 3: 3},
+			wantMem: map[uint16]uint8{0x300: 1, 0x301: 2, 0x302: 3},
+		},
+		{
+			name:    "5XY3 loads VX to VY",
+			program: []uint16{0x5133},
+			i:       0x300,
+			mem:     map[uint16]uint8{0x300: 1, 0x301: 2, 0x302: 3},
+			wantV:   map[int]uint8{1: 1, 2: 2, 3: 3},
+		},
+		{
+			name:    "FX75 saves the RPL flags",
+			program: []uint16{0xF175},
+			v:       map[int]uint8{0: 1, 1: 2},
+			check: func(c8 *Chip8) string {
+				if c8.rpl[0] != 1 || c8.rpl[1] != 2 {
+					return fmt.Sprintf("flags = %v, want 1, 2", c8.rpl[:2])
+				}
+				return ""
+			},
+		},
+		{
+			name:    "FX85 loads the RPL flags",
+			program: []uint16{0xF185},
+			setup:   func(c8 *Chip8) { c8.rpl[0], c8.rpl[1] = 3, 4 },
+			wantV:   map[int]uint8{0: 3, 1: 4},
+		},
+		{
+			name:    "F002 loads the audio pattern",
+			program: []uint16{0xF002},
+			i:       0x300,
+			mem:     map[uint16]uint8{0x300: 0xAA, 0x30F: 0x55},
+			check: func(c8 *Chip8) string {
+				if c8.pattern[0] != 0xAA || c8.pattern[15] != 0x55 {
+					return fmt.Sprintf("pattern = %v", c8.pattern)
+				}
+				return ""
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, tt.run)
+	}
+}
+
+func TestTimerAndKeyOpcodes(t *testing.T) {
+	tests := []opcodeTest{
+		{
+			name:    "FX07 reads the delay timer",
+			program: []uint16{0xF107},
+			setup:   func(c8 *Chip8) { c8.delayt = 42 },
+			wantV:   map[int]uint8{1: 42},
+		},
+		{
+			name:    "FX15 sets the delay timer",
+			program: []uint16{0xF115},
+			v:       map[int]uint8{1: 42},
+			check: func(c8 *Chip8) string {
+				if c8.delayt != 42 {
+					return fmt.Sprintf("delay timer = %v, want 42", c8.delayt)
+				}
+				return ""
+			},
+		},
+		{
+			name:    "FX18 sets the sound timer",
+			program: []uint16{0xF118},
+			v:       map[int]uint8{1: 42},
+			check: func(c8 *Chip8) string {
+				if c8.soundt != 42 {
+					return fmt.Sprintf("sound timer = %v, want 42", c8.soundt)
+				}
+				return ""
+			},
+		},
+		{
+			name:    "FX3A sets the pitch",
+			program: []uint16{0xF13A},
+			v:       map[int]uint8{1: 100},
+			check: func(c8 *Chip8) string {
+				if c8.pitch != 100 {
+					return fmt.Sprintf("pitch = %v, want 100", c8.pitch)
+				}
+				return ""
+			},
+		},
+		{
+			name:    "FX0A waits on the same instruction",
+			program: []uint16{0xF30A},
+			wantPC:  0x200,
+			check: func(c8 *Chip8) string {
+				if !c8.IsWaitingForKey() {
+					return "machine is not waiting for a key"
+				}
+				return ""
+			},
+		},
+		{
+			name:    "EX9E skips if the key in VX is pressed",
+			program: []uint16{0xE19E},
+			v:       map[int]uint8{1: 0xA},
+			setup:   pressKey(0xA),
+			wantPC:  0x204,
+		},
+		{
+			name:    "EX9E does not skip if only key X is pressed",
+			program: []uint16{0xE19E},
+			v:       map[int]uint8{1: 0xA},
+			setup:   pressKey(1),
+		},
+		{
+			name:    "EXA1 skips if the key in VX is not pressed",
+			program: []uint16{0xE1A1},
+			v:       map[int]uint8{1: 0xA},
+			setup:   pressKey(1),
+			wantPC:  0x204,
+		},
+		{
+			name:    "EXA1 does not skip if the key in VX is pressed",
+			program: []uint16{0xE1A1},
+			v:       map[int]uint8{1: 0xA},
+			setup:   pressKey(0xA),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, tt.run)
+	}
+}
+
+func TestDisplayOpcodes(t *testing.T) {
+	tests := []opcodeTest{
+		{
+			name:    "00E0 clears the screen",
+			program: []uint16{0x00E0},
+			setup:   func(c8 *Chip8) { c8.vram[0], c8.vram[100] = 1, 1 },
+			check:   pixelsAre(map[int]uint8{0: 0, 100: 0}),
+		},
+		{
+			name:    "DXYN draws a font sprite",
+			program: []uint16{0xD125},
+			v:       map[int]uint8{1: 2, 2: 1, 0xF: 1},
+			wantV:   map[int]uint8{0xF: 0},
+			// the top row of the 0 glyph is 0xF0
+			check: pixelsAre(map[int]uint8{64 + 1: 0, 64 + 2: 1, 64 + 5: 1, 64 + 6: 0, 2*64 + 2: 1, 2*64 + 3: 0}),
+		},
+		{
+			name:    "DXYN sets VF on collision",
+			program: []uint16{0xD125},
+			v:       map[int]uint8{1: 2, 2: 1},
+			setup:   func(c8 *Chip8) { c8.vram[64+3] = 1 },
+			wantV:   map[int]uint8{0xF: 1},
+			check:   pixelsAre(map[int]uint8{64 + 2: 1, 64 + 3: 0}),
+		},
+		{
+			name:    "DXYN wraps the starting coordinate",
+			program: []uint16{0xD125},
+			v:       map[int]uint8{1: 66, 2: 33},
+			check:   pixelsAre(map[int]uint8{64 + 2: 1}),
+		},
+		{
+			name:    "DXYN waits for vblank with quirk",
+			program: []uint16{0xD125},
+			quirks:  Quirks{DisplayWait: true},
+			setup:   func(c8 *Chip8) { c8.vblank = false },
+			wantPC:  0x200,
+			check:   pixelsAre(map[int]uint8{0: 0}),
+		},
+		{
+			name:    "DXYN out of memory",
+			program: []uint16{0xD125},
+			i:       0xFFFF,
+			wantPC:  0x200,
+			wantErr: ErrMemoryOutOfBounds,
+		},
+		{
+			name:    "00CN scrolls down",
+			program: []uint16{0x00C2},
+			setup:   func(c8 *Chip8) { c8.vram[5] = 1 },
+			check:   pixelsAre(map[int]uint8{5: 0, 2*64 + 5: 1}),
+		},
+		{
+			name:    "00FB scrolls right",
+			program: []uint16{0x00FB},
+			setup:   func(c8 *Chip8) { c8.vram[5] = 1 },
+			check:   pixelsAre(map[int]uint8{5: 0, 9: 1}),
+		},
+		{
+			name:    "00FC scrolls left",
+			program: []uint16{0x00FC},
+			setup:   func(c8 *Chip8) { c8.vram[5] = 1 },
+			check:   pixelsAre(map[int]uint8{5: 0, 1: 1}),
+		},
+		{
+			name:    "00FF switches to hires",
+			program: []uint16{0x00FF},
+			check:   resolutionIs(128, 64),
+		},
+		{
+			name:    "00FE switches to lores",
+			program: []uint16{0x00FE},
+			setup:   func(c8 *Chip8) { c8.setHires(true) },
+			check:   resolutionIs(64, 32),
+		},
+		{
+			name:    "FN01 selects the planes",
+			program: []uint16{0xF201},
+			check: func(c8 *Chip8) string {
+				if c8.planes != plane2 {
+					return fmt.Sprintf("planes = %v, want %v", c8.planes, plane2)
+				}
+				return ""
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, tt.run)
+	}
+}
+
+func TestDecodeUnknownOpcodes(t *testing.T) {
+	for _, opcode := range []uint16{0x0000, 0x5121, 0x800F, 0xE100, 0xE10E, 0xF1FF} {
+		if _, ok := Decode(opcode); ok {
+			t.Errorf("Decode(%#04x) succeeded, want unknown opcode", opcode)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		opcode   uint16
+		want     Instruction
+		mnemonic string
+		size     uint16
+	}{
+		{0x8AB4, Instruction{0x8AB4, Op8XY4, 0xA, 0xB, 0x4, 0xB4, 0xAB4}, "ADD", 2},
+		{0xD125, Instruction{0xD125, OpDXYN, 0x1, 0x2, 0x5, 0x25, 0x125}, "DRW", 2},
+		{0x2ABC, Instruction{0x2ABC, Op2NNN, 0xA, 0xB, 0xC, 0xBC, 0xABC}, "CALL", 2},
+		{0xF000, Instruction{0xF000, OpF000, 0x0, 0x0, 0x0, 0x00, 0x000}, "LD", 4},
+		{0x5121, Instruction{0x5121, OpInvalid, 0x1, 0x2, 0x1, 0x21, 0x121}, "DW", 2},
+	}
+	for _, tt := range tests {
+		in, ok := Decode(tt.opcode)
+		if in != tt.want || ok != (tt.want.Op != OpInvalid) {
+			t.Errorf("Decode(%04X) = %+v, %v, want %+v", tt.opcode, in, ok, tt.want)
+		}
+		if in.Mnemonic() != tt.mnemonic || in.Size() != tt.size {
+			t.Errorf("Decode(%04X) mnemonic %q size %d, want %q and %d", tt.opcode, in.Mnemonic(), in.Size(), tt.mnemonic, tt.size)
+		}
+	}
+}
+
+func TestOpClassification(t *testing.T) {
+	tests := []struct {
+		op        Op
+		skip      bool
+		endsBlock bool
+	}{
+		{Op3XNN, true, true},
+		{OpEXA1, true, true},
+		{Op1NNN, false, true},
+		{Op00EE, false, true},
+		{OpBNNN, false, true},
+		{OpFX0A, false, false},
+		{Op7XNN, false, false},
+	}
+	for _, tt := range tests {
+		if tt.op.IsSkip() != tt.skip || tt.op.EndsBlock() != tt.endsBlock {
+			t.Errorf("%v: IsSkip() = %v, EndsBlock() = %v, want %v and %v", tt.op, tt.op.IsSkip(), tt.op.EndsBlock(), tt.skip, tt.endsBlock)
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		opcode uint16
+		want   bool
+	}{
+		{0x9120, true},
+		{0x9121, false},
+		{0x00E0, true},
+		{0x01E0, false},
+		{0x00C3, true},
+		{0x05C3, false},
+		{0xF301, true},
+		{0xD12F, true},
+		{0x5121, false},
+	}
+	for _, tt := range tests {
+		if in, _ := Decode(tt.opcode); in.Canonical() != tt.want {
+			t.Errorf("Decode(%04X).Canonical() = %v, want %v", tt.opcode, !tt.want, tt.want)
+		}
+	}
+}
+
+func spIs(want uint16) func(c8 *Chip8) string {
+	return func(c8 *Chip8) string {
+		if c8.sp != want {
+			return fmt.Sprintf("sp = %v, want %v", c8.sp, want)
+		}
+		return ""
+	}
+}
+
+func pressKey(key uint8) func(c8 *Chip8) {
+	return func(c8 *Chip8) {
+		c8.HandleKeyEvent(key, false)
+	}
+}
+
+func pixelsAre(want map[int]uint8) func(c8 *Chip8) string {
+	return func(c8 *Chip8) string {
+		for i, value := range want {
+			if c8.vram[i] != value {
+				return fmt.Sprintf("pixel (%v, %v) = %v, want %v", i%64, i/64, c8.vram[i], value)
+			}
+		}
+		return ""
+	}
+}
+
+func resolutionIs(width, height int) func(c8 *Chip8) string {
+	return func(c8 *Chip8) string {
+		if w, h := c8.Resolution(); w != width || h != height {
+			return fmt.Sprintf("resolution = %vx%v, want %vx%v", w, h, width, height)
+		}
+		return ""
+	}
+}
+
+func TestEveryOpHasHandler(t *testing.T) {
+	for op := OpInvalid + 1; op < opCount; op++ {
+		if handlers[op] == nil {
+			t.Errorf("op %d has no handler", op)
+		}
+	}
+}
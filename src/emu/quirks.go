@@ -0,0 +1,123 @@
+package emu
+
+import "sort"
+
+// IncrementMode describes how FX55 and FX65 modify I after accessing memory.
+type IncrementMode uint8
+
+// The possible behaviours of I for FX55 and FX65.
+const (
+	// IncrementNone leaves I unchanged.
+	IncrementNone IncrementMode = iota
+	// IncrementByX sets I to I + X.
+	IncrementByX
+	// IncrementByXPlusOne sets I to I + X + 1, like the original COSMAC VIP.
+	IncrementByXPlusOne
+)
+
+// Quirks holds the interpretation of the CHIP-8 instructions that
+// behave differently between platforms.
+// The zero value keeps the historical behaviour of this emulator.
+type Quirks struct {
+	// ShiftUsesVy makes 8XY6 and 8XYE shift Vy and store the result in Vx,
+	// instead of shifting Vx in place.
+	ShiftUsesVy bool
+	// LoadStoreIncrement controls how I is modified by FX55 and FX65.
+	LoadStoreIncrement IncrementMode
+	// JumpUsesVx makes BNNN behave as BXNN, jumping to XNN + Vx instead of NNN + V0.
+	JumpUsesVx bool
+	// WrapSprites makes sprites wrap around the screen edges instead of being clipped.
+	WrapSprites bool
+	// ResetVFOnLogic makes 8XY1, 8XY2 and 8XY3 set VF to 0.
+	ResetVFOnLogic bool
+	// DisplayWait makes DXYN wait for the next vertical blank (timer tick),
+	// limiting drawing to one sprite per frame.
+	DisplayWait bool
+	// KeyWaitRelease makes FX0A wait for a key to be pressed and then released,
+	// instead of resuming as soon as it is pressed.
+	KeyWaitRelease bool
+}
+
+// Quirks presets for the most common CHIP-8 platforms.
+var (
+	// QuirksCosmacVIP is the behaviour of the original interpreter for the COSMAC VIP.
+	QuirksCosmacVIP = Quirks{
+		ShiftUsesVy:        true,
+		LoadStoreIncrement: IncrementByXPlusOne,
+		JumpUsesVx:         false,
+		WrapSprites:        false,
+		ResetVFOnLogic:     true,
+		DisplayWait:        true,
+		KeyWaitRelease:     true,
+	}
+
+	// QuirksChip48 is the behaviour of CHIP-48 on the HP-48 calculators.
+	QuirksChip48 = Quirks{
+		ShiftUsesVy:        false,
+		LoadStoreIncrement: IncrementByX,
+		JumpUsesVx:         true,
+		WrapSprites:        false,
+		ResetVFOnLogic:     false,
+		DisplayWait:        false,
+		KeyWaitRelease:     false,
+	}
+
+	// QuirksSuperChip is the behaviour of SUPER-CHIP 1.1.
+	QuirksSuperChip = Quirks{
+		ShiftUsesVy:        false,
+		LoadStoreIncrement: IncrementNone,
+		JumpUsesVx:         true,
+		WrapSprites:        false,
+		ResetVFOnLogic:     false,
+		DisplayWait:        false,
+		KeyWaitRelease:     false,
+	}
+
+	// QuirksXOChip is the behaviour of XO-CHIP, as implemented by Octo.
+	QuirksXOChip = Quirks{
+		ShiftUsesVy:        true,
+		LoadStoreIncrement: IncrementByXPlusOne,
+		JumpUsesVx:         false,
+		WrapSprites:        true,
+		ResetVFOnLogic:     false,
+		DisplayWait:        false,
+		KeyWaitRelease:     true,
+	}
+)
+
+var quirksPresets = map[string]Quirks{
+	"default": {},
+	"vip":     QuirksCosmacVIP,
+	"chip48":  QuirksChip48,
+	"schip":   QuirksSuperChip,
+	"xochip":  QuirksXOChip,
+}
+
+// QuirksPreset returns the quirks preset with the given name.
+// The second return value is false if no preset with that name exists.
+func QuirksPreset(name string) (Quirks, bool) {
+	q, ok := quirksPresets[name]
+	return q, ok
+}
+
+// QuirksPresetNames returns the sorted names of all the available quirks presets.
+func QuirksPresetNames() []string {
+	names := make([]string, 0, len(quirksPresets))
+
+	for name := range quirksPresets {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// SetQuirks changes the interpretation of ambiguous instructions.
+func (c8 *Chip8) SetQuirks(q Quirks) {
+	c8.quirks = q
+}
+
+// Quirks returns the quirks currently in use.
+func (c8 *Chip8) Quirks() Quirks {
+	return c8.quirks
+}
@@ -0,0 +1,85 @@
+package emu
+
+import (
+	"testing"
+)
+
+func TestQuirksPreset(t *testing.T) {
+	for _, name := range QuirksPresetNames() {
+		if _, ok := QuirksPreset(name); !ok {
+			t.Errorf("QuirksPreset(%q) not found", name)
+		}
+	}
+
+	if _, ok := QuirksPreset("nope"); ok {
+		t.Errorf("QuirksPreset(\"nope\") should not exist")
+	}
+}
+
+func TestQuirks(t *testing.T) {
+	tests := []struct {
+		name   string
+		quirks Quirks
+		opcode uint16
+		setup  func(c8 *Chip8)
+		check  func(c8 *Chip8) bool
+	}{
+		{"shift right uses Vx", Quirks{}, 0x8126,
+			func(c8 *Chip8) { c8.V[1] = 0x03; c8.V[2] = 0x80 },
+			func(c8 *Chip8) bool { return c8.V[1] == 0x01 && c8.V[0xF] == 1 }},
+		{"shift right uses Vy", Quirks{ShiftUsesVy: true}, 0x8126,
+			func(c8 *Chip8) { c8.V[1] = 0x03; c8.V[2] = 0x80 },
+			func(c8 *Chip8) bool { return c8.V[1] == 0x40 && c8.V[0xF] == 0 }},
+		{"shift left uses Vx", Quirks{}, 0x812E,
+			func(c8 *Chip8) { c8.V[1] = 0x81; c8.V[2] = 0x01 },
+			func(c8 *Chip8) bool { return c8.V[1] == 0x02 && c8.V[0xF] == 1 }},
+		{"shift left uses Vy", Quirks{ShiftUsesVy: true}, 0x812E,
+			func(c8 *Chip8) { c8.V[1] = 0x81; c8.V[2] = 0x01 },
+			func(c8 *Chip8) bool { return c8.V[1] == 0x02 && c8.V[0xF] == 0 }},
+		{"store leaves I", Quirks{}, 0xF255,
+			func(c8 *Chip8) { c8.I = 0x300 },
+			func(c8 *Chip8) bool { return c8.I == 0x300 }},
+		{"store increments I by X", Quirks{LoadStoreIncrement: IncrementByX}, 0xF255,
+			func(c8 *Chip8) { c8.I = 0x300 },
+			func(c8 *Chip8) bool { return c8.I == 0x302 }},
+		{"load increments I by X+1", Quirks{LoadStoreIncrement: IncrementByXPlusOne}, 0xF265,
+			func(c8 *Chip8) { c8.I = 0x300 },
+			func(c8 *Chip8) bool { return c8.I == 0x303 }},
+		{"BNNN jumps with V0", Quirks{}, 0xB210,
+			func(c8 *Chip8) { c8.V[0] = 1; c8.V[2] = 2 },
+			func(c8 *Chip8) bool { return c8.pc == 0x211 }},
+		{"BXNN jumps with Vx", Quirks{JumpUsesVx: true}, 0xB210,
+			func(c8 *Chip8) { c8.V[0] = 1; c8.V[2] = 2 },
+			func(c8 *Chip8) bool { return c8.pc == 0x212 }},
+		{"logic keeps VF", Quirks{}, 0x8121,
+			func(c8 *Chip8) { c8.V[0xF] = 7 },
+			func(c8 *Chip8) bool { return c8.V[0xF] == 7 }},
+		{"logic resets VF", Quirks{ResetVFOnLogic: true}, 0x8121,
+			func(c8 *Chip8) { c8.V[0xF] = 7 },
+			func(c8 *Chip8) bool { return c8.V[0xF] == 0 }},
+		{"sprites are clipped", Quirks{}, 0xD011,
+			func(c8 *Chip8) { c8.V[0] = 60; c8.I = 0x300; c8.memory[0x300] = 0xFF },
+			func(c8 *Chip8) bool { return c8.vram[63] == 1 && c8.vram[0] == 0 && c8.vram[64] == 0 }},
+		{"sprites wrap", Quirks{WrapSprites: true}, 0xD011,
+			func(c8 *Chip8) { c8.V[0] = 60; c8.I = 0x300; c8.memory[0x300] = 0xFF },
+			func(c8 *Chip8) bool { return c8.vram[63] == 1 && c8.vram[0] == 1 && c8.vram[64] == 0 }},
+		{"draw waits for vblank", Quirks{DisplayWait: true}, 0xD011,
+			func(c8 *Chip8) { c8.I = 0x300; c8.memory[0x300] = 0xFF },
+			func(c8 *Chip8) bool { return c8.vram[0] == 0 && c8.pc == 0x200 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c8 := New()
+			c8.SetQuirks(tt.quirks)
+			c8.memory[0x200] = uint8(tt.opcode >> 8)
+			c8.memory[0x201] = uint8(tt.opcode)
+			tt.setup(c8)
+
+			c8.Step()
+
+			if !tt.check(c8) {
+				t.Errorf("opcode %04X with quirks %+v: unexpected state", tt.opcode, tt.quirks)
+			}
+		})
+	}
+}
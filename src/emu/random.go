@@ -0,0 +1,80 @@
+package emu
+
+import (
+	"math/rand"
+	"time"
+)
+
+// StatefulSource is a random source whose whole state can be read and restored,
+// so that the sequence of random numbers can be saved along with the machine state.
+type StatefulSource interface {
+	rand.Source
+	State() uint64
+	SetState(state uint64)
+}
+
+// RandSource is the default random source of the emulator, a SplitMix64 generator.
+// It is small, fast and its state is a single 64 bit value.
+type RandSource struct {
+	state uint64
+}
+
+// NewRandSource creates a random source initialized with the given seed.
+func NewRandSource(seed int64) *RandSource {
+	return &RandSource{uint64(seed)}
+}
+
+// Seed reinitializes the source with the given seed.
+func (rs *RandSource) Seed(seed int64) {
+	rs.state = uint64(seed)
+}
+
+// Uint64 returns a pseudo-random 64 bit value.
+func (rs *RandSource) Uint64() uint64 {
+	rs.state += 0x9E3779B97F4A7C15
+	z := rs.state
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
+
+// Int63 returns a non-negative pseudo-random 63 bit integer.
+func (rs *RandSource) Int63() int64 {
+	return int64(rs.Uint64() >> 1)
+}
+
+// State returns the internal state of the generator.
+func (rs *RandSource) State() uint64 {
+	return rs.state
+}
+
+// SetState restores a state previously returned by State.
+func (rs *RandSource) SetState(state uint64) {
+	rs.state = state
+}
+
+// SetRandSource replaces the random source used by CXNN.
+// A source implementing StatefulSource, like RandSource, makes the machine state fully reproducible.
+func (c8 *Chip8) SetRandSource(src rand.Source) {
+	c8.rng = src
+}
+
+// SeedRandom replaces the random source used by CXNN with a RandSource initialized with seed.
+func (c8 *Chip8) SeedRandom(seed int64) {
+	c8.rng = NewRandSource(seed)
+}
+
+// RandSource returns the random source used by CXNN.
+func (c8 *Chip8) RandSource() rand.Source {
+	return c8.rng
+}
+
+// randomByte returns a random value from 0 to 255.
+func (c8 *Chip8) randomByte() uint8 {
+	return uint8(c8.rng.Int63() >> 32)
+}
+
+// timeSeed returns a seed that changes on every run.
+func timeSeed() int64 {
+	return time.Now().UnixNano()
+}
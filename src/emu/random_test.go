@@ -0,0 +1,61 @@
+package emu
+
+import (
+	"testing"
+)
+
+// randomProgram fills V0 to V7 with CXFF.
+var randomProgram = []uint8{
+	0xC0, 0xFF, 0xC1, 0xFF, 0xC2, 0xFF, 0xC3, 0xFF,
+	0xC4, 0xFF, 0xC5, 0xFF, 0xC6, 0xFF, 0xC7, 0xFF,
+}
+
+func runRandomProgram(t *testing.T, c8 *Chip8) []uint8 {
+	t.Helper()
+
+	if err := c8.LoadBytes(randomProgram); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(randomProgram)/2; i++ {
+		if err := c8.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return append([]uint8(nil), c8.V[:8]...)
+}
+
+func TestSeedRandomIsReproducible(t *testing.T) {
+	a, b := New(), New()
+	a.SeedRandom(42)
+	b.SeedRandom(42)
+
+	// interleave the two machines to check they don't share state
+	first := runRandomProgram(t, a)
+	second := runRandomProgram(t, b)
+
+	if string(first) != string(second) {
+		t.Errorf("same seed produced %v and %v", first, second)
+	}
+
+	c := New()
+	c.SeedRandom(43)
+	if third := runRandomProgram(t, c); string(first) == string(third) {
+		t.Errorf("different seeds produced the same values %v", first)
+	}
+}
+
+func TestRandSourceState(t *testing.T) {
+	c8 := New()
+	c8.SeedRandom(7)
+	runRandomProgram(t, c8)
+
+	src := c8.RandSource().(StatefulSource)
+	state := src.State()
+	want := runRandomProgram(t, c8)
+
+	src.SetState(state)
+	if got := runRandomProgram(t, c8); string(got) != string(want) {
+		t.Errorf("after SetState() got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,304 @@
+package emu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Snapshot format
+//
+// A snapshot starts with the 4 bytes magic "GC8S" and a 16 bit format version,
+// followed by a list of chunks. Every chunk has a 4 bytes tag, a 32 bit payload
+// length and the payload itself. All values are little endian.
+//
+// Readers skip chunks they don't know, and ignore extra bytes at the end of
+// the chunks they know: new state can be added either as new chunks or by
+// appending fields to existing ones, without breaking older readers.
+// A missing chunk leaves that part of the machine in its reset state.
+// The version is only increased for incompatible changes of the format.
+
+const (
+	snapshotMagic   = "GC8S"
+	snapshotVersion = 1
+)
+
+// Chunk tags.
+const (
+	chunkCPU      = "CPU "
+	chunkConfig   = "CONF"
+	chunkMemory   = "MEM "
+	chunkVram     = "VRAM"
+	chunkKeypad   = "KEYS"
+	chunkRPLFlags = "RPL "
+	chunkAudio    = "AUD "
+	chunkRandom   = "RNG "
+)
+
+// cpuState is the payload of the CPU chunk.
+type cpuState struct {
+	I          uint16
+	PC         uint16
+	SP         uint16
+	Opcode     uint16
+	Stack      [stackSize]uint16
+	V          [registersNumber]uint8
+	DelayTimer uint8
+	SoundTimer uint8
+	Flags      uint8
+	Planes     uint8
+	KeyWaitReg uint8
+	KeyWaitKey uint8
+	CycleDebt  uint32
+}
+
+// Bits of cpuState.Flags.
+const (
+	flagDraw uint8 = 1 << iota
+	flagStopped
+	flagVblank
+	flagHires
+	flagExited
+)
+
+// configState is the payload of the config chunk.
+type configState struct {
+	ClockSpeed         uint32
+	ShiftUsesVy        bool
+	LoadStoreIncrement IncrementMode
+	JumpUsesVx         bool
+	WrapSprites        bool
+	ResetVFOnLogic     bool
+	DisplayWait        bool
+	KeyWaitRelease     bool
+}
+
+// audioState is the payload of the audio chunk.
+type audioState struct {
+	Pattern [patternSize]uint8
+	Pitch   uint8
+}
+
+// Snapshot returns the complete state of the machine, including memory, screen,
+// configuration and the state of the random source if it implements StatefulSource.
+// The returned data can be stored and later passed to Restore.
+func (c8 *Chip8) Snapshot() []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString(snapshotMagic)
+	binary.Write(&buf, binary.LittleEndian, uint16(snapshotVersion))
+
+	cpu := cpuState{
+		I:          c8.I,
+		PC:         c8.pc,
+		SP:         c8.sp,
+		Opcode:     c8.opcode,
+		DelayTimer: c8.delayt,
+		SoundTimer: c8.soundt,
+		Planes:     c8.planes,
+		KeyWaitReg: c8.keyWaitReg,
+		KeyWaitKey: c8.keyWaitKey,
+		CycleDebt:  uint32(c8.cycleDebt),
+	}
+	copy(cpu.Stack[:], c8.stack)
+	copy(cpu.V[:], c8.V)
+
+	cpu.Flags = flagIf(c8.drawFlag, flagDraw) |
+		flagIf(c8.stopped, flagStopped) |
+		flagIf(c8.vblank, flagVblank) |
+		flagIf(c8.hires, flagHires) |
+		flagIf(c8.exited, flagExited)
+
+	config := configState{
+		ClockSpeed:         uint32(c8.clockSpeed),
+		ShiftUsesVy:        c8.quirks.ShiftUsesVy,
+		LoadStoreIncrement: c8.quirks.LoadStoreIncrement,
+		JumpUsesVx:         c8.quirks.JumpUsesVx,
+		WrapSprites:        c8.quirks.WrapSprites,
+		ResetVFOnLogic:     c8.quirks.ResetVFOnLogic,
+		DisplayWait:        c8.quirks.DisplayWait,
+		KeyWaitRelease:     c8.quirks.KeyWaitRelease,
+	}
+
+	writeChunk(&buf, chunkCPU, cpu)
+	writeChunk(&buf, chunkConfig, config)
+	writeChunk(&buf, chunkMemory, c8.memory)
+	writeChunk(&buf, chunkVram, c8.vram)
+	writeChunk(&buf, chunkKeypad, c8.keypad)
+	writeChunk(&buf, chunkRPLFlags, c8.rpl)
+	writeChunk(&buf, chunkAudio, audioState{c8.pattern, c8.pitch})
+
+	if src, ok := c8.rng.(StatefulSource); ok {
+		writeChunk(&buf, chunkRandom, src.State())
+	}
+
+	return buf.Bytes()
+}
+
+// Restore brings the machine to the state stored in a snapshot returned by Snapshot.
+// If the snapshot is invalid, an error wrapping ErrInvalidSnapshot is returned and
+// the machine is not modified.
+func (c8 *Chip8) Restore(data []byte) error {
+	chunks, err := readChunks(data)
+
+	if err != nil {
+		return err
+	}
+
+	var cpu cpuState
+	var config configState
+	var audio audioState
+	var rngState uint64
+
+	payloads := []struct {
+		tag   string
+		value interface{}
+	}{
+		{chunkCPU, &cpu},
+		{chunkConfig, &config},
+		{chunkMemory, c8.memory},
+		{chunkVram, c8.vram},
+		{chunkKeypad, c8.keypad},
+		{chunkRPLFlags, c8.rpl},
+		{chunkAudio, &audio},
+		{chunkRandom, &rngState},
+	}
+
+	// validate all the known chunks before touching the machine
+	for _, p := range payloads {
+		if payload, ok := chunks[p.tag]; ok && len(payload) < binary.Size(p.value) {
+			return fmt.Errorf("%w: chunk %q is %d bytes, want at least %d", ErrInvalidSnapshot, p.tag, len(payload), binary.Size(p.value))
+		}
+	}
+
+	if _, ok := chunks[chunkCPU]; !ok {
+		return fmt.Errorf("%w: missing chunk %q", ErrInvalidSnapshot, chunkCPU)
+	}
+
+	binary.Read(bytes.NewReader(chunks[chunkCPU]), binary.LittleEndian, &cpu)
+	if err := cpu.validate(); err != nil {
+		return err
+	}
+
+	c8.Reset()
+	audio = audioState{c8.pattern, c8.pitch}
+
+	for _, p := range payloads {
+		if payload, ok := chunks[p.tag]; ok {
+			// the size was validated above, so this cannot fail
+			binary.Read(bytes.NewReader(payload), binary.LittleEndian, p.value)
+		}
+	}
+
+	c8.flushBlocks()
+	c8.I = cpu.I
+	c8.pc = cpu.PC
+	c8.sp = cpu.SP
+	c8.opcode = cpu.Opcode
+	c8.delayt = cpu.DelayTimer
+	c8.soundt = cpu.SoundTimer
+	c8.planes = cpu.Planes
+	c8.keyWaitReg = cpu.KeyWaitReg
+	c8.keyWaitKey = cpu.KeyWaitKey
+	c8.cycleDebt = int(cpu.CycleDebt)
+	copy(c8.stack, cpu.Stack[:])
+	copy(c8.V, cpu.V[:])
+
+	c8.drawFlag = cpu.Flags&flagDraw != 0
+	c8.stopped = cpu.Flags&flagStopped != 0
+	c8.vblank = cpu.Flags&flagVblank != 0
+	c8.hires = cpu.Flags&flagHires != 0
+	c8.exited = cpu.Flags&flagExited != 0
+
+	if _, ok := chunks[chunkConfig]; ok {
+		c8.SetClockSpeed(int(config.ClockSpeed))
+		c8.cycleDebt = int(cpu.CycleDebt)
+		c8.quirks = Quirks{
+			ShiftUsesVy:        config.ShiftUsesVy,
+			LoadStoreIncrement: config.LoadStoreIncrement,
+			JumpUsesVx:         config.JumpUsesVx,
+			WrapSprites:        config.WrapSprites,
+			ResetVFOnLogic:     config.ResetVFOnLogic,
+			DisplayWait:        config.DisplayWait,
+			KeyWaitRelease:     config.KeyWaitRelease,
+		}
+	}
+
+	c8.pattern = audio.Pattern
+	c8.pitch = audio.Pitch
+
+	if src, ok := c8.rng.(StatefulSource); ok {
+		if _, ok := chunks[chunkRandom]; ok {
+			src.SetState(rngState)
+		}
+	}
+
+	return nil
+}
+
+// validate returns an error wrapping ErrInvalidSnapshot if a field used as an index
+// into the machine state is out of range.
+func (cpu *cpuState) validate() error {
+	switch {
+	case cpu.SP > stackSize:
+		return fmt.Errorf("%w: stack pointer %d out of range", ErrInvalidSnapshot, cpu.SP)
+	case cpu.KeyWaitReg >= registersNumber:
+		return fmt.Errorf("%w: key wait register %d out of range", ErrInvalidSnapshot, cpu.KeyWaitReg)
+	case cpu.KeyWaitKey >= keysNumber && cpu.KeyWaitKey != noKey:
+		return fmt.Errorf("%w: key wait key %d out of range", ErrInvalidSnapshot, cpu.KeyWaitKey)
+	}
+
+	return nil
+}
+
+// flagIf returns flag if set is true, 0 otherwise.
+func flagIf(set bool, flag uint8) uint8 {
+	if set {
+		return flag
+	}
+
+	return 0
+}
+
+// writeChunk appends a chunk with the binary encoding of value to buf.
+func writeChunk(buf *bytes.Buffer, tag string, value interface{}) {
+	buf.WriteString(tag)
+	binary.Write(buf, binary.LittleEndian, uint32(binary.Size(value)))
+	binary.Write(buf, binary.LittleEndian, value)
+}
+
+// readChunks validates the snapshot header and splits data in chunk payloads by tag.
+func readChunks(data []byte) (map[string][]byte, error) {
+	headerSize := len(snapshotMagic) + 2
+
+	if len(data) < headerSize || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad header", ErrInvalidSnapshot)
+	}
+
+	version := binary.LittleEndian.Uint16(data[len(snapshotMagic):])
+	if version > snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, version)
+	}
+
+	chunks := make(map[string][]byte)
+	data = data[headerSize:]
+
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("%w: truncated chunk header", ErrInvalidSnapshot)
+		}
+
+		tag := string(data[:4])
+		size := binary.LittleEndian.Uint32(data[4:8])
+		data = data[8:]
+
+		if uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: truncated chunk %q", ErrInvalidSnapshot, tag)
+		}
+
+		chunks[tag] = data[:size]
+		data = data[size:]
+	}
+
+	return chunks, nil
+}
@@ -0,0 +1,118 @@
+package emu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func newGame(t *testing.T, name string) *Chip8 {
+	t.Helper()
+
+	c8 := New()
+	c8.SeedRandom(1)
+	if err := c8.LoadRom("../../games/" + name); err != nil {
+		t.Fatal(err)
+	}
+
+	return c8
+}
+
+func runFrames(t *testing.T, c8 *Chip8, frames int) {
+	t.Helper()
+
+	for i := 0; i < frames; i++ {
+		if err := c8.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	c8 := newGame(t, "BRIX")
+	runFrames(t, c8, 100)
+	c8.HandleKeyEvent(4, false)
+
+	snapshot := c8.Snapshot()
+	runFrames(t, c8, 100)
+	want := c8.Snapshot()
+
+	other := New()
+	if err := other.Restore(snapshot); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	runFrames(t, other, 100)
+
+	if got := other.Snapshot(); !bytes.Equal(got, want) {
+		t.Errorf("restored machine diverged from the original")
+	}
+	if !bytes.Equal(other.GetPixelFrameBuffer(), c8.GetPixelFrameBuffer()) {
+		t.Errorf("restored machine framebuffer diverged from the original")
+	}
+}
+
+func TestRestoreSkipsUnknownChunks(t *testing.T) {
+	c8 := newGame(t, "PONG")
+	runFrames(t, c8, 10)
+
+	var buf bytes.Buffer
+	buf.Write(c8.Snapshot())
+	writeChunk(&buf, "NEW!", []uint8{1, 2, 3})
+
+	other := New()
+	if err := other.Restore(buf.Bytes()); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if !bytes.Equal(other.Snapshot(), c8.Snapshot()) {
+		t.Errorf("restored state differs from the original")
+	}
+}
+
+func TestRestoreInvalid(t *testing.T) {
+	valid := New().Snapshot()
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", append([]byte("NOPE"), valid[4:]...)},
+		{"future version", append([]byte("GC8S\xFF\x00"), valid[6:]...)},
+		{"truncated", valid[:len(valid)-1]},
+		{"missing cpu", []byte("GC8S\x01\x00")},
+		{"stack pointer out of range", corruptCPU(valid, func(cpu *cpuState) { cpu.SP = 0xFF })},
+		{"key wait register out of range", corruptCPU(valid, func(cpu *cpuState) { cpu.KeyWaitReg = 0x10 })},
+		{"key wait key out of range", corruptCPU(valid, func(cpu *cpuState) { cpu.KeyWaitKey = 0x10 })},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c8 := New()
+			c8.V[0] = 42
+
+			if err := c8.Restore(tt.data); !errors.Is(err, ErrInvalidSnapshot) {
+				t.Errorf("Restore() error = %v, want %v", err, ErrInvalidSnapshot)
+			}
+			if c8.V[0] != 42 {
+				t.Errorf("Restore() modified the machine after an error")
+			}
+		})
+	}
+}
+
+// corruptCPU returns a copy of a snapshot with the CPU chunk, the first one, changed by corrupt.
+func corruptCPU(snapshot []byte, corrupt func(cpu *cpuState)) []byte {
+	payload := len(snapshotMagic) + 2 + len(chunkCPU) + 4
+
+	var cpu cpuState
+	binary.Read(bytes.NewReader(snapshot[payload:]), binary.LittleEndian, &cpu)
+	corrupt(&cpu)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &cpu)
+
+	data := append([]byte(nil), snapshot...)
+	copy(data[payload:], buf.Bytes())
+
+	return data
+}
@@ -0,0 +1,51 @@
+package emu
+
+import "github.com/valep27/GChip8/src/util"
+
+// TraceEntry describes an instruction executed by Step.
+type TraceEntry struct {
+	PC     uint16
+	Opcode uint16
+	// Long is the 16 bit operand of F000 NNNN, zero for the other instructions.
+	Long uint16
+	// Before and After hold the registers before and after the instruction was executed.
+	// On error, the registers are left unchanged.
+	Before Registers
+	After  Registers
+	// Err is the error returned by Step, if any.
+	Err error
+}
+
+// TraceFunc is called by Step after every instruction it tries to execute.
+// The entry is reused between calls: it must be copied to be kept.
+type TraceFunc func(entry *TraceEntry)
+
+// SetTracer registers a function called after every instruction executed by Step,
+// replacing any previous one. A nil function disables tracing.
+// Instructions are not traced while waiting for a key or after the program has exited.
+func (c8 *Chip8) SetTracer(f TraceFunc) {
+	c8.tracer = f
+}
+
+// traceStep executes a single instruction like step, reporting it to the tracer.
+func (c8 *Chip8) traceStep() error {
+	if c8.stopped || c8.exited {
+		return nil
+	}
+
+	e := &c8.traceEntry
+	*e = TraceEntry{PC: c8.pc, Before: c8.Registers()}
+
+	if int(c8.pc)+2 <= len(c8.memory) {
+		e.Opcode = util.CombineBytes(c8.memory[c8.pc+1], c8.memory[c8.pc])
+		if e.Opcode == 0xF000 && int(c8.pc)+4 <= len(c8.memory) {
+			e.Long = util.CombineBytes(c8.memory[c8.pc+3], c8.memory[c8.pc+2])
+		}
+	}
+
+	e.Err = c8.step()
+	e.After = c8.Registers()
+	c8.tracer(e)
+
+	return e.Err
+}
@@ -0,0 +1,52 @@
+package emu
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTracer(t *testing.T) {
+	c8 := New()
+	if err := c8.LoadBytes([]byte{
+		0x60, 0x05, // 200: v0 := 5
+		0xF0, 0x00, 0x03, 0x00, // 202: i := long 0x300
+		0xFF, 0xFF, // 206: invalid
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []TraceEntry
+	c8.SetTracer(func(e *TraceEntry) {
+		entries = append(entries, *e)
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := c8.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := c8.Step()
+	if !errors.Is(err, ErrUnknownOpcode) {
+		t.Fatalf("Step() error = %v, want ErrUnknownOpcode", err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("traced %d instructions, want 3", len(entries))
+	}
+
+	if e := entries[0]; e.PC != 0x200 || e.Opcode != 0x6005 || e.Before.V[0] != 0 || e.After.V[0] != 5 || e.After.PC != 0x202 {
+		t.Errorf("first entry = %+v", e)
+	}
+	if e := entries[1]; e.Opcode != 0xF000 || e.Long != 0x300 || e.Before.I != 0 || e.After.I != 0x300 {
+		t.Errorf("second entry = %+v", e)
+	}
+	if e := entries[2]; e.Err != err || e.After.PC != 0x206 {
+		t.Errorf("third entry = %+v, want the error and an unchanged PC", e)
+	}
+
+	c8.SetTracer(nil)
+	c8.Step()
+	if len(entries) != 3 {
+		t.Errorf("traced after the tracer was removed")
+	}
+}
@@ -0,0 +1,137 @@
+package emu
+
+import (
+	"testing"
+)
+
+func TestLongILoad(t *testing.T) {
+	c8 := New()
+
+	runProgram(c8, 0xF000, 0xABCD)
+
+	if c8.I != 0xABCD || c8.pc != 0x204 {
+		t.Errorf("F000 NNNN: I = %#x, pc = %#x, want 0xabcd, 0x204", c8.I, c8.pc)
+	}
+}
+
+func TestSkipOverLongInstruction(t *testing.T) {
+	tests := []struct {
+		name   string
+		next   uint16
+		wantPC uint16
+	}{
+		{"skips 2 byte instruction", 0x6000, 0x204},
+		{"skips 4 byte instruction", 0xF000, 0x206},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c8 := New()
+			// 3000: skip if V0 == 0, always true
+			runProgram(c8, 0x3000, tt.next)
+
+			if c8.pc != tt.wantPC {
+				t.Errorf("pc = %#x, want %#x", c8.pc, tt.wantPC)
+			}
+		})
+	}
+}
+
+func TestRegisterRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		opcode uint16
+		want   []uint8
+	}{
+		{"save V2 to V4", 0x5242, []uint8{2, 3, 4}},
+		{"save V4 to V2", 0x5422, []uint8{4, 3, 2}},
+		{"save V7 only", 0x5772, []uint8{7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c8 := New()
+			c8.I = 0x1000
+			for i := range c8.V {
+				c8.V[i] = uint8(i)
+			}
+
+			runProgram(c8, tt.opcode)
+
+			for i, want := range tt.want {
+				if got := c8.memory[0x1000+i]; got != want {
+					t.Errorf("memory[I+%v] = %v, want %v", i, got, want)
+				}
+			}
+			if c8.I != 0x1000 {
+				t.Errorf("I changed to %#x", c8.I)
+			}
+
+			// load back into zeroed registers with the matching 5XY3
+			for i := range c8.V {
+				c8.V[i] = 0
+			}
+			c8.pc = 0x200
+			runProgram(c8, tt.opcode|0x1)
+
+			for _, want := range tt.want {
+				if c8.V[want] != want {
+					t.Errorf("V%X = %v, want %v", want, c8.V[want], want)
+				}
+			}
+		})
+	}
+}
+
+func TestBitplanes(t *testing.T) {
+	tests := []struct {
+		name     string
+		program  []uint16
+		wantTop  uint8
+		wantNext uint8
+	}{
+		// sprite data at 0x300 is 0x80 0x80 0x80 0x00, so with both planes and N = 2
+		// the second plane only gets the top pixel
+		{"first plane only", []uint16{0xD011}, 1, 0},
+		{"second plane only", []uint16{0xF201, 0xD011}, 2, 0},
+		{"both planes use consecutive data", []uint16{0xF301, 0xD012}, 3, 1},
+		{"no plane draws nothing", []uint16{0xF001, 0xD011}, 0, 0},
+		{"clear only selected plane", []uint16{0xF301, 0xD011, 0xF101, 0x00E0}, 2, 0},
+		{"scroll only selected plane", []uint16{0xF301, 0xD011, 0xF201, 0x00C1}, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c8 := New()
+			c8.I = 0x300
+			c8.memory[0x300] = 0x80
+			c8.memory[0x301] = 0x80
+			c8.memory[0x302] = 0x80
+
+			runProgram(c8, tt.program...)
+
+			fb := c8.GetPixelFrameBuffer()
+			if fb[0] != tt.wantTop || fb[64] != tt.wantNext {
+				t.Errorf("pixels = %v, %v, want %v, %v", fb[0], fb[64], tt.wantTop, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestAudioPatternAndPitch(t *testing.T) {
+	c8 := New()
+	c8.I = 0x300
+	for i := 0; i < patternSize; i++ {
+		c8.memory[0x300+i] = uint8(i)
+	}
+
+	// F002, V0 = 100, FX3A with V0, V1 = 2, sound timer = V1
+	runProgram(c8, 0xF002, 0x6064, 0xF03A, 0x6102, 0xF118)
+
+	state := c8.Audio()
+	for i := 0; i < patternSize; i++ {
+		if state.Pattern[i] != uint8(i) {
+			t.Errorf("pattern[%v] = %v, want %v", i, state.Pattern[i], i)
+		}
+	}
+	if state.Pitch != 100 || !state.Playing {
+		t.Errorf("pitch = %v, playing = %v, want 100, true", state.Pitch, state.Playing)
+	}
+}
@@ -0,0 +1,62 @@
+package headless
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/valep27/GChip8/src/emu"
+)
+
+var update = flag.Bool("update", false, "update the golden framebuffers in testdata")
+
+// goldenFrames is the number of frames every game runs before comparing its framebuffer.
+const goldenFrames = 300
+
+// TestGoldenFramebuffers runs every game in the games directory and compares the final
+// framebuffer with the one stored in testdata/golden. Run with -update after an intended
+// change of behaviour to regenerate them.
+func TestGoldenFramebuffers(t *testing.T) {
+	games, err := ioutil.ReadDir("../../games")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, game := range games {
+		name := game.Name()
+
+		t.Run(name, func(t *testing.T) {
+			c8 := emu.New()
+			c8.SeedRandom(1)
+			if err := c8.LoadRom(filepath.Join("../../games", name)); err != nil {
+				t.Fatal(err)
+			}
+			if err := Run(c8, goldenFrames, nil); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			width, height := c8.Resolution()
+			got := ASCII(c8.GetPixelFrameBuffer(), width, height)
+			path := filepath.Join("testdata", "golden", name+".txt")
+
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("missing golden framebuffer, run with -update: %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("framebuffer after %d frames differs from %s:\n%s", goldenFrames, path, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Package headless runs the emulator without a display, driving the keypad from a script
+// and rendering the resulting framebuffer as an image, text or a hash.
+package headless
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/valep27/GChip8/src/emu"
+)
+
+// KeyEvent is a scripted keypad change, applied before running the frame with index Frame.
+type KeyEvent struct {
+	Frame int
+	Key   uint8
+	Up    bool
+}
+
+// Script is a list of key events sorted by frame.
+type Script []KeyEvent
+
+// ParseScript parses a comma separated list of key events in the form FRAME:+KEY to press
+// a key and FRAME:-KEY to release it, with keys written as a hex digit, e.g. "10:+5,40:-5".
+// A key without sign is pressed at the given frame and released at the next one.
+func ParseScript(s string) (Script, error) {
+	var script Script
+
+	if strings.TrimSpace(s) == "" {
+		return script, nil
+	}
+
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid key event '%s', want FRAME:+KEY or FRAME:-KEY", entry)
+		}
+
+		frame, err := strconv.Atoi(parts[0])
+		if err != nil || frame < 0 {
+			return nil, fmt.Errorf("invalid frame '%s' in key event '%s'", parts[0], entry)
+		}
+
+		key := parts[1]
+		sign := byte(0)
+		if strings.HasPrefix(key, "+") || strings.HasPrefix(key, "-") {
+			sign, key = key[0], key[1:]
+		}
+
+		value, err := strconv.ParseUint(key, 16, 4)
+		if err != nil || len(key) != 1 {
+			return nil, fmt.Errorf("invalid key '%s' in key event '%s'", key, entry)
+		}
+
+		switch sign {
+		case '+':
+			script = append(script, KeyEvent{frame, uint8(value), false})
+		case '-':
+			script = append(script, KeyEvent{frame, uint8(value), true})
+		default:
+			script = append(script,
+				KeyEvent{frame, uint8(value), false},
+				KeyEvent{frame + 1, uint8(value), true})
+		}
+	}
+
+	sort.SliceStable(script, func(i, j int) bool {
+		return script[i].Frame < script[j].Frame
+	})
+
+	return script, nil
+}
+
+// FrameRunner runs a single frame of emulation, like Chip8.RunFrame.
+type FrameRunner interface {
+	RunFrame() error
+}
+
+// Run runs the machine for the given number of frames, sending the scripted key events
+// before each frame. It stops early if the program exits, and returns the first emulator error.
+func Run(c8 *emu.Chip8, frames int, script Script) error {
+	return RunWith(c8, c8, frames, script)
+}
+
+// RunWith is like Run, but frames are run by runner, for instance a debugger controlling c8.
+// A negative number of frames is an error, so that a typo does not pass for an empty run.
+func RunWith(c8 *emu.Chip8, runner FrameRunner, frames int, script Script) error {
+	if frames < 0 {
+		return fmt.Errorf("invalid number of frames %d", frames)
+	}
+
+	next := 0
+
+	for frame := 0; frame < frames && !c8.Exited(); frame++ {
+		for next < len(script) && script[next].Frame <= frame {
+			c8.HandleKeyEvent(script[next].Key, script[next].Up)
+			next++
+		}
+
+		if err := runner.RunFrame(); err != nil {
+			return fmt.Errorf("frame %d: %w", frame, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package headless
+
+import (
+	"bytes"
+	"image/png"
+	"reflect"
+	"testing"
+
+	"github.com/valep27/GChip8/src/emu"
+)
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		want    Script
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"press and release", "10:+5, 40:-5", Script{{10, 5, false}, {40, 5, true}}, false},
+		{"tap", "3:a", Script{{3, 0xA, false}, {4, 0xA, true}}, false},
+		{"sorted by frame", "9:-1,2:+1", Script{{2, 1, false}, {9, 1, true}}, false},
+		{"missing key", "10", nil, true},
+		{"bad frame", "x:+1", nil, true},
+		{"negative frame", "-1:+1", nil, true},
+		{"bad key", "1:+g", nil, true},
+		{"key too long", "1:+10", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScript(tt.script)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseScript() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseScript() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunIsDeterministic(t *testing.T) {
+	script, err := ParseScript("5:+4,30:-4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hashes []string
+	for i := 0; i < 2; i++ {
+		c8 := emu.New()
+		c8.SeedRandom(1)
+		if err := c8.LoadRom("../../games/BRIX"); err != nil {
+			t.Fatal(err)
+		}
+		if err := Run(c8, 120, script); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		hashes = append(hashes, Hash(c8.GetPixelFrameBuffer()))
+	}
+
+	if hashes[0] != hashes[1] {
+		t.Errorf("runs ended with different framebuffers: %s, %s", hashes[0], hashes[1])
+	}
+}
+
+func TestRunReportsErrors(t *testing.T) {
+	c8 := emu.New()
+	// 00EE with an empty stack
+	if err := c8.LoadBytes([]byte{0x00, 0xEE}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Run(c8, 1, nil); err == nil {
+		t.Errorf("Run() error = nil, want stack underflow")
+	}
+}
+
+func TestRunRejectsNegativeFrames(t *testing.T) {
+	if err := Run(emu.New(), -5, nil); err == nil {
+		t.Errorf("Run() error = nil, want an invalid number of frames")
+	}
+}
+
+func TestRender(t *testing.T) {
+	framebuffer := []uint8{0, 1, 2, 3, 1, 0}
+
+	if got, want := ASCII(framebuffer, 3, 2), ".#+\n@#.\n"; got != want {
+		t.Errorf("ASCII() = %q, want %q", got, want)
+	}
+
+	var buf bytes.Buffer
+	palette := [4]uint32{0x000000, 0xFFFFFF, 0xFF0000, 0x00FF00}
+	if err := WritePNG(&buf, framebuffer, 3, 2, 2, palette); err != nil {
+		t.Fatalf("WritePNG() error = %v", err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decoding the PNG: %v", err)
+	}
+	if size := img.Bounds().Size(); size.X != 6 || size.Y != 4 {
+		t.Errorf("image size = %v, want 6x4", size)
+	}
+	if r, g, b, _ := img.At(5, 1).RGBA(); r != 0xFFFF || g != 0 || b != 0 {
+		t.Errorf("pixel (5, 1) = %v, %v, %v, want red", r, g, b)
+	}
+}
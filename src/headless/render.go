@@ -0,0 +1,61 @@
+package headless
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/valep27/GChip8/src/movie"
+)
+
+// asciiPixels are the characters used by ASCII for the four combinations of the bitplanes.
+const asciiPixels = ".#+@"
+
+// ASCII renders a framebuffer as text, one line per row. Unset pixels are drawn as '.',
+// pixels of the first plane as '#', of the second plane as '+' and of both planes as '@'.
+func ASCII(framebuffer []uint8, width, height int) string {
+	var b strings.Builder
+
+	b.Grow((width + 1) * height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			b.WriteByte(asciiPixels[framebuffer[y*width+x]&3])
+		}
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+// Hash returns the hash of a framebuffer as a hex string.
+// It is the same hash stored in movie files.
+func Hash(framebuffer []uint8) string {
+	return fmt.Sprintf("%016x", movie.FrameHash(framebuffer))
+}
+
+// WritePNG encodes a framebuffer as a PNG image, with every pixel scaled to a
+// scale x scale square. The palette holds the 0xRRGGBB colors of the four
+// combinations of the bitplanes, like io.Palette.
+func WritePNG(w io.Writer, framebuffer []uint8, width, height, scale int, palette [4]uint32) error {
+	colors := make(color.Palette, len(palette))
+
+	for i, rgb := range palette {
+		colors[i] = color.RGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 0xFF}
+	}
+
+	if scale < 1 {
+		scale = 1
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, width*scale, height*scale), colors)
+	for y := 0; y < height*scale; y++ {
+		for x := 0; x < width*scale; x++ {
+			img.Pix[y*img.Stride+x] = framebuffer[(y/scale)*width+x/scale] & 3
+		}
+	}
+
+	return png.Encode(w, img)
+}
@@ -1,12 +1,10 @@
 package io
 
-import "github.com/valep27/GChip8/src/emu"
-
 // Frontend is the basic interface for graphical output.
 // A frontend might be implemented by SDL, opengl or similar libraries.
 type Frontend interface {
-	Initialize()
-	Draw(emulator emu.Chip8)
+	Initialize() error
+	Draw(framebuffer []uint8, width, height int) error
 	Close()
 }
 
@@ -14,9 +12,11 @@ type Frontend interface {
 type Key uint8
 
 // KeyEvent is a type for representing keydown or keyup events.
+// For the save state keys, Slot is the number of the slot to save to or load from.
 type KeyEvent struct {
-	Key Key
-	Up bool
+	Key  Key
+	Up   bool
+	Slot int
 }
 
 // The possible values for keys
@@ -39,8 +39,14 @@ const (
 	KeyF
 	KeyQuit
 	KeyNone
+	KeySaveState
+	KeyLoadState
+	KeyRewind
 )
 
+// SaveSlots is the number of save state slots reachable with hotkeys.
+const SaveSlots = 9
+
 // Input is an interface for a provider of keypresses.
 type Input interface {
 	Poll() *KeyEvent
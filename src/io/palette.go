@@ -0,0 +1,49 @@
+package io
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Palette holds the colors used to render the four combinations of the XO-CHIP bitplanes,
+// as 0xRRGGBB values. Index 0 is used for pixels with no plane set, 1 for the first plane,
+// 2 for the second plane and 3 for pixels set on both planes.
+type Palette [4]uint32
+
+// DefaultPalette renders classic CHIP-8 games in black and white.
+var DefaultPalette = Palette{0x000000, 0xFFFFFF, 0xFF6600, 0x662200}
+
+// ParsePalette parses a palette from a comma separated list of four hex colors,
+// such as "000000,FFFFFF,FF6600,662200". Colors can optionally start with '#'.
+func ParsePalette(s string) (Palette, error) {
+	var palette Palette
+	colors := strings.Split(s, ",")
+
+	if len(colors) != len(palette) {
+		return palette, fmt.Errorf("palette must have %d colors, got %d", len(palette), len(colors))
+	}
+
+	for i, color := range colors {
+		color = strings.TrimPrefix(strings.TrimSpace(color), "#")
+		value, err := strconv.ParseUint(color, 16, 32)
+
+		if err != nil || len(color) != 6 {
+			return palette, fmt.Errorf("invalid color '%s' in palette", colors[i])
+		}
+
+		palette[i] = uint32(value)
+	}
+
+	return palette, nil
+}
+
+// pixel converts the color at index i of the palette to the RGBA format used by the frontend.
+func (p Palette) pixel(i uint8) uint32 {
+	rgb := p[i&3]
+	r := (rgb >> 16) & 0xFF
+	g := (rgb >> 8) & 0xFF
+	b := rgb & 0xFF
+
+	return 0xFF000000 | b<<16 | g<<8 | r
+}
@@ -0,0 +1,77 @@
+package io
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// maxQueuedFrames limits the audio latency: samples are dropped when more
+// than this many frames worth of audio are waiting to be played.
+const maxQueuedFrames = 4
+
+// SdlAudio implements audio output using an SDL2 queued audio device.
+type SdlAudio struct {
+	device     sdl.AudioDeviceID
+	sampleRate int
+	buffer     []byte
+}
+
+// NewSdlAudio creates a new uninitialized audio output that uses SDL2.
+func NewSdlAudio(sampleRate int) SdlAudio {
+	return SdlAudio{0, sampleRate, nil}
+}
+
+// Initialize opens the audio device for mono, 16 bit signed samples.
+func (sa *SdlAudio) Initialize() error {
+	if err := sdl.InitSubSystem(sdl.INIT_AUDIO); err != nil {
+		return fmt.Errorf("cannot initialize SDL audio: %s", err)
+	}
+
+	spec := sdl.AudioSpec{
+		Freq:     int32(sa.sampleRate),
+		Format:   sdl.AUDIO_S16LSB,
+		Channels: 1,
+		Samples:  1024,
+	}
+
+	device, err := sdl.OpenAudioDevice("", false, &spec, nil, 0)
+
+	if err != nil {
+		return fmt.Errorf("cannot open audio device: %s", err)
+	}
+
+	sa.device = device
+	sdl.PauseAudioDevice(sa.device, false)
+	return nil
+}
+
+// Queue sends samples to the audio device, to be played after the ones already queued.
+func (sa *SdlAudio) Queue(samples []int16) error {
+	maxQueued := uint32(maxQueuedFrames * 2 * len(samples))
+
+	if sdl.GetQueuedAudioSize(sa.device) > maxQueued {
+		return nil
+	}
+
+	if cap(sa.buffer) < 2*len(samples) {
+		sa.buffer = make([]byte, 2*len(samples))
+	}
+	sa.buffer = sa.buffer[:2*len(samples)]
+
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(sa.buffer[2*i:], uint16(sample))
+	}
+
+	if err := sdl.QueueAudio(sa.device, sa.buffer); err != nil {
+		return fmt.Errorf("cannot queue audio: %s", err)
+	}
+
+	return nil
+}
+
+// Close stops playback and releases the audio device.
+func (sa *SdlAudio) Close() {
+	sdl.CloseAudioDevice(sa.device)
+}
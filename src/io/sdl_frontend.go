@@ -1,14 +1,17 @@
 package io
 
 import (
+	"fmt"
 	"unsafe"
 
 	"github.com/veandco/go-sdl2/sdl"
 )
 
 const (
-	width        = 64
-	height       = 32
+	baseWidth    = 64
+	baseHeight   = 32
+	maxWidth     = 128
+	maxHeight    = 64
 	textureDepth = 4
 	renderScale  = 4
 )
@@ -18,47 +21,56 @@ type SdlFrontend struct {
 	window   *sdl.Window
 	renderer *sdl.Renderer
 	fb       []uint32
+	palette  Palette
 }
 
 // NewSdlFrontend creates a new uninitialized frontend that uses SDL2.
 func NewSdlFrontend() SdlFrontend {
-	return SdlFrontend{nil, nil, make([]uint32, width*height)}
+	return SdlFrontend{nil, nil, make([]uint32, maxWidth*maxHeight), DefaultPalette}
+}
+
+// SetPalette changes the colors used to draw the framebuffer.
+func (sf *SdlFrontend) SetPalette(palette Palette) {
+	sf.palette = palette
 }
 
 // Initialize creates the window and sets up any internal state for the frontend.
-func (sf *SdlFrontend) Initialize() {
-	sdl.Init(sdl.INIT_EVERYTHING)
+func (sf *SdlFrontend) Initialize() error {
+	if err := sdl.Init(sdl.INIT_EVERYTHING); err != nil {
+		return fmt.Errorf("cannot initialize SDL: %s", err)
+	}
 
 	window, err := sdl.CreateWindow("Chip8",
 		sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED,
-		width*renderScale,
-		height*renderScale,
+		baseWidth*renderScale,
+		baseHeight*renderScale,
 		sdl.WINDOW_SHOWN|sdl.WINDOW_RESIZABLE)
 
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("cannot create window: %s", err)
 	}
 
 	renderer, err := sdl.CreateRenderer(window, -1, sdl.RENDERER_SOFTWARE)
 
 	if err != nil {
-		panic(err)
+		window.Destroy()
+		return fmt.Errorf("cannot create renderer: %s", err)
 	}
 
 	sf.window = window
 	sf.renderer = renderer
+	return nil
 }
 
 // Draw will draw on the window the contents of the emulator framebuffer.
-func (sf *SdlFrontend) Draw(framebuffer []uint8) {
+// The framebuffer resolution can change between calls (e.g. SUPER-CHIP high resolution mode),
+// the image is always stretched to fill the window.
+// Pixel values from 0 to 3 are mapped to the colors of the palette.
+func (sf *SdlFrontend) Draw(framebuffer []uint8, width, height int) error {
 	pixels := width * height
 
 	for i := 0; i < pixels; i++ {
-		if framebuffer[i] == 0 {
-			sf.fb[i] = 0
-		} else {
-			sf.fb[i] = 0xFFFFFFFF
-		}
+		sf.fb[i] = sf.palette.pixel(framebuffer[i])
 	}
 
 	surface, err := sdl.CreateRGBSurfaceFrom(
@@ -73,8 +85,9 @@ func (sf *SdlFrontend) Draw(framebuffer []uint8) {
 		0xFF000000)
 
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("cannot create surface: %s", err)
 	}
+	defer surface.Free()
 
 	surface.Lock()
 	sf.renderer.Clear()
@@ -82,11 +95,16 @@ func (sf *SdlFrontend) Draw(framebuffer []uint8) {
 	surface.Unlock()
 
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("cannot create texture: %s", err)
+	}
+	defer txt.Destroy()
+
+	if err := sf.renderer.Copy(txt, nil, nil); err != nil {
+		return fmt.Errorf("cannot draw texture: %s", err)
 	}
 
-	sf.renderer.Copy(txt, nil, nil)
 	sf.renderer.Present()
+	return nil
 }
 
 // Close will free any resources, the window and quit the application.
@@ -49,6 +49,8 @@ func mapSymbolToKey(keycode sdl.Keycode) Key {
 		keyPressed = KeyF
 	case sdl.K_ESCAPE:
 		keyPressed = KeyQuit
+	case sdl.K_BACKSPACE:
+		keyPressed = KeyRewind
 	}
 
 	return keyPressed
@@ -65,10 +67,25 @@ func (i *SdlInput) Poll() *KeyEvent {
 
 	switch t := event.(type) {
 	case *sdl.KeyDownEvent:
-		return &KeyEvent{mapSymbolToKey(t.Keysym.Sym), false }
+		if slot, ok := mapSymbolToSlot(t.Keysym.Sym); ok {
+			if t.Keysym.Mod&sdl.KMOD_SHIFT != 0 {
+				return &KeyEvent{KeySaveState, false, slot}
+			}
+			return &KeyEvent{KeyLoadState, false, slot}
+		}
+		return &KeyEvent{mapSymbolToKey(t.Keysym.Sym), false, 0}
 	case *sdl.KeyUpEvent:
-		return &KeyEvent{mapSymbolToKey(t.Keysym.Sym), true }
+		return &KeyEvent{mapSymbolToKey(t.Keysym.Sym), true, 0}
 	}
 
-	return &KeyEvent{KeyNone, false }
+	return &KeyEvent{KeyNone, false, 0}
+}
+
+// mapSymbolToSlot maps the function keys F1 to F9 to the save state slots 1 to 9.
+func mapSymbolToSlot(keycode sdl.Keycode) (slot int, ok bool) {
+	if keycode >= sdl.K_F1 && keycode < sdl.K_F1+SaveSlots {
+		return int(keycode-sdl.K_F1) + 1, true
+	}
+
+	return 0, false
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+	"github.com/valep27/GChip8/src/asm"
+)
+
+// asmCommand assembles a program written in Octo syntax.
+var asmCommand = cli.Command{
+	Name:      "asm",
+	Usage:     "assemble a program written in a subset of the Octo language",
+	ArgsUsage: "[source path]",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "output file, the source path with the .ch8 extension if not set",
+		},
+		cli.StringFlag{
+			Name:  "map",
+			Usage: "symbol and source map file, the output path with the .sym.json extension if not set",
+		},
+	},
+	Action: runAsm,
+}
+
+func runAsm(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("Usage: asm [options] [source path]")
+	}
+
+	path := c.Args().First()
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read file '%s': %s", path, err)
+	}
+
+	program, err := asm.Assemble(path, src)
+	if err != nil {
+		return err
+	}
+
+	output := c.String("output")
+	if output == "" {
+		output = strings.TrimSuffix(path, filepath.Ext(path)) + ".ch8"
+	}
+
+	mapPath := c.String("map")
+	if mapPath == "" {
+		mapPath = strings.TrimSuffix(output, filepath.Ext(output)) + ".sym.json"
+	}
+
+	// the source would be overwritten, as with a source named game.ch8
+	for _, out := range []string{output, mapPath} {
+		if sameFile(out, path) {
+			return fmt.Errorf("the output file '%s' is the source file", out)
+		}
+	}
+
+	if err := ioutil.WriteFile(output, program.Binary, 0644); err != nil {
+		return fmt.Errorf("cannot write file '%s': %s", output, err)
+	}
+
+	file, err := os.Create(mapPath)
+	if err != nil {
+		return fmt.Errorf("cannot create file '%s': %s", mapPath, err)
+	}
+	defer file.Close()
+
+	return program.WriteMap(file)
+}
+
+// sameFile returns true if both paths name the same file, whether it exists or not.
+func sameFile(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/urfave/cli"
+	"github.com/valep27/GChip8/src/cfg"
+	"github.com/valep27/GChip8/src/disasm"
+)
+
+// cfgCommand exports the control-flow graph of a game.
+var cfgCommand = cli.Command{
+	Name:      "cfg",
+	Usage:     "export the control-flow graph of a game as a Graphviz DOT file",
+	ArgsUsage: "[path]",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "syntax",
+			Usage: "assembly syntax of the instructions, one of: octo, cowgod",
+			Value: "octo",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "output file, standard output if not set",
+		},
+	},
+	Action: runCfg,
+}
+
+func runCfg(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("Usage: cfg [options] [path]")
+	}
+
+	syntax, ok := disasm.ParseSyntax(c.String("syntax"))
+	if !ok {
+		return fmt.Errorf("unknown syntax '%s'", c.String("syntax"))
+	}
+
+	path := c.Args().First()
+	rom, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read file '%s': %s", path, err)
+	}
+
+	out := os.Stdout
+	if output := c.String("output"); output != "" {
+		if out, err = os.Create(output); err != nil {
+			return fmt.Errorf("cannot create file '%s': %s", output, err)
+		}
+		defer out.Close()
+	}
+
+	return cfg.Build(rom, disasm.Origin).WriteDOT(out, syntax)
+}
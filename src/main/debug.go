@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+
+	"github.com/valep27/GChip8/src/asm"
+	"github.com/valep27/GChip8/src/dap"
+	"github.com/valep27/GChip8/src/debug"
+	"github.com/valep27/GChip8/src/emu"
+)
+
+// startDebugger attaches a debugger to chip8, reading commands from the standard input.
+// If symbolsPath is set, the labels of the map written by the asm command can be used as addresses.
+func startDebugger(chip8 *emu.Chip8, symbolsPath string, blocking bool) (*debug.Debugger, error) {
+	dbg := debug.New(chip8, os.Stdout)
+	dbg.SetBlocking(blocking)
+
+	if symbolsPath != "" {
+		symbols, err := loadSymbols(symbolsPath)
+		if err != nil {
+			return nil, err
+		}
+		dbg.SetSymbols(symbols.Symbols)
+	}
+
+	dbg.Start(os.Stdin)
+	return dbg, nil
+}
+
+// startDAP attaches a debugger to chip8, controlled by a Debug Adapter Protocol client
+// connecting to a TCP address, or talking through the standard input and output if addr is "stdio".
+// It waits for the client to connect.
+func startDAP(chip8 *emu.Chip8, addr string, symbolsPath string, blocking bool) (*debug.Debugger, error) {
+	var symbols *asm.Program
+	if symbolsPath != "" {
+		var err error
+		if symbols, err = loadSymbols(symbolsPath); err != nil {
+			return nil, err
+		}
+	}
+
+	dbg := debug.New(chip8, ioutil.Discard)
+	dbg.SetBlocking(blocking)
+	server := dap.NewServer(chip8, dbg, symbols)
+
+	var conn io.ReadWriter = struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}
+
+	if addr != "stdio" {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot listen on '%s': %s", addr, err)
+		}
+		defer listener.Close()
+
+		fmt.Fprintf(os.Stderr, "waiting for a debug adapter client on %s\n", listener.Addr())
+		if conn, err = listener.Accept(); err != nil {
+			return nil, err
+		}
+	}
+
+	go func() {
+		if err := server.Serve(conn); err != nil {
+			fmt.Fprintf(os.Stderr, "debug adapter: %s\n", err)
+		}
+	}()
+
+	return dbg, nil
+}
+
+// loadSymbols reads a symbol map written by the asm command.
+func loadSymbols(path string) (*asm.Program, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file '%s': %s", path, err)
+	}
+	defer file.Close()
+
+	symbols, err := asm.ReadMap(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read symbols '%s': %s", path, err)
+	}
+
+	return symbols, nil
+}
+
+// paused returns true if the debugger, if any, has stopped the program.
+func paused(dbg *debug.Debugger) bool {
+	return dbg != nil && dbg.Paused()
+}
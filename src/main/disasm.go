@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/urfave/cli"
+	"github.com/valep27/GChip8/src/disasm"
+)
+
+// disasmCommand prints the disassembly of a game.
+var disasmCommand = cli.Command{
+	Name:      "disasm",
+	Usage:     "disassemble a game, separating code from data",
+	ArgsUsage: "[path]",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "syntax",
+			Usage: "assembly syntax, one of: octo, cowgod",
+			Value: "octo",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "output file, standard output if not set",
+		},
+	},
+	Action: runDisasm,
+}
+
+func runDisasm(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("Usage: disasm [options] [path]")
+	}
+
+	syntax, ok := disasm.ParseSyntax(c.String("syntax"))
+	if !ok {
+		return fmt.Errorf("unknown syntax '%s'", c.String("syntax"))
+	}
+
+	path := c.Args().First()
+	rom, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read file '%s': %s", path, err)
+	}
+
+	out := os.Stdout
+	if output := c.String("output"); output != "" {
+		if out, err = os.Create(output); err != nil {
+			return fmt.Errorf("cannot create file '%s': %s", output, err)
+		}
+		defer out.Close()
+	}
+
+	return disasm.Disassemble(rom, disasm.Origin).Write(out, syntax)
+}
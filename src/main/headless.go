@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+	"github.com/valep27/GChip8/src/audio"
+	"github.com/valep27/GChip8/src/debug"
+	"github.com/valep27/GChip8/src/emu"
+	"github.com/valep27/GChip8/src/headless"
+	"github.com/valep27/GChip8/src/io"
+)
+
+// headlessCommand runs a game without opening a window and outputs the final screen.
+var headlessCommand = cli.Command{
+	Name:      "headless",
+	Usage:     "run a game without display for a number of frames and output the final screen",
+	ArgsUsage: "[path]",
+	Flags: append([]cli.Flag{
+		cli.IntFlag{
+			Name:  "frames, n",
+			Usage: "number of frames to run, at 60 frames per second",
+			Value: 600,
+		},
+		cli.StringFlag{
+			Name:  "keys, k",
+			Usage: "scripted key events, e.g. '10:+5,40:-5' presses key 5 at frame 10 and releases it at frame 40",
+		},
+		cli.StringFlag{
+			Name:  "format, f",
+			Usage: "output format, one of: hash, ascii, png",
+			Value: "hash",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "output file, standard output if not set (required for png)",
+		},
+		cli.StringFlag{
+			Name:  "wav",
+			Usage: "render the audio of every frame to a WAV file, without an audio device",
+		},
+		cli.IntFlag{
+			Name:  "scale",
+			Usage: "size of a pixel in the png output",
+			Value: 1,
+		},
+		cli.StringFlag{
+			Name:  "palette",
+			Usage: "four comma separated hex colors for the png output",
+		},
+		cli.IntFlag{
+			Name:  "speed, s",
+			Usage: "CPU clock speed in instructions per second",
+			Value: emu.DefaultClockSpeed,
+		},
+		cli.StringFlag{
+			Name:  "quirks, q",
+			Usage: "quirks preset, one of: " + strings.Join(emu.QuirksPresetNames(), ", "),
+			Value: "default",
+		},
+		cli.Int64Flag{
+			Name:  "seed",
+			Usage: "seed for the random number generator",
+		},
+		cli.BoolFlag{
+			Name:  "blocks",
+			Usage: "run cached blocks of instructions instead of one instruction at a time, faster with the same result",
+		},
+		cli.BoolFlag{
+			Name:  "debug",
+			Usage: "start paused with a debugger reading commands from the standard input",
+		},
+		cli.StringFlag{
+			Name:  "dap",
+			Usage: "start paused, serving the Debug Adapter Protocol on a TCP address such as localhost:4711, or 'stdio'",
+		},
+		cli.StringFlag{
+			Name:  "symbols",
+			Usage: "symbol map written by the asm command, for the labels and source lines in the debugger and profiler",
+		},
+	}, append(traceFlags, profileFlags...)...),
+	Action: runHeadless,
+}
+
+func runHeadless(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("Usage: headless [options] [path]")
+	}
+
+	if c.Int("frames") < 0 {
+		return fmt.Errorf("--frames cannot be negative")
+	}
+
+	quirks, ok := emu.QuirksPreset(c.String("quirks"))
+	if !ok {
+		return fmt.Errorf("unknown quirks preset '%s'", c.String("quirks"))
+	}
+
+	script, err := headless.ParseScript(c.String("keys"))
+	if err != nil {
+		return err
+	}
+
+	palette := io.DefaultPalette
+	if c.IsSet("palette") {
+		if palette, err = io.ParsePalette(c.String("palette")); err != nil {
+			return err
+		}
+	}
+
+	format, output := c.String("format"), c.String("output")
+	if format != "hash" && format != "ascii" && format != "png" {
+		return fmt.Errorf("unknown output format '%s'", format)
+	}
+	if format == "png" && output == "" {
+		return fmt.Errorf("the png format requires an output file")
+	}
+	if c.String("dap") == "stdio" && output == "" {
+		return fmt.Errorf("--dap stdio requires an output file")
+	}
+	if c.Bool("debug") && c.IsSet("dap") {
+		return fmt.Errorf("--debug and --dap cannot be used together")
+	}
+
+	traceOpts, err := parseTraceOptions(c)
+	if err != nil {
+		return err
+	}
+
+	chip8 := emu.New()
+	if err := chip8.LoadRom(c.Args().First()); err != nil {
+		return err
+	}
+	chip8.SetClockSpeed(c.Int("speed"))
+	chip8.SetQuirks(quirks)
+	// always seeded, so that runs without --seed are reproducible too
+	chip8.SeedRandom(c.Int64("seed"))
+	chip8.SetBlockCache(c.Bool("blocks"))
+
+	tracer, stopTrace, err := startTrace(traceOpts)
+	if err != nil {
+		return err
+	}
+	defer stopTrace()
+
+	profiler, stopProfile, err := startProfile(chip8, parseProfileOptions(c))
+	if err != nil {
+		return err
+	}
+	defer stopProfile()
+
+	setTracers(chip8, tracer, profiler)
+
+	var runner headless.FrameRunner = chip8
+	switch {
+	case c.Bool("debug"):
+		if runner, err = startDebugger(chip8, c.String("symbols"), true); err != nil {
+			return err
+		}
+	case c.IsSet("dap"):
+		if runner, err = startDAP(chip8, c.String("dap"), c.String("symbols"), true); err != nil {
+			return err
+		}
+	}
+
+	var recorder *audioRecorder
+	if c.IsSet("wav") {
+		recorder = &audioRecorder{runner: runner, chip8: chip8, synth: audio.NewSynth(audio.DefaultSampleRate)}
+		runner = recorder
+	}
+
+	// quitting the debugger ends the run early, the screen is output all the same
+	err = headless.RunWith(chip8, runner, c.Int("frames"), script)
+	if err != nil && !errors.Is(err, debug.ErrQuit) {
+		return err
+	}
+
+	if recorder != nil {
+		if err := saveWav(c.String("wav"), recorder.synth.SampleRate(), recorder.samples); err != nil {
+			return err
+		}
+	}
+
+	out := os.Stdout
+	if output != "" {
+		if out, err = os.Create(output); err != nil {
+			return fmt.Errorf("cannot create file '%s': %s", output, err)
+		}
+		defer out.Close()
+	}
+
+	framebuffer := chip8.GetPixelFrameBuffer()
+	width, height := chip8.Resolution()
+
+	switch format {
+	case "png":
+		err = headless.WritePNG(out, framebuffer, width, height, c.Int("scale"), palette)
+	case "ascii":
+		_, err = fmt.Fprint(out, headless.ASCII(framebuffer, width, height))
+	default:
+		_, err = fmt.Fprintln(out, headless.Hash(framebuffer))
+	}
+
+	return err
+}
+
+// audioRecorder renders the audio of every frame run by runner.
+type audioRecorder struct {
+	runner  headless.FrameRunner
+	chip8   *emu.Chip8
+	synth   *audio.Synth
+	samples []int16
+}
+
+func (r *audioRecorder) RunFrame() error {
+	if err := r.runner.RunFrame(); err != nil {
+		return err
+	}
+
+	r.samples = append(r.samples, r.synth.RenderFrame(r.chip8.Audio())...)
+	return nil
+}
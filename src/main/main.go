@@ -1,16 +1,27 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/urfave/cli"
+	"github.com/valep27/GChip8/src/audio"
+	"github.com/valep27/GChip8/src/debug"
 	"github.com/valep27/GChip8/src/emu"
 	"github.com/valep27/GChip8/src/io"
+	"github.com/valep27/GChip8/src/movie"
+	"github.com/valep27/GChip8/src/rewind"
 )
 
 func main() {
 	var path string
+	var ipf int
+	var quirksName, paletteColors string
+	var opts options
 	app := cli.NewApp()
 
 	app.Name = "GChip8"
@@ -22,7 +33,73 @@ func main() {
 			Usage:       "game file path",
 			Destination: &path,
 		},
+		cli.IntFlag{
+			Name:        "speed, s",
+			Usage:       "CPU clock speed in instructions per second",
+			Value:       emu.DefaultClockSpeed,
+			Destination: &opts.speed,
+		},
+		cli.IntFlag{
+			Name:        "ipf",
+			Usage:       "CPU clock speed in instructions per frame (overrides --speed)",
+			Destination: &ipf,
+		},
+		cli.StringFlag{
+			Name:        "quirks, q",
+			Usage:       "quirks preset, one of: " + strings.Join(emu.QuirksPresetNames(), ", "),
+			Value:       "default",
+			Destination: &quirksName,
+		},
+		cli.StringFlag{
+			Name:        "palette",
+			Usage:       "four comma separated hex colors for the XO-CHIP bitplanes, e.g. 000000,FFFFFF,FF6600,662200",
+			Destination: &paletteColors,
+		},
+		cli.StringFlag{
+			Name:        "wav",
+			Usage:       "record the audio output to a WAV file",
+			Destination: &opts.wavPath,
+		},
+		cli.IntFlag{
+			Name:        "rewind",
+			Usage:       "seconds of gameplay kept for rewinding (0 disables rewind)",
+			Value:       10,
+			Destination: &opts.rewindSeconds,
+		},
+		cli.Int64Flag{
+			Name:  "seed",
+			Usage: "seed for the random number generator, for reproducible runs",
+		},
+		cli.StringFlag{
+			Name:        "record",
+			Usage:       "record the keypad input to a movie file",
+			Destination: &opts.recordPath,
+		},
+		cli.StringFlag{
+			Name:        "play",
+			Usage:       "play back a movie file, reporting any desync",
+			Destination: &opts.playPath,
+		},
+		cli.BoolFlag{
+			Name:        "debug",
+			Usage:       "start paused with a debugger reading commands from the standard input",
+			Destination: &opts.debug,
+		},
+		cli.StringFlag{
+			Name:        "dap",
+			Usage:       "start paused, serving the Debug Adapter Protocol on a TCP address such as localhost:4711, or 'stdio'",
+			Destination: &opts.dapAddr,
+		},
+		cli.StringFlag{
+			Name:        "symbols",
+			Usage:       "symbol map written by the asm command, for the labels and source lines in the debugger and profiler",
+			Destination: &opts.symbolsPath,
+		},
 	}
+	app.Flags = append(app.Flags, traceFlags...)
+	app.Flags = append(app.Flags, profileFlags...)
+
+	app.Commands = []cli.Command{headlessCommand, disasmCommand, asmCommand, cfgCommand}
 
 	app.Action = func(c *cli.Context) error {
 		args := c.Args()
@@ -31,47 +108,371 @@ func main() {
 		}
 
 		path := args.Get(0)
-		return run(path)
+
+		if ipf > 0 {
+			opts.speed = ipf * emu.TimerFrequency
+		}
+
+		if opts.rewindSeconds < 0 {
+			return fmt.Errorf("--rewind cannot be negative")
+		}
+
+		var ok bool
+		if opts.quirks, ok = emu.QuirksPreset(quirksName); !ok {
+			return fmt.Errorf("unknown quirks preset '%s'", quirksName)
+		}
+
+		opts.palette = io.DefaultPalette
+		if paletteColors != "" {
+			var err error
+			if opts.palette, err = io.ParsePalette(paletteColors); err != nil {
+				return err
+			}
+		}
+
+		if opts.recordPath != "" && opts.playPath != "" {
+			return fmt.Errorf("--record and --play cannot be used together")
+		}
+
+		if opts.debug && opts.dapAddr != "" {
+			return fmt.Errorf("--debug and --dap cannot be used together")
+		}
+
+		if (opts.debug || opts.dapAddr != "") && (opts.recordPath != "" || opts.playPath != "") {
+			return fmt.Errorf("the debugger cannot be used with --record or --play")
+		}
+
+		if c.IsSet("seed") {
+			seed := c.Int64("seed")
+			opts.seed = &seed
+		}
+
+		var err error
+		if opts.trace, err = parseTraceOptions(c); err != nil {
+			return err
+		}
+		opts.profile = parseProfileOptions(c)
+
+		return run(path, opts)
 	}
-	app.Run(os.Args)
+
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", app.Name, err)
+		os.Exit(1)
+	}
+}
+
+// options holds the emulator settings given on the command line.
+type options struct {
+	speed   int
+	quirks  emu.Quirks
+	palette io.Palette
+	wavPath string
+	seed    *int64
+
+	rewindSeconds int
+	recordPath    string
+	playPath      string
+
+	debug       bool
+	dapAddr     string
+	symbolsPath string
+
+	trace   traceOptions
+	profile profileOptions
 }
 
-func run(path string) error {
+func run(path string, opts options) error {
 	var event *io.KeyEvent
+	var recording []int16
+	var rewinding bool
 
 	if _, err := os.Stat(path); err != nil {
 		return fmt.Errorf("cannot open file '%s': %s", path, err)
 	}
 
+	rom, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read file '%s': %s", path, err)
+	}
+
 	chip8 := emu.New()
-	chip8.LoadRom(path)
+	if err := chip8.LoadBytes(rom); err != nil {
+		return err
+	}
+	chip8.SetClockSpeed(opts.speed)
+	chip8.SetQuirks(opts.quirks)
+
+	if opts.seed != nil {
+		chip8.SeedRandom(*opts.seed)
+	}
+
+	tracer, stopTrace, err := startTrace(opts.trace)
+	if err != nil {
+		return err
+	}
+	defer stopTrace()
+
+	profiler, stopProfile, err := startProfile(chip8, opts.profile)
+	if err != nil {
+		return err
+	}
+	defer stopProfile()
+
+	setTracers(chip8, tracer, profiler)
+
+	var recorder *movie.Recorder
+	var player *movie.Player
+
+	if opts.recordPath != "" {
+		// the seed must be known to replay the movie
+		seed := time.Now().UnixNano()
+		if opts.seed != nil {
+			seed = *opts.seed
+		}
+		chip8.SeedRandom(seed)
+
+		recorder = movie.NewRecorder(rom, seed, chip8.Quirks(), chip8.ClockSpeed())
+		defer func() {
+			if err := saveMovie(opts.recordPath, recorder.Movie()); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}()
+	}
+
+	if opts.playPath != "" {
+		m, err := loadMovie(opts.playPath)
+		if err != nil {
+			return err
+		}
+
+		if err := m.Setup(chip8, rom); err != nil {
+			return fmt.Errorf("cannot play movie '%s': %s", opts.playPath, err)
+		}
+
+		player = movie.NewPlayer(m)
+	}
+
+	// rewinding or loading a state would make the movie impossible to replay
+	movieMode := recorder != nil || player != nil
+
+	// with the debugger, frames are run by it so that it can stop in the middle of one
+	runFrame := chip8.RunFrame
+	var dbg *debug.Debugger
+
+	if opts.debug {
+		if dbg, err = startDebugger(chip8, opts.symbolsPath, false); err != nil {
+			return err
+		}
+		runFrame = dbg.RunFrame
+	}
+
+	if opts.dapAddr != "" {
+		if dbg, err = startDAP(chip8, opts.dapAddr, opts.symbolsPath, false); err != nil {
+			return err
+		}
+		runFrame = dbg.RunFrame
+	}
 
 	front := io.NewSdlFrontend()
+	front.SetPalette(opts.palette)
 	input := io.NewSdlInput()
-	front.Initialize()
+	if err := front.Initialize(); err != nil {
+		return err
+	}
 	defer front.Close()
 
-	drawChan := make(chan []uint8)
-	go draw(front, drawChan)
+	synth := audio.NewSynth(audio.DefaultSampleRate)
+	speaker := io.NewSdlAudio(synth.SampleRate())
+	if err := speaker.Initialize(); err != nil {
+		return err
+	}
+	defer speaker.Close()
+
+	if opts.wavPath != "" {
+		defer func() {
+			if err := saveWav(opts.wavPath, synth.SampleRate(), recording); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}()
+	}
+
+	history := rewind.NewBuffer(opts.rewindSeconds * emu.TimerFrequency)
+
+	// the emulation is paced by frames: the timers tick at 60 Hz
+	// while the CPU runs as many instructions per frame as the clock speed allows.
+	frames := time.NewTicker(time.Second / emu.TimerFrequency)
+	defer frames.Stop()
 
 	for {
-		chip8.Step()
-		drawChan <- chip8.GetPixelFrameBuffer()
+		<-frames.C
+		if rewinding {
+			// play backwards, one recorded frame at a time
+			if state, ok := history.Pop(); ok {
+				if err := chip8.Restore(state); err != nil {
+					return err
+				}
+			}
+		} else {
+			if player != nil {
+				player.StartFrame(chip8)
+			}
+
+			if err := runFrame(); err != nil {
+				if errors.Is(err, debug.ErrQuit) {
+					return nil
+				}
+				return err
+			}
+
+			if recorder != nil {
+				recorder.EndFrame(chip8.GetPixelFrameBuffer())
+			}
+
+			if player != nil {
+				if err := player.EndFrame(chip8.GetPixelFrameBuffer()); err != nil {
+					return err
+				}
+
+				if player.Done() {
+					fmt.Printf("movie played back without desync (%d frames)\n", player.Frame())
+					return nil
+				}
+			}
+
+			if opts.rewindSeconds > 0 && !movieMode && !paused(dbg) {
+				history.Push(chip8.Snapshot())
+			}
+		}
+
+		// the sound timer does not run while paused in the debugger, and neither does the audio
+		if !paused(dbg) {
+			samples := synth.RenderFrame(chip8.Audio())
+			if err := speaker.Queue(samples); err != nil {
+				return err
+			}
+
+			if opts.wavPath != "" {
+				recording = append(recording, samples...)
+			}
+		}
+
+		if chip8.Exited() {
+			return nil
+		}
+
+		width, height := chip8.Resolution()
+		if err := front.Draw(chip8.GetPixelFrameBuffer(), width, height); err != nil {
+			return err
+		}
 
 		for event = input.Poll(); event != nil; event = input.Poll() {
 
-			if event.Key == io.KeyQuit {
+			switch event.Key {
+			case io.KeyQuit:
 				return nil
-			}
+			case io.KeySaveState:
+				reportStateError(saveState(chip8, path, event.Slot))
+			case io.KeyLoadState:
+				if movieMode {
+					continue
+				}
+				reportStateError(loadState(chip8, path, event.Slot))
+				history.Clear()
+			case io.KeyRewind:
+				rewinding = !event.Up && !movieMode
+			default:
+				// during playback the keypad is driven by the movie
+				if player != nil {
+					continue
+				}
+
+				chip8.HandleKeyEvent(uint8(event.Key), event.Up)
 
-			chip8.HandleKeyEvent(uint8(event.Key), event.Up)
+				if recorder != nil {
+					recorder.HandleKeyEvent(uint8(event.Key), event.Up)
+				}
+			}
 		}
 	}
 }
 
-func draw(front io.SdlFrontend, c chan []uint8) {
-	for {
-		buffer := <-c
-		front.Draw(buffer)
+// saveWav writes the recorded audio samples to a WAV file.
+func saveWav(path string, sampleRate int, samples []int16) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return fmt.Errorf("cannot create file '%s': %s", path, err)
+	}
+	defer file.Close()
+
+	return audio.WriteWav(file, sampleRate, samples)
+}
+
+// saveMovie writes a recorded movie to a file.
+func saveMovie(path string, m *movie.Movie) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return fmt.Errorf("cannot create file '%s': %s", path, err)
+	}
+	defer file.Close()
+
+	return m.Save(file)
+}
+
+// loadMovie reads a movie from a file.
+func loadMovie(path string) (*movie.Movie, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file '%s': %s", path, err)
+	}
+	defer file.Close()
+
+	m, err := movie.Load(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load movie '%s': %s", path, err)
+	}
+
+	return m, nil
+}
+
+// statePath returns the path of a save state slot, stored next to the rom.
+func statePath(romPath string, slot int) string {
+	return fmt.Sprintf("%s.state%d", romPath, slot)
+}
+
+// saveState writes a snapshot of the emulator to the given slot.
+func saveState(chip8 *emu.Chip8, romPath string, slot int) error {
+	path := statePath(romPath, slot)
+
+	if err := ioutil.WriteFile(path, chip8.Snapshot(), 0644); err != nil {
+		return fmt.Errorf("cannot save state to '%s': %s", path, err)
+	}
+
+	return nil
+}
+
+// loadState restores the emulator from the snapshot in the given slot.
+func loadState(chip8 *emu.Chip8, romPath string, slot int) error {
+	path := statePath(romPath, slot)
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return fmt.Errorf("cannot load state from '%s': %s", path, err)
+	}
+
+	if err := chip8.Restore(data); err != nil {
+		return fmt.Errorf("cannot load state from '%s': %s", path, err)
+	}
+
+	return nil
+}
+
+// reportStateError prints save state errors without stopping the emulation.
+func reportStateError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 	}
 }
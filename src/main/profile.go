@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli"
+	"github.com/valep27/GChip8/src/asm"
+	"github.com/valep27/GChip8/src/emu"
+	"github.com/valep27/GChip8/src/profile"
+)
+
+// profileFlags are the flags that enable the profiler, shared by the commands that run games.
+var profileFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "profile",
+		Usage: "write a pprof profile of the executed instructions to a file, see 'go tool pprof'",
+	},
+	cli.StringFlag{
+		Name:  "profile-ops",
+		Usage: "write a histogram of the executed opcodes to a file",
+	},
+}
+
+// profileOptions holds the profiler settings given on the command line.
+type profileOptions struct {
+	path        string
+	opsPath     string
+	symbolsPath string
+}
+
+// parseProfileOptions reads the profiler flags.
+func parseProfileOptions(c *cli.Context) profileOptions {
+	return profileOptions{
+		path:        c.String("profile"),
+		opsPath:     c.String("profile-ops"),
+		symbolsPath: c.String("symbols"),
+	}
+}
+
+// startProfile returns a function counting the instructions executed by chip8 for the profile,
+// or nil if no profile is requested.
+// The returned stop function writes the profile and must be called when the run is over.
+func startProfile(chip8 *emu.Chip8, opts profileOptions) (emu.TraceFunc, func(), error) {
+	if opts.path == "" && opts.opsPath == "" {
+		return nil, func() {}, nil
+	}
+
+	var symbols *asm.Program
+	if opts.symbolsPath != "" {
+		var err error
+		if symbols, err = loadSymbols(opts.symbolsPath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	profiler := profile.New(chip8, symbols)
+
+	return profiler.Trace, func() {
+		if opts.path != "" {
+			reportProfileError(writeProfile(opts.path, profiler.Write))
+		}
+		if opts.opsPath != "" {
+			reportProfileError(writeProfile(opts.opsPath, profiler.WriteHistogram))
+		}
+	}, nil
+}
+
+// writeProfile creates a file and fills it with write.
+func writeProfile(path string, write func(w io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot create file '%s': %s", path, err)
+	}
+	defer file.Close()
+
+	if err := write(file); err != nil {
+		return fmt.Errorf("cannot write profile '%s': %s", path, err)
+	}
+
+	return nil
+}
+
+// reportProfileError prints profile errors, once the run is over.
+func reportProfileError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
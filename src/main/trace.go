@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+	"github.com/valep27/GChip8/src/emu"
+	"github.com/valep27/GChip8/src/trace"
+)
+
+// traceFlags are the flags that enable the instruction trace, shared by the commands that run games.
+var traceFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "trace",
+		Usage: "log every executed instruction to a file",
+	},
+	cli.StringFlag{
+		Name:  "trace-format",
+		Usage: "trace format, one of: human, machine",
+		Value: "human",
+	},
+	cli.StringFlag{
+		Name:  "trace-range",
+		Usage: "only trace the instructions at these comma separated addresses or ranges, e.g. 0x200-0x2FF,0x3A0",
+	},
+	cli.StringFlag{
+		Name:  "trace-ops",
+		Usage: "only trace these comma separated opcode classes (" + trace.ClassNames + ") or first opcode nibbles, e.g. flow,8",
+	},
+}
+
+// traceOptions holds the trace settings given on the command line.
+type traceOptions struct {
+	path   string
+	format trace.Format
+	filter trace.Filter
+}
+
+// parseTraceOptions reads the trace flags.
+func parseTraceOptions(c *cli.Context) (traceOptions, error) {
+	var opts traceOptions
+	var ok bool
+	var err error
+
+	opts.path = c.String("trace")
+	if opts.format, ok = trace.ParseFormat(c.String("trace-format")); !ok {
+		return opts, fmt.Errorf("unknown trace format '%s'", c.String("trace-format"))
+	}
+	if opts.filter.Ranges, err = trace.ParseRanges(c.String("trace-range")); err != nil {
+		return opts, err
+	}
+	if opts.filter.Classes, err = trace.ParseClasses(c.String("trace-ops")); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+// startTrace returns a function logging the instructions to the trace file, or nil if there is none.
+// The returned stop function ends the trace and must be called when the run is over.
+func startTrace(opts traceOptions) (emu.TraceFunc, func(), error) {
+	if opts.path == "" {
+		return nil, func() {}, nil
+	}
+
+	file, err := os.Create(opts.path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create file '%s': %s", opts.path, err)
+	}
+
+	tracer := trace.New(file, opts.format, opts.filter)
+
+	return tracer.Trace, func() {
+		if err := tracer.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot write trace '%s': %s\n", opts.path, err)
+		}
+		file.Close()
+	}, nil
+}
+
+// setTracers registers the functions that are not nil as the tracer of chip8, called in order.
+func setTracers(chip8 *emu.Chip8, funcs ...emu.TraceFunc) {
+	var active []emu.TraceFunc
+	for _, f := range funcs {
+		if f != nil {
+			active = append(active, f)
+		}
+	}
+
+	switch len(active) {
+	case 0:
+		chip8.SetTracer(nil)
+	case 1:
+		chip8.SetTracer(active[0])
+	default:
+		chip8.SetTracer(func(e *emu.TraceEntry) {
+			for _, f := range active {
+				f(e)
+			}
+		})
+	}
+}
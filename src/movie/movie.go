@@ -0,0 +1,221 @@
+// Package movie records the keypad input of a game session and plays it back deterministically.
+//
+// A movie stores everything needed to reproduce a run: the hash of the rom, the seed of the
+// random number generator, the quirks and clock speed, the key events tagged with the frame
+// they happened in, and the hash of the framebuffer at the end of every frame, used to detect
+// when the playback diverges from the recording.
+package movie
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+
+	"github.com/valep27/GChip8/src/emu"
+)
+
+const (
+	movieMagic   = "GC8M"
+	movieVersion = 1
+)
+
+var (
+	// ErrInvalidMovie is returned when loading a corrupted movie file.
+	ErrInvalidMovie = errors.New("invalid movie")
+	// ErrRomMismatch is returned when playing a movie with a different rom than the recorded one.
+	ErrRomMismatch = errors.New("movie was recorded with a different rom")
+)
+
+// Event is a keypad change, applied before running the frame with index Frame.
+type Event struct {
+	Frame uint32
+	Key   uint8
+	Up    bool
+}
+
+// Movie is a recorded game session.
+type Movie struct {
+	RomHash    [sha256.Size]byte
+	Seed       int64
+	ClockSpeed int
+	Quirks     emu.Quirks
+	Events     []Event
+	// FrameHashes holds the framebuffer hash at the end of each recorded frame.
+	FrameHashes []uint64
+}
+
+// DesyncError is returned by the player when the framebuffer differs from the recorded one.
+type DesyncError struct {
+	Frame uint32
+	Want  uint64
+	Got   uint64
+}
+
+func (e *DesyncError) Error() string {
+	return fmt.Sprintf("desync at frame %d: framebuffer hash is %016x, recorded %016x", e.Frame, e.Got, e.Want)
+}
+
+// RomHash returns the hash used to identify the rom of a movie.
+func RomHash(rom []byte) [sha256.Size]byte {
+	return sha256.Sum256(rom)
+}
+
+// FrameHash returns the hash of a framebuffer, as returned by emu.Chip8.GetPixelFrameBuffer.
+func FrameHash(framebuffer []uint8) uint64 {
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, uint32(len(framebuffer)))
+	h.Write(framebuffer)
+	return h.Sum64()
+}
+
+// Frames returns the number of recorded frames.
+func (m *Movie) Frames() int {
+	return len(m.FrameHashes)
+}
+
+// Setup configures a machine to play the movie: it checks the rom hash and applies
+// the recorded seed, quirks and clock speed. The rom must already be loaded.
+func (m *Movie) Setup(c8 *emu.Chip8, rom []byte) error {
+	if RomHash(rom) != m.RomHash {
+		return ErrRomMismatch
+	}
+
+	c8.SeedRandom(m.Seed)
+	c8.SetQuirks(m.Quirks)
+	c8.SetClockSpeed(m.ClockSpeed)
+	return nil
+}
+
+// movieHeader is the fixed size part of the movie file.
+type movieHeader struct {
+	RomHash     [sha256.Size]byte
+	Seed        int64
+	ClockSpeed  uint32
+	Quirks      quirksRecord
+	EventsCount uint32
+	FramesCount uint32
+}
+
+// quirksRecord is the encoding of the quirks. Its fields are listed explicitly, so that
+// adding a quirk to emu.Quirks does not change the format: new quirks need a new movie version.
+type quirksRecord struct {
+	ShiftUsesVy        bool
+	LoadStoreIncrement uint8
+	JumpUsesVx         bool
+	WrapSprites        bool
+	ResetVFOnLogic     bool
+	DisplayWait        bool
+	KeyWaitRelease     bool
+}
+
+func encodeQuirks(q emu.Quirks) quirksRecord {
+	return quirksRecord{
+		ShiftUsesVy:        q.ShiftUsesVy,
+		LoadStoreIncrement: uint8(q.LoadStoreIncrement),
+		JumpUsesVx:         q.JumpUsesVx,
+		WrapSprites:        q.WrapSprites,
+		ResetVFOnLogic:     q.ResetVFOnLogic,
+		DisplayWait:        q.DisplayWait,
+		KeyWaitRelease:     q.KeyWaitRelease,
+	}
+}
+
+func (q quirksRecord) decode() emu.Quirks {
+	return emu.Quirks{
+		ShiftUsesVy:        q.ShiftUsesVy,
+		LoadStoreIncrement: emu.IncrementMode(q.LoadStoreIncrement),
+		JumpUsesVx:         q.JumpUsesVx,
+		WrapSprites:        q.WrapSprites,
+		ResetVFOnLogic:     q.ResetVFOnLogic,
+		DisplayWait:        q.DisplayWait,
+		KeyWaitRelease:     q.KeyWaitRelease,
+	}
+}
+
+// eventRecord is the encoding of a single event.
+type eventRecord struct {
+	Frame uint32
+	Key   uint8
+	Up    bool
+}
+
+// Save writes the movie to w.
+//
+// The format is the 4 bytes magic "GC8M", a 16 bit version, the header with the rom hash,
+// the seed, the clock speed, the quirks and the number of events and frames, then the events
+// and the frame hashes. All values are little endian.
+func (m *Movie) Save(w io.Writer) error {
+	var buf bytes.Buffer
+
+	buf.WriteString(movieMagic)
+	binary.Write(&buf, binary.LittleEndian, uint16(movieVersion))
+	binary.Write(&buf, binary.LittleEndian, movieHeader{
+		m.RomHash,
+		m.Seed,
+		uint32(m.ClockSpeed),
+		encodeQuirks(m.Quirks),
+		uint32(len(m.Events)),
+		uint32(len(m.FrameHashes)),
+	})
+
+	for _, e := range m.Events {
+		binary.Write(&buf, binary.LittleEndian, eventRecord{e.Frame, e.Key, e.Up})
+	}
+
+	binary.Write(&buf, binary.LittleEndian, m.FrameHashes)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Load reads a movie written by Save.
+func Load(r io.Reader) (*Movie, error) {
+	magic := make([]byte, len(movieMagic))
+	var version uint16
+	var header movieHeader
+
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != movieMagic {
+		return nil, fmt.Errorf("%w: bad header", ErrInvalidMovie)
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil || version != movieVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidMovie, version)
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMovie, err)
+	}
+
+	m := &Movie{
+		RomHash:    header.RomHash,
+		Seed:       header.Seed,
+		ClockSpeed: int(header.ClockSpeed),
+		Quirks:     header.Quirks.decode(),
+	}
+
+	for i := uint32(0); i < header.EventsCount; i++ {
+		var e eventRecord
+
+		if err := binary.Read(r, binary.LittleEndian, &e); err != nil {
+			return nil, fmt.Errorf("%w: truncated events: %s", ErrInvalidMovie, err)
+		}
+
+		m.Events = append(m.Events, Event{e.Frame, e.Key, e.Up})
+	}
+
+	for i := uint32(0); i < header.FramesCount; i++ {
+		var hash uint64
+
+		if err := binary.Read(r, binary.LittleEndian, &hash); err != nil {
+			return nil, fmt.Errorf("%w: truncated frame hashes: %s", ErrInvalidMovie, err)
+		}
+
+		m.FrameHashes = append(m.FrameHashes, hash)
+	}
+
+	return m, nil
+}
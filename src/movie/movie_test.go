@@ -0,0 +1,166 @@
+package movie
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/valep27/GChip8/src/emu"
+)
+
+func loadGame(t *testing.T, name string) (*emu.Chip8, []byte) {
+	t.Helper()
+
+	rom, err := ioutil.ReadFile("../../games/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c8 := emu.New()
+	if err := c8.LoadBytes(rom); err != nil {
+		t.Fatal(err)
+	}
+
+	return c8, rom
+}
+
+// record plays BRIX moving the paddle around and returns the recorded movie.
+func record(t *testing.T) *Movie {
+	t.Helper()
+
+	c8, rom := loadGame(t, "BRIX")
+	c8.SeedRandom(7)
+	rec := NewRecorder(rom, 7, c8.Quirks(), c8.ClockSpeed())
+
+	keys := map[int]Event{
+		20:  {Key: 4},
+		60:  {Key: 4, Up: true},
+		70:  {Key: 6},
+		150: {Key: 6, Up: true},
+	}
+
+	for frame := 0; frame < 200; frame++ {
+		if err := c8.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+		rec.EndFrame(c8.GetPixelFrameBuffer())
+
+		if e, ok := keys[frame]; ok {
+			c8.HandleKeyEvent(e.Key, e.Up)
+			rec.HandleKeyEvent(e.Key, e.Up)
+		}
+	}
+
+	return rec.Movie()
+}
+
+// play replays a movie on a new machine, returning the first error.
+func play(t *testing.T, m *Movie) error {
+	t.Helper()
+
+	c8, rom := loadGame(t, "BRIX")
+	if err := m.Setup(c8, rom); err != nil {
+		return err
+	}
+
+	player := NewPlayer(m)
+	for !player.Done() {
+		player.StartFrame(c8)
+		if err := c8.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+		if err := player.EndFrame(c8.GetPixelFrameBuffer()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestPlaybackMatchesRecording(t *testing.T) {
+	m := record(t)
+
+	var buf bytes.Buffer
+	if err := m.Save(&buf); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(loaded.Events) != 4 || loaded.Frames() != 200 {
+		t.Errorf("loaded %d events and %d frames, want 4 and 200", len(loaded.Events), loaded.Frames())
+	}
+
+	if err := play(t, loaded); err != nil {
+		t.Errorf("playback error = %v", err)
+	}
+}
+
+func TestPlaybackDetectsDesync(t *testing.T) {
+	m := record(t)
+	// a different seed changes the direction of the ball
+	m.Seed++
+
+	var desync *DesyncError
+	if err := play(t, m); !errors.As(err, &desync) {
+		t.Fatalf("playback error = %v, want a desync", err)
+	}
+}
+
+func TestSetupChecksRom(t *testing.T) {
+	m := record(t)
+	c8, rom := loadGame(t, "PONG")
+
+	if err := m.Setup(c8, rom); !errors.Is(err, ErrRomMismatch) {
+		t.Errorf("Setup() error = %v, want %v", err, ErrRomMismatch)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	if err := record(t).Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", append([]byte("NOPE"), valid[4:]...)},
+		{"future version", append([]byte("GC8M\xFF\x00"), valid[6:]...)},
+		{"truncated", valid[:len(valid)-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(bytes.NewReader(tt.data)); !errors.Is(err, ErrInvalidMovie) {
+				t.Errorf("Load() error = %v, want %v", err, ErrInvalidMovie)
+			}
+		})
+	}
+}
+
+func TestSaveLoadQuirks(t *testing.T) {
+	m := &Movie{Quirks: emu.QuirksCosmacVIP}
+
+	var buf bytes.Buffer
+	if err := m.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// magic, version, rom hash, seed, clock speed, 7 quirks, events and frames counts
+	if want := 4 + 2 + 32 + 8 + 4 + 7 + 4 + 4; buf.Len() != want {
+		t.Errorf("empty movie is %d bytes, want %d", buf.Len(), want)
+	}
+
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Quirks != emu.QuirksCosmacVIP {
+		t.Errorf("Load() quirks = %+v, want %+v", loaded.Quirks, emu.QuirksCosmacVIP)
+	}
+}
@@ -0,0 +1,53 @@
+package movie
+
+import "github.com/valep27/GChip8/src/emu"
+
+// Player replays a movie on a machine configured with Movie.Setup.
+// StartFrame must be called before every emulated frame and EndFrame after it.
+type Player struct {
+	movie *Movie
+	frame uint32
+	next  int
+}
+
+// NewPlayer creates a player for the given movie.
+func NewPlayer(m *Movie) *Player {
+	return &Player{m, 0, 0}
+}
+
+// StartFrame sends the key events recorded for the frame about to run to the machine.
+func (p *Player) StartFrame(c8 *emu.Chip8) {
+	for p.next < len(p.movie.Events) && p.movie.Events[p.next].Frame <= p.frame {
+		e := p.movie.Events[p.next]
+		c8.HandleKeyEvent(e.Key, e.Up)
+		p.next++
+	}
+}
+
+// EndFrame compares the framebuffer with the recorded one,
+// returning a *DesyncError if they differ.
+func (p *Player) EndFrame(framebuffer []uint8) error {
+	frame := p.frame
+	p.frame++
+
+	if int(frame) >= len(p.movie.FrameHashes) {
+		return nil
+	}
+
+	want := p.movie.FrameHashes[frame]
+	if got := FrameHash(framebuffer); got != want {
+		return &DesyncError{frame, want, got}
+	}
+
+	return nil
+}
+
+// Done returns true when all the recorded frames have been played.
+func (p *Player) Done() bool {
+	return int(p.frame) >= p.movie.Frames()
+}
+
+// Frame returns the index of the next frame to be played.
+func (p *Player) Frame() int {
+	return int(p.frame)
+}
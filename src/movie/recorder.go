@@ -0,0 +1,41 @@
+package movie
+
+import "github.com/valep27/GChip8/src/emu"
+
+// Recorder builds a movie while a game is played.
+// Key events must be passed to HandleKeyEvent along with the emulator,
+// and EndFrame must be called after every emulated frame.
+type Recorder struct {
+	movie *Movie
+}
+
+// NewRecorder starts recording a movie of the given rom.
+// The machine must already be configured with the given seed, quirks and clock speed.
+func NewRecorder(rom []byte, seed int64, quirks emu.Quirks, clockSpeed int) *Recorder {
+	return &Recorder{&Movie{
+		RomHash:    RomHash(rom),
+		Seed:       seed,
+		ClockSpeed: clockSpeed,
+		Quirks:     quirks,
+	}}
+}
+
+// HandleKeyEvent records a keypad change. It will be replayed before the next frame.
+func (r *Recorder) HandleKeyEvent(key uint8, up bool) {
+	// command keys never reach the keypad, so they are not part of the movie
+	if key > 0xF {
+		return
+	}
+
+	r.movie.Events = append(r.movie.Events, Event{uint32(r.movie.Frames()), key, up})
+}
+
+// EndFrame records the framebuffer at the end of a frame.
+func (r *Recorder) EndFrame(framebuffer []uint8) {
+	r.movie.FrameHashes = append(r.movie.FrameHashes, FrameHash(framebuffer))
+}
+
+// Movie returns the movie recorded so far.
+func (r *Recorder) Movie() *Movie {
+	return r.movie
+}
@@ -0,0 +1,154 @@
+package profile
+
+// The profile is written in the protocol buffer format of pprof, described in
+// https://github.com/google/pprof/blob/main/proto/profile.proto.
+// Only the few wire types needed are encoded here, to avoid depending on a protobuf library.
+
+// Field numbers of the messages of profile.proto.
+const (
+	// Profile
+	profileSampleType    = 1
+	profileSample        = 2
+	profileMapping       = 3
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+	profileDefaultType   = 14
+
+	// ValueType
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	// Sample
+	sampleLocationID = 1
+	sampleValue      = 2
+	sampleLabel      = 3
+
+	// Label
+	labelKey = 1
+	labelStr = 2
+
+	// Mapping
+	mappingID           = 1
+	mappingMemoryStart  = 2
+	mappingMemoryLimit  = 3
+	mappingFilename     = 5
+	mappingHasFunctions = 7
+	mappingHasFilenames = 8
+	mappingHasLines     = 9
+
+	// Location
+	locationID        = 1
+	locationMappingID = 2
+	locationAddress   = 3
+	locationLine      = 4
+
+	// Line
+	lineFunctionID = 1
+	lineLine       = 2
+
+	// Function
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+	functionStartLine  = 5
+)
+
+// Protocol buffer wire types.
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// encoder builds a protocol buffer message.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) varint(v uint64) {
+	for v >= 0x80 {
+		e.buf = append(e.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) key(field, wire int) {
+	e.varint(uint64(field)<<3 | uint64(wire))
+}
+
+// uint64 writes a varint field, omitted if zero as proto3 does.
+func (e *encoder) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.key(field, wireVarint)
+	e.varint(v)
+}
+
+func (e *encoder) int64(field int, v int64) {
+	e.uint64(field, uint64(v))
+}
+
+func (e *encoder) bool(field int, v bool) {
+	if v {
+		e.uint64(field, 1)
+	}
+}
+
+// bytes writes a length delimited field.
+func (e *encoder) bytes(field int, b []byte) {
+	e.key(field, wireBytes)
+	e.varint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) string(field int, s string) {
+	e.bytes(field, []byte(s))
+}
+
+// message writes a nested message built by f.
+func (e *encoder) message(field int, f func(m *encoder)) {
+	var m encoder
+	f(&m)
+	e.bytes(field, m.buf)
+}
+
+// packed writes a repeated varint field in packed form.
+func (e *encoder) packed(field int, values []uint64) {
+	if len(values) == 0 {
+		return
+	}
+
+	var m encoder
+	for _, v := range values {
+		m.varint(v)
+	}
+	e.bytes(field, m.buf)
+}
+
+// stringTable assigns the indexes of the strings of a profile.
+// The first string must be empty.
+type stringTable struct {
+	strings []string
+	index   map[string]int64
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{strings: []string{""}, index: map[string]int64{"": 0}}
+}
+
+func (t *stringTable) add(s string) int64 {
+	if i, ok := t.index[s]; ok {
+		return i
+	}
+
+	i := int64(len(t.strings))
+	t.strings = append(t.strings, s)
+	t.index[s] = i
+	return i
+}
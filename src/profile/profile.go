@@ -0,0 +1,282 @@
+// Package profile measures where CHIP-8 programs spend their time, counting the instructions
+// executed by every call stack. Profiles are written in the pprof format, to be examined
+// with "go tool pprof".
+package profile
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/valep27/GChip8/src/asm"
+	"github.com/valep27/GChip8/src/emu"
+)
+
+// Origin is the entry point of programs, the function at the bottom of every stack.
+const Origin = 0x200
+
+// frame is a function active when an instruction was executed.
+type frame struct {
+	// addr is the instruction being executed, or the call to the following frame.
+	addr uint16
+	// entry is the first address of the function.
+	entry uint16
+}
+
+// sample counts the instructions executed with the same stack and opcode.
+type sample struct {
+	// frames holds the stack, the outermost function first.
+	frames []frame
+	op     emu.Op
+	count  int64
+}
+
+// Profiler counts the instructions executed by a Chip8 for every call stack.
+// Call stacks follow the calls made with 2NNN and the returns of 00EE.
+// Its Trace method is meant to be registered with Chip8.SetTracer.
+type Profiler struct {
+	c8      *emu.Chip8
+	symbols *asm.Program
+	samples map[string]*sample
+	ops     map[emu.Op]int64
+	total   int64
+
+	// key and frames are reused between instructions.
+	key    []byte
+	frames []frame
+}
+
+// New returns a profiler for the program run by c8.
+// symbols, if not nil, names the functions after the labels and gives their position in the source.
+func New(c8 *emu.Chip8, symbols *asm.Program) *Profiler {
+	return &Profiler{
+		c8:      c8,
+		symbols: symbols,
+		samples: make(map[string]*sample),
+		ops:     make(map[emu.Op]int64),
+	}
+}
+
+// Trace counts an executed instruction.
+func (p *Profiler) Trace(e *emu.TraceEntry) {
+	if e.Err != nil {
+		return
+	}
+
+	op, _ := emu.DecodeOp(e.Opcode)
+	p.ops[op]++
+	p.total++
+
+	// the stack holds the address of the calls: each call gives the entry of the following frame
+	p.frames = p.frames[:0]
+	entry := uint16(Origin)
+	for _, call := range e.Before.Stack {
+		p.frames = append(p.frames, frame{call, entry})
+		entry = p.callTarget(call)
+	}
+	p.frames = append(p.frames, frame{e.PC, entry})
+
+	p.key = p.key[:0]
+	for _, f := range p.frames {
+		p.key = append(p.key, byte(f.addr>>8), byte(f.addr), byte(f.entry>>8), byte(f.entry))
+	}
+	p.key = append(p.key, byte(op))
+
+	s, ok := p.samples[string(p.key)]
+	if !ok {
+		s = &sample{frames: append([]frame(nil), p.frames...), op: op}
+		p.samples[string(p.key)] = s
+	}
+	s.count++
+}
+
+// callTarget returns the address called by the 2NNN instruction at addr.
+func (p *Profiler) callTarget(addr uint16) uint16 {
+	b := p.c8.ReadMemory(addr, 2)
+	if len(b) < 2 {
+		return 0
+	}
+
+	return uint16(b[0]&0xF)<<8 | uint16(b[1])
+}
+
+// Total returns the number of instructions counted.
+func (p *Profiler) Total() int64 {
+	return p.total
+}
+
+// functionName returns the name of the function starting at entry.
+func (p *Profiler) functionName(entry uint16) string {
+	if p.symbols != nil {
+		// labels are sorted so that the name does not depend on the order of the map
+		var names []string
+		for name, addr := range p.symbols.Symbols {
+			if addr == entry {
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			sort.Strings(names)
+			return names[0]
+		}
+	}
+
+	if entry == Origin {
+		return "main"
+	}
+
+	return fmt.Sprintf("sub_%03X", entry)
+}
+
+// sourceLines returns the position in the source of every address, if there are symbols.
+func (p *Profiler) sourceLines() map[uint16]asm.Position {
+	lines := make(map[uint16]asm.Position)
+	if p.symbols == nil {
+		return lines
+	}
+
+	for _, l := range p.symbols.Lines {
+		if _, ok := lines[l.Addr]; !ok {
+			lines[l.Addr] = l.Position
+		}
+	}
+
+	return lines
+}
+
+// Write writes the profile in the gzipped protocol buffer format of pprof.
+// Every sample holds the number of instructions executed and the time they take at the
+// clock speed of the emulator, and is labeled with the opcode pattern of the instruction, like "8XY4".
+func (p *Profiler) Write(w io.Writer) error {
+	period := int64(time.Second) / int64(p.c8.ClockSpeed())
+	table := newStringTable()
+	lines := p.sourceLines()
+
+	var out encoder
+	valueType := func(field int, typ, unit string) {
+		out.message(field, func(m *encoder) {
+			m.int64(valueTypeType, table.add(typ))
+			m.int64(valueTypeUnit, table.add(unit))
+		})
+	}
+	valueType(profileSampleType, "instructions", "count")
+	valueType(profileSampleType, "cpu", "nanoseconds")
+
+	functions := make(map[uint16]uint64)
+	locations := make(map[frame]uint64)
+	var functionOrder []uint16
+	var locationOrder []frame
+
+	// samples are written in a stable order, so that profiles of the same run are identical
+	keys := make([]string, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := p.samples[key]
+
+		// pprof lists the locations of a sample from the leaf to the root
+		ids := make([]uint64, len(s.frames))
+		for i, f := range s.frames {
+			if _, ok := functions[f.entry]; !ok {
+				functions[f.entry] = uint64(len(functions) + 1)
+				functionOrder = append(functionOrder, f.entry)
+			}
+			id, ok := locations[f]
+			if !ok {
+				id = uint64(len(locations) + 1)
+				locations[f] = id
+				locationOrder = append(locationOrder, f)
+			}
+			ids[len(ids)-1-i] = id
+		}
+
+		out.message(profileSample, func(m *encoder) {
+			m.packed(sampleLocationID, ids)
+			m.packed(sampleValue, []uint64{uint64(s.count), uint64(s.count * period)})
+			m.message(sampleLabel, func(l *encoder) {
+				l.int64(labelKey, table.add("opcode"))
+				l.int64(labelStr, table.add(s.op.String()))
+			})
+		})
+	}
+
+	out.message(profileMapping, func(m *encoder) {
+		m.uint64(mappingID, 1)
+		m.uint64(mappingMemoryStart, 0)
+		m.uint64(mappingMemoryLimit, 0x10000)
+		m.int64(mappingFilename, table.add("chip8"))
+		m.bool(mappingHasFunctions, true)
+		m.bool(mappingHasFilenames, p.symbols != nil)
+		m.bool(mappingHasLines, p.symbols != nil)
+	})
+
+	for _, f := range locationOrder {
+		out.message(profileLocation, func(m *encoder) {
+			m.uint64(locationID, locations[f])
+			m.uint64(locationMappingID, 1)
+			m.uint64(locationAddress, uint64(f.addr))
+			m.message(locationLine, func(l *encoder) {
+				l.uint64(lineFunctionID, functions[f.entry])
+				l.int64(lineLine, int64(lines[f.addr].Line))
+			})
+		})
+	}
+
+	for _, entry := range functionOrder {
+		name := table.add(p.functionName(entry))
+		out.message(profileFunction, func(m *encoder) {
+			m.uint64(functionID, functions[entry])
+			m.int64(functionName, name)
+			m.int64(functionSystemName, name)
+			m.int64(functionFilename, table.add(lines[entry].File))
+			m.int64(functionStartLine, int64(lines[entry].Line))
+		})
+	}
+
+	out.int64(profileDurationNanos, p.total*period)
+	valueType(profilePeriodType, "cpu", "nanoseconds")
+	out.int64(profilePeriod, period)
+	out.int64(profileDefaultType, table.add("instructions"))
+
+	// the string table is complete only now
+	for _, s := range table.strings {
+		out.string(profileStringTable, s)
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(out.buf); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// WriteHistogram writes the number of instructions executed for every opcode pattern,
+// the most frequent first.
+func (p *Profiler) WriteHistogram(w io.Writer) error {
+	ops := make([]emu.Op, 0, len(p.ops))
+	for op := range p.ops {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if p.ops[ops[i]] != p.ops[ops[j]] {
+			return p.ops[ops[i]] > p.ops[ops[j]]
+		}
+		return ops[i] < ops[j]
+	})
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "%-8s %12s %8s\n", "opcode", "count", "percent")
+	for _, op := range ops {
+		count := p.ops[op]
+		fmt.Fprintf(out, "%-8s %12d %7.2f%%\n", op, count, 100*float64(count)/float64(p.total))
+	}
+
+	return out.Flush()
+}
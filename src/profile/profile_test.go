@@ -0,0 +1,226 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/valep27/GChip8/src/asm"
+	"github.com/valep27/GChip8/src/emu"
+)
+
+const program = `: main
+	inc
+	jump main
+: inc
+	v3 += 1
+	return
+`
+
+// message is a decoded protocol buffer message: the values of every field, in order.
+// Varints are stored as uint64 and length delimited fields as []byte.
+type message map[int][]interface{}
+
+func decode(t *testing.T, b []byte) message {
+	t.Helper()
+
+	m := make(message)
+	varint := func() uint64 {
+		var v uint64
+		for shift := uint(0); ; shift += 7 {
+			if len(b) == 0 {
+				t.Fatal("truncated message")
+			}
+			c := b[0]
+			b = b[1:]
+			v |= uint64(c&0x7F) << shift
+			if c < 0x80 {
+				return v
+			}
+		}
+	}
+
+	for len(b) > 0 {
+		key := varint()
+		field := int(key >> 3)
+		switch key & 7 {
+		case wireVarint:
+			m[field] = append(m[field], varint())
+		case wireBytes:
+			n := varint()
+			m[field] = append(m[field], b[:n])
+			b = b[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+
+	return m
+}
+
+// packed decodes the values of a packed repeated varint field.
+func packed(t *testing.T, b []byte) []uint64 {
+	t.Helper()
+
+	// decode the values as a sequence of fields 0 with the varint wire type
+	var fields []byte
+	for len(b) > 0 {
+		n := 1
+		for b[n-1] >= 0x80 {
+			n++
+		}
+		fields = append(append(fields, wireVarint), b[:n]...)
+		b = b[n:]
+	}
+
+	var values []uint64
+	for _, v := range decode(t, fields)[0] {
+		values = append(values, v.(uint64))
+	}
+	return values
+}
+
+// uint returns the value of a varint field, zero if missing.
+func (m message) uint(field int) uint64 {
+	if len(m[field]) == 0 {
+		return 0
+	}
+	return m[field][0].(uint64)
+}
+
+// run profiles n instructions of program.
+func run(t *testing.T, n int, withSymbols bool) *Profiler {
+	t.Helper()
+
+	p, err := asm.Assemble("prog.8o", []byte(program))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c8 := emu.New()
+	if err := c8.LoadBytes(p.Binary); err != nil {
+		t.Fatal(err)
+	}
+
+	if !withSymbols {
+		p = nil
+	}
+	profiler := New(c8, p)
+	c8.SetTracer(profiler.Trace)
+
+	for i := 0; i < n; i++ {
+		if err := c8.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return profiler
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		symbols bool
+		caller  string
+		callee  string
+		line    uint64
+	}{
+		{true, "main", "inc", 5},
+		{false, "main", "sub_204", 0},
+	}
+
+	for _, tt := range tests {
+		profiler := run(t, 40, tt.symbols)
+
+		var out bytes.Buffer
+		if err := profiler.Write(&out); err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(gz)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := decode(t, data)
+		var table []string
+		for _, s := range p[profileStringTable] {
+			table = append(table, string(s.([]byte)))
+		}
+		str := func(i uint64) string { return table[i] }
+
+		functions := make(map[uint64]string)
+		for _, f := range p[profileFunction] {
+			f := decode(t, f.([]byte))
+			functions[f.uint(functionID)] = str(f.uint(functionName))
+		}
+
+		type location struct {
+			addr     uint64
+			function string
+			line     uint64
+		}
+		locations := make(map[uint64]location)
+		for _, l := range p[profileLocation] {
+			l := decode(t, l.([]byte))
+			line := decode(t, l[locationLine][0].([]byte))
+			locations[l.uint(locationID)] = location{l.uint(locationAddress), functions[line.uint(lineFunctionID)], line.uint(lineLine)}
+		}
+
+		// the instructions: 200 call, 204 v3 += 1, 206 return, 202 jump
+		counts := make(map[string]uint64)
+		var total uint64
+		for _, s := range p[profileSample] {
+			s := decode(t, s.([]byte))
+			var stack []string
+			for _, id := range packed(t, s[sampleLocationID][0].([]byte)) {
+				l := locations[id]
+				stack = append(stack, l.function)
+				if l.addr == 0x204 && l.line != tt.line {
+					t.Errorf("line of 0x204 = %d, want %d", l.line, tt.line)
+				}
+			}
+			count := packed(t, s[sampleValue][0].([]byte))[0]
+			counts[strings.Join(stack, " < ")] += count
+			total += count
+		}
+
+		want := map[string]uint64{tt.caller: 20, tt.callee + " < " + tt.caller: 20}
+		for stack, count := range want {
+			if counts[stack] != count {
+				t.Errorf("samples = %v, want %v", counts, want)
+				break
+			}
+		}
+		if total != 40 || profiler.Total() != 40 {
+			t.Errorf("total = %d, want 40", total)
+		}
+
+		if typ := str(p.uint(profileDefaultType)); typ != "instructions" {
+			t.Errorf("default sample type = %q", typ)
+		}
+	}
+}
+
+func TestWriteHistogram(t *testing.T) {
+	profiler := run(t, 40, false)
+
+	var out bytes.Buffer
+	if err := profiler.WriteHistogram(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `opcode          count  percent
+00EE               10   25.00%
+1NNN               10   25.00%
+2NNN               10   25.00%
+7XNN               10   25.00%
+`
+	if out.String() != want {
+		t.Errorf("WriteHistogram() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,83 @@
+package rewind
+
+// Buffer is a bounded history of emulator states, typically one per frame,
+// that can be walked backwards to play a game in reverse.
+//
+// Only the most recent state is kept in full: every older state is stored as a
+// delta against the state that followed it, so that memory usage stays small.
+// When the buffer is full, the oldest state is dropped.
+type Buffer struct {
+	latest []byte
+	deltas [][]byte
+	first  int
+	count  int
+}
+
+// NewBuffer creates a buffer able to go back the given number of states.
+// A negative capacity is taken as 0: the buffer keeps no states.
+func NewBuffer(capacity int) *Buffer {
+	if capacity < 0 {
+		capacity = 0
+	}
+
+	return &Buffer{nil, make([][]byte, capacity), 0, 0}
+}
+
+// Push records a new state, usually a snapshot of the emulator.
+// The buffer keeps its own copy of the data.
+func (b *Buffer) Push(state []byte) {
+	if b.latest != nil && len(b.deltas) > 0 {
+		delta := diff(state, b.latest)
+
+		if b.count == len(b.deltas) {
+			// drop the oldest state
+			b.first = (b.first + 1) % len(b.deltas)
+			b.count--
+		}
+
+		b.deltas[(b.first+b.count)%len(b.deltas)] = delta
+		b.count++
+	}
+
+	b.latest = append(b.latest[:0], state...)
+}
+
+// Pop goes back one state, discarding the most recent one, and returns the new most recent state.
+// It returns false when there is no older state to go back to.
+// The returned slice is owned by the buffer and is only valid until the next call to Push or Pop.
+func (b *Buffer) Pop() ([]byte, bool) {
+	if b.count == 0 {
+		return nil, false
+	}
+
+	last := (b.first + b.count - 1) % len(b.deltas)
+	previous, err := patch(b.latest, b.deltas[last])
+
+	b.deltas[last] = nil
+	b.count--
+
+	if err != nil {
+		// deltas are only produced by Push, this can't happen unless memory is corrupted
+		b.Clear()
+		return nil, false
+	}
+
+	b.latest = previous
+	return b.latest, true
+}
+
+// Len returns how many states the buffer can go back.
+func (b *Buffer) Len() int {
+	return b.count
+}
+
+// Clear removes all the states from the buffer.
+func (b *Buffer) Clear() {
+	for i := range b.deltas {
+		b.deltas[i] = nil
+	}
+
+	b.latest = nil
+	b.first = 0
+	b.count = 0
+}
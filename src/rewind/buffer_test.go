@@ -0,0 +1,130 @@
+package rewind
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// states returns n states of the given size, each differing slightly from the previous one.
+func states(n, size int) [][]byte {
+	rng := rand.New(rand.NewSource(1))
+	result := make([][]byte, n)
+	state := make([]byte, size)
+
+	for i := range result {
+		for j := 0; j < 3; j++ {
+			state[rng.Intn(size)] = byte(rng.Intn(256))
+		}
+		result[i] = append([]byte(nil), state...)
+	}
+
+	return result
+}
+
+func TestBufferPopReturnsPreviousStates(t *testing.T) {
+	history := states(50, 1024)
+	b := NewBuffer(100)
+
+	for _, state := range history {
+		b.Push(state)
+	}
+
+	for i := len(history) - 2; i >= 0; i-- {
+		got, ok := b.Pop()
+		if !ok {
+			t.Fatalf("Pop() returned false at state %v", i)
+		}
+		if !bytes.Equal(got, history[i]) {
+			t.Fatalf("Pop() state %v differs", i)
+		}
+	}
+
+	if _, ok := b.Pop(); ok {
+		t.Errorf("Pop() on the first state should return false")
+	}
+}
+
+func TestBufferCapacity(t *testing.T) {
+	history := states(30, 256)
+	b := NewBuffer(10)
+
+	for _, state := range history {
+		b.Push(state)
+	}
+
+	if b.Len() != 10 {
+		t.Fatalf("Len() = %v, want 10", b.Len())
+	}
+
+	for i := 0; i < 10; i++ {
+		got, ok := b.Pop()
+		if want := history[len(history)-2-i]; !ok || !bytes.Equal(got, want) {
+			t.Fatalf("Pop() %v returned the wrong state", i)
+		}
+	}
+
+	if _, ok := b.Pop(); ok {
+		t.Errorf("Pop() should return false after going back 10 states")
+	}
+}
+
+func TestBufferNegativeCapacity(t *testing.T) {
+	b := NewBuffer(-1)
+
+	for _, state := range states(3, 16) {
+		b.Push(state)
+	}
+
+	if _, ok := b.Pop(); ok || b.Len() != 0 {
+		t.Errorf("a buffer with a negative capacity should keep no states")
+	}
+}
+
+func TestBufferPushAfterPop(t *testing.T) {
+	history := states(10, 64)
+	b := NewBuffer(20)
+
+	for _, state := range history {
+		b.Push(state)
+	}
+	b.Pop()
+	b.Pop()
+	b.Push(history[9])
+
+	if got, _ := b.Pop(); !bytes.Equal(got, history[7]) {
+		t.Errorf("Pop() after pushing a new state returned the wrong state")
+	}
+}
+
+func TestDiffDifferentSizes(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to []byte
+	}{
+		{"equal", []byte{1, 2, 3}, []byte{1, 2, 3}},
+		{"grow", []byte{1, 2}, []byte{1, 2, 3, 4}},
+		{"shrink", []byte{1, 2, 3, 4}, []byte{1, 9}},
+		{"from empty", nil, []byte{1, 2}},
+		{"to empty", []byte{1, 2}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := patch(tt.from, diff(tt.from, tt.to))
+			if err != nil {
+				t.Fatalf("patch() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.to) {
+				t.Errorf("patch() = %v, want %v", got, tt.to)
+			}
+		})
+	}
+}
+
+func TestDeltaIsSmall(t *testing.T) {
+	history := states(2, 70000)
+
+	if size := len(diff(history[1], history[0])); size > 32 {
+		t.Errorf("delta of 3 changed bytes is %v bytes long", size)
+	}
+}
@@ -0,0 +1,106 @@
+package rewind
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// errCorruptDelta is returned when a delta cannot be decoded.
+var errCorruptDelta = errors.New("rewind: corrupt delta")
+
+// diff returns a delta that turns from into to when passed to patch.
+//
+// The delta is the XOR of the two states, run-length encoded: it starts with the
+// length of to, followed by pairs of runs, each made of the number of unchanged bytes
+// and the number of changed bytes, followed by the XOR of the changed bytes.
+// All numbers are unsigned varints. Consecutive states of the emulator differ in
+// very few bytes, so deltas are usually a few bytes long.
+func diff(from, to []byte) []byte {
+	delta := binary.AppendUvarint(nil, uint64(len(to)))
+	size := len(to)
+
+	if len(from) > size {
+		size = len(from)
+	}
+
+	xor := func(i int) byte {
+		var a, b byte
+		if i < len(from) {
+			a = from[i]
+		}
+		if i < len(to) {
+			b = to[i]
+		}
+		return a ^ b
+	}
+
+	for i := 0; i < size; {
+		start := i
+		for i < size && xor(i) == 0 {
+			i++
+		}
+		same := i - start
+
+		start = i
+		for i < size && xor(i) != 0 {
+			i++
+		}
+
+		delta = binary.AppendUvarint(delta, uint64(same))
+		delta = binary.AppendUvarint(delta, uint64(i-start))
+
+		for j := start; j < i; j++ {
+			delta = append(delta, xor(j))
+		}
+	}
+
+	return delta
+}
+
+// patch applies a delta returned by diff(from, to) to from, returning to.
+func patch(from, delta []byte) ([]byte, error) {
+	size, n := binary.Uvarint(delta)
+
+	if n <= 0 {
+		return nil, errCorruptDelta
+	}
+	delta = delta[n:]
+
+	// XOR runs can span past the end of to when from is longer, so work on a buffer
+	// large enough for both and truncate at the end
+	workSize := int(size)
+	if len(from) > workSize {
+		workSize = len(from)
+	}
+
+	work := make([]byte, workSize)
+	copy(work, from)
+
+	for i := 0; len(delta) > 0; {
+		same, n := binary.Uvarint(delta)
+		if n <= 0 {
+			return nil, errCorruptDelta
+		}
+		delta = delta[n:]
+
+		changed, n := binary.Uvarint(delta)
+		if n <= 0 || uint64(len(delta)-n) < changed {
+			return nil, errCorruptDelta
+		}
+		delta = delta[n:]
+
+		i += int(same)
+		if i+int(changed) > len(work) {
+			return nil, errCorruptDelta
+		}
+
+		for j := 0; j < int(changed); j++ {
+			work[i+j] ^= delta[j]
+		}
+
+		i += int(changed)
+		delta = delta[changed:]
+	}
+
+	return work[:size], nil
+}
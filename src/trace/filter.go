@@ -0,0 +1,189 @@
+package trace
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/valep27/GChip8/src/emu"
+)
+
+// classes groups the instructions by what they do, to filter the trace.
+var classes = map[emu.Op]string{
+	emu.OpInvalid: "invalid",
+	emu.Op00E0:    "display",
+	emu.Op00EE:    "flow",
+	emu.Op00CN:    "display",
+	emu.Op00FB:    "display",
+	emu.Op00FC:    "display",
+	emu.Op00FD:    "flow",
+	emu.Op00FE:    "display",
+	emu.Op00FF:    "display",
+	emu.Op1NNN:    "flow",
+	emu.Op2NNN:    "flow",
+	emu.Op3XNN:    "cond",
+	emu.Op4XNN:    "cond",
+	emu.Op5XY0:    "cond",
+	emu.Op5XY2:    "mem",
+	emu.Op5XY3:    "mem",
+	emu.Op6XNN:    "const",
+	emu.Op7XNN:    "const",
+	emu.Op8XY0:    "alu",
+	emu.Op8XY1:    "alu",
+	emu.Op8XY2:    "alu",
+	emu.Op8XY3:    "alu",
+	emu.Op8XY4:    "alu",
+	emu.Op8XY5:    "alu",
+	emu.Op8XY6:    "alu",
+	emu.Op8XY7:    "alu",
+	emu.Op8XYE:    "alu",
+	emu.Op9XY0:    "cond",
+	emu.OpANNN:    "mem",
+	emu.OpBNNN:    "flow",
+	emu.OpCXNN:    "rand",
+	emu.OpDXYN:    "display",
+	emu.OpEX9E:    "key",
+	emu.OpEXA1:    "key",
+	emu.OpF000:    "mem",
+	emu.OpFN01:    "display",
+	emu.OpF002:    "sound",
+	emu.OpFX07:    "timer",
+	emu.OpFX0A:    "key",
+	emu.OpFX15:    "timer",
+	emu.OpFX18:    "sound",
+	emu.OpFX1E:    "mem",
+	emu.OpFX29:    "mem",
+	emu.OpFX30:    "mem",
+	emu.OpFX33:    "mem",
+	emu.OpFX3A:    "sound",
+	emu.OpFX55:    "mem",
+	emu.OpFX65:    "mem",
+	emu.OpFX75:    "mem",
+	emu.OpFX85:    "mem",
+}
+
+// ClassNames lists the opcode classes accepted by ParseClasses, besides the opcode nibbles.
+const ClassNames = "flow, cond, const, alu, mem, display, rand, key, timer, sound, invalid"
+
+// Class returns the class of an opcode: one of the names in ClassNames.
+func Class(opcode uint16) string {
+	op, _ := emu.DecodeOp(opcode)
+	return classes[op]
+}
+
+// Range is an inclusive range of addresses.
+type Range struct {
+	Start, End uint16
+}
+
+// Contains returns true if addr is inside the range.
+func (r Range) Contains(addr uint16) bool {
+	return addr >= r.Start && addr <= r.End
+}
+
+// Filter selects the instructions written to the trace.
+// An empty filter selects every instruction.
+type Filter struct {
+	// Ranges, if not empty, selects the instructions at one of these addresses.
+	Ranges []Range
+	// Classes, if not empty, selects the instructions of one of these classes.
+	// Besides the names of Class, a class can be the hex digit of the first nibble of the opcode.
+	Classes []string
+}
+
+// Match returns true if the instruction at pc is selected by the filter.
+func (f Filter) Match(pc, opcode uint16) bool {
+	if len(f.Ranges) > 0 && !f.matchRange(pc) {
+		return false
+	}
+
+	return len(f.Classes) == 0 || f.matchClass(opcode)
+}
+
+func (f Filter) matchRange(pc uint16) bool {
+	for _, r := range f.Ranges {
+		if r.Contains(pc) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f Filter) matchClass(opcode uint16) bool {
+	class := Class(opcode)
+	nibble := fmt.Sprintf("%X", opcode>>12)
+
+	for _, c := range f.Classes {
+		if c == class || c == nibble {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseRanges parses a comma separated list of addresses or ranges, like "0x200-0x2FF,0x3A0".
+func ParseRanges(text string) ([]Range, error) {
+	var ranges []Range
+
+	for _, field := range strings.Split(text, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		start, end := field, field
+		if i := strings.Index(field, "-"); i >= 0 {
+			start, end = field[:i], field[i+1:]
+		}
+
+		s, err := strconv.ParseUint(strings.TrimSpace(start), 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address range '%s'", field)
+		}
+		e, err := strconv.ParseUint(strings.TrimSpace(end), 0, 16)
+		if err != nil || e < s {
+			return nil, fmt.Errorf("invalid address range '%s'", field)
+		}
+
+		ranges = append(ranges, Range{uint16(s), uint16(e)})
+	}
+
+	return ranges, nil
+}
+
+// ParseClasses parses a comma separated list of opcode classes, like "flow,display,8".
+func ParseClasses(text string) ([]string, error) {
+	var result []string
+
+	for _, field := range strings.Split(text, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+
+		if len(field) == 1 && strings.Contains("0123456789abcdef", field) {
+			result = append(result, strings.ToUpper(field))
+			continue
+		}
+
+		if !isClass(field) {
+			return nil, fmt.Errorf("unknown opcode class '%s', must be one of: %s or a hex digit", field, ClassNames)
+		}
+		result = append(result, field)
+	}
+
+	return result, nil
+}
+
+// isClass returns true if name is the name of an opcode class.
+func isClass(name string) bool {
+	for _, class := range classes {
+		if class == name {
+			return true
+		}
+	}
+
+	return false
+}
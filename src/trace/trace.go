@@ -0,0 +1,169 @@
+// Package trace logs the instructions executed by the emulator, with the registers before and after
+// each of them, to compare the execution of a program with other emulators.
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/valep27/GChip8/src/disasm"
+	"github.com/valep27/GChip8/src/emu"
+)
+
+// Format is the format of the trace.
+type Format int
+
+// The supported formats.
+const (
+	// Human shows the mnemonic of every instruction and the registers it changed,
+	// with their value before and after the instruction.
+	Human Format = iota
+	// Machine shows every register before and after each instruction in fixed order and width,
+	// so that traces can be compared with diff or other line based tools.
+	// It does not depend on the disassembler, and its layout will not change.
+	Machine
+)
+
+// ParseFormat returns the format with the given name, "human" or "machine".
+func ParseFormat(name string) (Format, bool) {
+	switch strings.ToLower(name) {
+	case "human":
+		return Human, true
+	case "machine":
+		return Machine, true
+	}
+
+	return Human, false
+}
+
+// Tracer writes the instructions executed by a Chip8 to a writer.
+// Its Trace method is meant to be registered with Chip8.SetTracer.
+type Tracer struct {
+	out    *bufio.Writer
+	format Format
+	filter Filter
+	// cycle counts every executed instruction, including the ones excluded by the filter.
+	cycle uint64
+	// err is the first write error.
+	err error
+	// program formats the instructions, without labels.
+	program disasm.Program
+}
+
+// New returns a tracer writing instructions selected by filter to w.
+// The output is buffered: Flush must be called when done.
+func New(w io.Writer, format Format, filter Filter) *Tracer {
+	return &Tracer{
+		out:    bufio.NewWriter(w),
+		format: format,
+		filter: filter,
+	}
+}
+
+// Cycles returns the number of instructions traced so far.
+func (t *Tracer) Cycles() uint64 {
+	return t.cycle
+}
+
+// Trace logs an executed instruction.
+func (t *Tracer) Trace(e *emu.TraceEntry) {
+	cycle := t.cycle
+	t.cycle++
+
+	if t.err != nil || !t.filter.Match(e.PC, e.Opcode) {
+		return
+	}
+
+	if t.format == Machine {
+		t.writeMachine(cycle, e)
+	} else {
+		t.writeHuman(cycle, e)
+	}
+}
+
+// Flush writes any buffered output, returning the first write error.
+func (t *Tracer) Flush() error {
+	if t.err != nil {
+		return t.err
+	}
+
+	t.err = t.out.Flush()
+	return t.err
+}
+
+// writeHuman writes a line with the cycle right-aligned on 8 columns,
+// like this one from the tests:
+//
+//	"       1  0x202  8014  ADD V0, V1            V0 0x00->0x02"
+func (t *Tracer) writeHuman(cycle uint64, e *emu.TraceEntry) {
+	in, _ := emu.Decode(e.Opcode)
+	mnemonic := t.program.Format(disasm.Instruction{Instruction: in, Addr: e.PC, Long: e.Long}, disasm.Cowgod)
+
+	var line strings.Builder
+	fmt.Fprintf(&line, "%8d  0x%03X  %04X  %-20s", cycle, e.PC, e.Opcode, mnemonic)
+
+	if e.Err != nil {
+		fmt.Fprintf(&line, "  error: %s", e.Err)
+	} else {
+		writeChanges(&line, &e.Before, &e.After)
+	}
+
+	t.writeLine(strings.TrimRight(line.String(), " "))
+}
+
+// writeChanges writes the registers that differ between before and after.
+func writeChanges(line *strings.Builder, before, after *emu.Registers) {
+	for i := range before.V {
+		if before.V[i] != after.V[i] {
+			fmt.Fprintf(line, "  V%X 0x%02X->0x%02X", i, before.V[i], after.V[i])
+		}
+	}
+	if before.I != after.I {
+		fmt.Fprintf(line, "  I 0x%03X->0x%03X", before.I, after.I)
+	}
+	if before.SP != after.SP {
+		fmt.Fprintf(line, "  SP %d->%d", before.SP, after.SP)
+	}
+	if before.DelayTimer != after.DelayTimer {
+		fmt.Fprintf(line, "  DT %d->%d", before.DelayTimer, after.DelayTimer)
+	}
+	if before.SoundTimer != after.SoundTimer {
+		fmt.Fprintf(line, "  ST %d->%d", before.SoundTimer, after.SoundTimer)
+	}
+}
+
+// writeMachine writes a line like:
+//
+//	152 pc=021A op=8014 v=03020000000000000000000000000000 i=0300 sp=00 dt=00 st=00 > pc=021C v=... i=0300 sp=00 dt=00 st=00
+//
+// The opcode of F000 NNNN includes its operand. On error, the line ends with "err=" and the error message.
+func (t *Tracer) writeMachine(cycle uint64, e *emu.TraceEntry) {
+	var line strings.Builder
+
+	fmt.Fprintf(&line, "%d pc=%04X op=%04X", cycle, e.PC, e.Opcode)
+	if e.Opcode == 0xF000 {
+		fmt.Fprintf(&line, "%04X", e.Long)
+	}
+
+	writeRegisters(&line, &e.Before)
+	fmt.Fprintf(&line, " > pc=%04X", e.After.PC)
+	writeRegisters(&line, &e.After)
+
+	if e.Err != nil {
+		fmt.Fprintf(&line, " err=%s", e.Err)
+	}
+
+	t.writeLine(line.String())
+}
+
+func writeRegisters(line *strings.Builder, r *emu.Registers) {
+	fmt.Fprintf(line, " v=%X i=%04X sp=%02X dt=%02X st=%02X", r.V[:], r.I, r.SP, r.DelayTimer, r.SoundTimer)
+}
+
+func (t *Tracer) writeLine(line string) {
+	if _, err := t.out.WriteString(line + "\n"); err != nil {
+		t.err = err
+	}
+}
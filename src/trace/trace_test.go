@@ -0,0 +1,121 @@
+package trace
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/valep27/GChip8/src/emu"
+)
+
+// program loops forever, adding V1 to V0 and calling a subroutine that sets the delay timer.
+var program = []byte{
+	0x61, 0x02, // 200: v1 := 2
+	0x80, 0x14, // 202: v0 += v1
+	0x22, 0x08, // 204: call 0x208
+	0x12, 0x02, // 206: jump 0x202
+	0xF0, 0x15, // 208: delay := v0
+	0x00, 0xEE, // 20A: return
+}
+
+// runTrace executes n instructions of program and returns the trace.
+func runTrace(t *testing.T, n int, format Format, filter Filter) string {
+	t.Helper()
+
+	c8 := emu.New()
+	if err := c8.LoadBytes(program); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	tracer := New(&out, format, filter)
+	c8.SetTracer(tracer.Trace)
+
+	for i := 0; i < n; i++ {
+		if err := c8.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if tracer.Cycles() != uint64(n) {
+		t.Errorf("Cycles() = %d, want %d", tracer.Cycles(), n)
+	}
+
+	return out.String()
+}
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{Human, `       0  0x200  6102  LD V1, #02            V1 0x00->0x02
+       1  0x202  8014  ADD V0, V1            V0 0x00->0x02
+       2  0x204  2208  CALL #208             SP 0->1
+       3  0x208  F015  LD DT, V0             DT 0->2
+`},
+		{Machine, `0 pc=0200 op=6102 v=00000000000000000000000000000000 i=0000 sp=00 dt=00 st=00 > pc=0202 v=00020000000000000000000000000000 i=0000 sp=00 dt=00 st=00
+1 pc=0202 op=8014 v=00020000000000000000000000000000 i=0000 sp=00 dt=00 st=00 > pc=0204 v=02020000000000000000000000000000 i=0000 sp=00 dt=00 st=00
+2 pc=0204 op=2208 v=02020000000000000000000000000000 i=0000 sp=00 dt=00 st=00 > pc=0208 v=02020000000000000000000000000000 i=0000 sp=01 dt=00 st=00
+3 pc=0208 op=F015 v=02020000000000000000000000000000 i=0000 sp=01 dt=00 st=00 > pc=020A v=02020000000000000000000000000000 i=0000 sp=01 dt=02 st=00
+`},
+	}
+
+	for _, tt := range tests {
+		if got := runTrace(t, 4, tt.format, Filter{}); got != tt.want {
+			t.Errorf("trace in format %d =\n%s\nwant\n%s", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	tests := []struct {
+		ranges  string
+		classes string
+		want    []string
+	}{
+		{"0x206-0x20A", "", []string{"0x208", "0x20A", "0x206"}},
+		{"0x200,0x204", "", []string{"0x200", "0x204"}},
+		{"", "flow", []string{"0x204", "0x20A", "0x206"}},
+		{"", "timer,8", []string{"0x202", "0x208"}},
+		{"0x204-0x208", "flow", []string{"0x204", "0x206"}},
+	}
+
+	for _, tt := range tests {
+		ranges, err := ParseRanges(tt.ranges)
+		if err != nil {
+			t.Fatal(err)
+		}
+		classes, err := ParseClasses(tt.classes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, line := range strings.Split(strings.TrimSpace(runTrace(t, 6, Human, Filter{ranges, classes})), "\n") {
+			if fields := strings.Fields(line); len(fields) > 1 {
+				got = append(got, fields[1])
+			}
+		}
+
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("ranges %q, classes %q: traced %v, want %v", tt.ranges, tt.classes, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, text := range []string{"0x300-0x200", "0x10000", "x-1"} {
+		if _, err := ParseRanges(text); err == nil {
+			t.Errorf("ParseRanges(%q) succeeded", text)
+		}
+	}
+
+	for _, text := range []string{"jump", "10"} {
+		if _, err := ParseClasses(text); err == nil {
+			t.Errorf("ParseClasses(%q) succeeded", text)
+		}
+	}
+}